@@ -0,0 +1,143 @@
+//Filename: cmd/api/apikeys.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// keyOwner() returns the member id whose keys and calendar tokens the caller may see and revoke, 0 meaning everyone's.
+// admins manage every key in the workspace, other members only their own
+func (app *application) keyOwner(r *http.Request) int64 {
+	c := app.contextGetCaller(r)
+	if c.anonymous() || data.RoleAtLeast(c.member.Role, data.RoleAdmin) {
+		return 0
+	}
+	return c.member.ID
+}
+
+// createAPIKeyHandler for the "POST /v1/api-keys" endpoint
+// the key is for the caller unless member_id names someone else, which takes an admin.
+// the key is only ever shown in this response
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string   `json:"name"`
+		Scopes   []string `json:"scopes"`
+		MemberID int64    `json:"member_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	c := app.contextGetCaller(r)
+	if input.MemberID == 0 && !c.anonymous() {
+		input.MemberID = c.member.ID
+	}
+	key := &data.APIKey{Name: input.Name, Scopes: input.Scopes, MemberID: input.MemberID}
+	v := validator.New()
+	v.Check(input.MemberID > 0, "member_id", "must be provided")
+	if data.ValidateAPIKey(v, key); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if owner := app.keyOwner(r); owner != 0 && owner != input.MemberID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	member, err := app.models.Members.Get(app.contextGetWorkspace(r).ID, input.MemberID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("member_id", "must be a member of the workspace")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	//an admin can't hand out a key that acts as an owner
+	if !c.anonymous() && member.ID != c.member.ID && !data.RoleAtLeast(c.member.Role, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	key.WorkspaceID = member.WorkspaceID
+	err = app.models.APIKeys.New(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAPIKeysHandler for the "GET /v1/api-keys" endpoint
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.models.APIKeys.GetAll(app.contextGetWorkspace(r).ID, app.keyOwner(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAPIKeyHandler for the "DELETE /v1/api-keys/:id" endpoint
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.APIKeys.Delete(app.contextGetWorkspace(r).ID, app.keyOwner(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeMemberAPIKeysHandler for the "DELETE /v1/members/:id/api-keys" endpoint.
+// it revokes all of a member's keys at once, a member can do it for themselves and an admin for anyone but an owner.
+// a password reset leaves keys alone, a script shouldn't stop because someone forgot their password
+func (app *application) revokeMemberAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.readMember(w, r)
+	if !ok {
+		return
+	}
+	c := app.contextGetCaller(r)
+	if owner := app.keyOwner(r); owner != 0 && owner != member.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	if !c.anonymous() && member.ID != c.member.ID && !data.RoleAtLeast(c.member.Role, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	revoked, err := app.models.APIKeys.DeleteAll(member.WorkspaceID, member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("%d api keys revoked", revoked)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,293 @@
+//Filename: cmd/api/attachments.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/storage"
+	"todo.joelical.net/internal/validator"
+)
+
+const (
+	// the largest file that can be attached, 25MB
+	attachmentMaxBytes = 25 << 20
+	// how long an upload may take to arrive. the server's ReadTimeout would cut off large files on slow connections
+	uploadTimeout = 5 * time.Minute
+	// how often blobs of deleted attachments are removed from the store, and how many at a time
+	blobSweepInterval  = time.Minute
+	blobSweepBatchSize = 100
+)
+
+// createAttachmentHandler for the "POST /v1/list/:id/attachments" endpoint
+// it accepts a multipart upload with a "file" part. the file is streamed into the blob store as it arrives
+// rather than being read into memory, and its type is sniffed from the content instead of trusting the client
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	app.extendDeadlines(r, uploadTimeout)
+	//leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, attachmentMaxBytes+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must be a multipart form with a file"))
+		return
+	}
+	used, err := app.models.Attachments.StorageUsed(workspace.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	remaining := workspace.MaxStorage - used
+	if remaining <= 0 {
+		app.storageQuotaExceededResponse(w, r)
+		return
+	}
+	limit := int64(attachmentMaxBytes)
+	if remaining < limit {
+		limit = remaining
+	}
+	//skip any other fields until the file
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF):
+				app.badRequestResponse(w, r, errors.New("the file field must be provided"))
+			case err.Error() == "http: request body too large":
+				app.badRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", attachmentMaxBytes))
+			default:
+				app.badRequestResponse(w, r, errors.New("body must be a multipart form with a file"))
+			}
+			return
+		}
+		if part.FormName() == "file" {
+			app.storeAttachment(w, r, workspace, list, part, limit)
+			return
+		}
+		part.Close()
+	}
+}
+
+// storeAttachment() saves the uploaded file to the blob store and then records it.
+// the blob is deleted again if the upload turns out to be too big or can't be recorded
+func (app *application) storeAttachment(w http.ResponseWriter, r *http.Request, workspace *data.Workspace, list *data.List, file *multipart.Part, limit int64) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	head = head[:n]
+	key, err := newStorageKey(workspace.ID, list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	attachment := &data.Attachment{
+		ListID:      list.ID,
+		Filename:    file.FileName(),
+		ContentType: http.DetectContentType(head),
+		Size:        int64(len(head)),
+		StorageKey:  key,
+	}
+	v := validator.New()
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	//one byte past the limit is enough to know the file is too big
+	body := &io.LimitedReader{R: io.MultiReader(bytes.NewReader(head), file), N: limit + 1}
+	attachment.Size, err = app.blobs.Put(r.Context(), key, body)
+	if err != nil {
+		app.deleteBlob(key)
+		switch {
+		case err.Error() == "http: request body too large":
+			app.badRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", attachmentMaxBytes))
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if attachment.Size > limit {
+		app.deleteBlob(key)
+		switch {
+		case limit < attachmentMaxBytes:
+			app.storageQuotaExceededResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, fmt.Errorf("file must not be larger than %d bytes", attachmentMaxBytes))
+		}
+		return
+	}
+	//another upload may have used up the quota in the meantime, Insert() has the final say
+	err = app.models.Attachments.Insert(workspace.ID, attachment)
+	if err != nil {
+		app.deleteBlob(key)
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.storageQuotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d/attachments/%d", workspace.ID, list.ID, attachment.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAttachmentsHandler for the "GET /v1/list/:id/attachments" endpoint
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	attachments, err := app.models.Attachments.GetAll(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadAttachmentHandler for the "GET /v1/list/:id/attachments/:attachment_id" endpoint
+// http.ServeContent() takes care of Range and If-Range, so large files can be resumed or read in pieces
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachment(w, r)
+	if !ok {
+		return
+	}
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	//attachments never change, so the id is enough to tell versions apart
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, attachment.ID))
+
+	content := storage.NewReader(r.Context(), app.blobs, attachment.StorageKey, attachment.Size)
+	defer content.Close()
+	http.ServeContent(w, r, "", attachment.CreatedAt, content)
+}
+
+// deleteAttachmentHandler for the "DELETE /v1/list/:id/attachments/:attachment_id" endpoint
+// the file itself is removed from the blob store in the background
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachment(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Attachments.Delete(attachment.ListID, attachment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAttachment() loads the ":attachment_id" attachment of the ":id" list in the request's workspace
+func (app *application) readAttachment(w http.ResponseWriter, r *http.Request) (*data.Attachment, bool) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return nil, false
+	}
+	attachmentID, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	attachment, err := app.models.Attachments.Get(list.ID, attachmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return attachment, true
+}
+
+// newStorageKey() returns a random key for a new blob, grouped by workspace and list
+func newStorageKey(workspaceID, listID int64) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%d/%s", workspaceID, listID, hex.EncodeToString(b)), nil
+}
+
+// deleteBlob() removes a blob that was stored for an upload that then failed
+func (app *application) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := app.blobs.Delete(ctx, key)
+	if err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// sweepBlobs() runs in the background and removes the blobs of deleted attachments until the server shuts down.
+// deleting a blob twice is harmless, so replicas don't need to coordinate
+func (app *application) sweepBlobs() {
+	ticker := time.NewTicker(blobSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.quit:
+			return
+		case <-ticker.C:
+		}
+		keys, err := app.models.Attachments.PendingBlobDeletions(blobSweepBatchSize)
+		if err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		for _, key := range keys {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := app.blobs.Delete(ctx, key)
+			cancel()
+			if err != nil {
+				app.logger.Println(err)
+				continue
+			}
+			err = app.models.Attachments.BlobDeleted(key)
+			if err != nil {
+				app.logger.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//Filename: cmd/api/board.go
+
+package main
+
+import (
+	"net/http"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// the validation message when a list is moved into a full column
+const wipLimitMessage = "the board column for this status has reached its work in progress limit"
+
+// showBoardHandler for the "GET /v1/board" endpoint
+// the workspace's lists grouped into a column per status, each in position order
+func (app *application) showBoardHandler(w http.ResponseWriter, r *http.Request) {
+	columns, err := app.models.Board.GetBoard(app.contextGetWorkspace(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"columns": columns}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showBoardColumnsHandler for the "GET /v1/board/columns" endpoint
+func (app *application) showBoardColumnsHandler(w http.ResponseWriter, r *http.Request) {
+	columns, err := app.models.Board.GetColumns(app.contextGetWorkspace(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"columns": columns}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateBoardColumnsHandler for the "PUT /v1/board/columns" endpoint
+// the columns sent replace the workspace's columns, in the order given. lowering a wip_limit
+// below what a column already holds only stops more lists from being moved into it
+func (app *application) updateBoardColumnsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Columns []*data.BoardColumn `json:"columns"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Columns == nil {
+		input.Columns = []*data.BoardColumn{}
+	}
+	v := validator.New()
+	if data.ValidateBoardColumns(v, input.Columns); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Board.SetColumns(app.contextGetWorkspace(r).ID, input.Columns)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"columns": input.Columns}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
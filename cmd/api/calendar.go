@@ -0,0 +1,255 @@
+//Filename: cmd/api/calendar.go
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// the layout of a UTC DATE-TIME value in iCalendar
+const icalTimeLayout = "20060102T150405Z"
+
+// createCalendarTokenHandler for the "POST /v1/tokens/calendar" endpoint
+// the token is only ever shown in this response
+func (app *application) createCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateCalendarToken(v, &data.CalendarToken{Name: input.Name}); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	var memberID *int64
+	if c := app.contextGetCaller(r); !c.anonymous() {
+		memberID = &c.member.ID
+	}
+	token, err := app.models.Calendar.New(workspace.ID, memberID, input.Name)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"calendar_token": token,
+		"feed_url":       fmt.Sprintf("/v1/calendar/%s.ics", token.Plaintext),
+	}
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCalendarTokensHandler for the "GET /v1/tokens/calendar" endpoint
+// members see their own tokens, admins see every token in the workspace
+func (app *application) listCalendarTokensHandler(w http.ResponseWriter, r *http.Request) {
+	workspace := app.contextGetWorkspace(r)
+	tokens, err := app.models.Calendar.GetAll(workspace.ID, app.keyOwner(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"calendar_tokens": tokens}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCalendarTokenHandler for the "DELETE /v1/tokens/calendar/:id" endpoint
+// someone else's token looks the same as one that doesn't exist unless the caller is an admin
+func (app *application) deleteCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	err = app.models.Calendar.Delete(workspace.ID, app.keyOwner(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "calendar token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calendarFeedHandler for the "GET /v1/calendar/:token.ics" endpoint
+// tasks are sent as VTODOs, or as VEVENTs with ?component=vevent for calendar apps that ignore VTODO.
+// ?assignee= narrows the feed like it does GET /v1/list, with "me" being the member who made the token
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	//httprouter can't match a suffix so ".ics" is part of the parameter
+	plaintext := httprouter.ParamsFromContext(r.Context()).ByName("token")
+	if !strings.HasSuffix(plaintext, ".ics") {
+		app.notFoundResponse(w, r)
+		return
+	}
+	plaintext = strings.TrimSuffix(plaintext, ".ics")
+	v := validator.New()
+	component := app.readString(r.URL.Query(), "component", "vtodo")
+	v.Check(validator.In(component, "vtodo", "vevent"), "component", "must be vtodo or vevent")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	//an unknown or revoked token looks the same as a feed that doesn't exist
+	if data.ValidateTokenPlaintext(v, plaintext); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+	token, err := app.models.Calendar.Use(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	//the feed is read as the member who made the token
+	if token.MemberID != nil {
+		member, err := app.models.Members.Get(token.WorkspaceID, *token.MemberID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		r = app.contextSetCaller(r, &caller{member: member, scopes: []string{data.ScopeRead}})
+	}
+	assignee := app.readAssignee(r, r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	//the token decides which workspace's tasks are in the feed
+	lists, err := app.models.List.GetAllDue(token.WorkspaceID, assignee)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := renderCalendar(lists, component)
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todo.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// renderCalendar() builds an RFC 5545 calendar. the output only depends on the lists
+// so the same lists always give the same ETag
+func renderCalendar(lists []*data.List, component string) []byte {
+	var buf bytes.Buffer
+	line := func(format string, args ...interface{}) {
+		writeICalLine(&buf, fmt.Sprintf(format, args...))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//todo.joelical.net//Todo API %s//EN", version)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Todo")
+	for _, list := range lists {
+		due := list.DueDate.UTC().Format(icalTimeLayout)
+		if component == "vevent" {
+			line("BEGIN:VEVENT")
+		} else {
+			line("BEGIN:VTODO")
+		}
+		line("UID:list-%d@todo.joelical.net", list.ID)
+		line("DTSTAMP:%s", list.CreatedAt.UTC().Format(icalTimeLayout))
+		line("CREATED:%s", list.CreatedAt.UTC().Format(icalTimeLayout))
+		line("SEQUENCE:%d", list.Version)
+		line("SUMMARY:%s", icalEscape(list.Task))
+		line("DESCRIPTION:%s", icalEscape(fmt.Sprintf("List: %s\nStatus: %s", list.Name, list.Status)))
+		if len(list.Labels) > 0 {
+			labels := make([]string, len(list.Labels))
+			for i, label := range list.Labels {
+				labels[i] = icalEscape(label)
+			}
+			line("CATEGORIES:%s", strings.Join(labels, ","))
+		}
+		//an RRULE repeats from DTSTART, so a repeating VTODO needs one as well as its DUE
+		if component == "vevent" || list.Recurrence != "" {
+			line("DTSTART:%s", due)
+		}
+		if list.Recurrence != "" {
+			line("RRULE:%s", list.Recurrence)
+		}
+		if component == "vevent" {
+			line("DURATION:PT30M")
+			line("END:VEVENT")
+			continue
+		}
+		line("DUE:%s", due)
+		if list.Done() {
+			line("STATUS:COMPLETED")
+		} else {
+			line("STATUS:NEEDS-ACTION")
+		}
+		line("END:VTODO")
+	}
+	line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// icalEscaper escapes a TEXT value as described in RFC 5545 section 3.3.11
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// icalEscape() makes user text safe to use as a TEXT property value
+func icalEscape(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+// writeICalLine() writes a content line ending in CRLF, folding it so no line is
+// longer than 75 octets. a fold never splits a multi-byte character
+func writeICalLine(buf *bytes.Buffer, s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		buf.WriteString(s[:cut])
+		buf.WriteString("\r\n ")
+		s = s[cut:]
+		//the leading space of a continuation line counts towards its length
+		limit = 74
+	}
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+}
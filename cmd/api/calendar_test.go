@@ -0,0 +1,100 @@
+//Filename: cmd/api/calendar_test.go
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestRenderCalendar(t *testing.T) {
+	due := time.Date(2030, 1, 2, 9, 30, 0, 0, time.UTC)
+	created := time.Date(2029, 12, 1, 8, 0, 0, 0, time.UTC)
+	once := &data.List{ID: 1, CreatedAt: created, Name: "home", Task: "buy milk, eggs", Status: "todo", DueDate: &due, Version: 3}
+	weekly := &data.List{ID: 2, CreatedAt: created, Name: "work", Task: "report", Status: "done", DueDate: &due, Recurrence: "FREQ=WEEKLY", Labels: []string{"a;b"}, Version: 1}
+	tests := []struct {
+		name      string
+		lists     []*data.List
+		component string
+		want      []string
+		unwanted  []string
+	}{
+		{"vtodo", []*data.List{once}, "vtodo", []string{
+			"BEGIN:VTODO\r\nUID:list-1@todo.joelical.net\r\n",
+			"SUMMARY:buy milk\\, eggs\r\n",
+			"DUE:20300102T093000Z\r\n",
+			"STATUS:NEEDS-ACTION\r\n",
+			"SEQUENCE:3\r\n",
+		}, []string{"DTSTART", "RRULE", "VEVENT"}},
+		{"repeating vtodo", []*data.List{weekly}, "vtodo", []string{
+			"DTSTART:20300102T093000Z\r\nRRULE:FREQ=WEEKLY\r\nDUE:20300102T093000Z\r\n",
+			"STATUS:COMPLETED\r\n",
+			"CATEGORIES:a\\;b\r\n",
+		}, nil},
+		{"vevent", []*data.List{once, weekly}, "vevent", []string{
+			"BEGIN:VEVENT\r\nUID:list-1@todo.joelical.net\r\n",
+			"DTSTART:20300102T093000Z\r\nDURATION:PT30M\r\nEND:VEVENT\r\n",
+			"DTSTART:20300102T093000Z\r\nRRULE:FREQ=WEEKLY\r\nDURATION:PT30M\r\n",
+		}, []string{"VTODO", "DUE:"}},
+		{"empty", nil, "vtodo", []string{"BEGIN:VCALENDAR\r\n", "END:VCALENDAR\r\n"}, []string{"BEGIN:VTODO"}},
+	}
+	for _, tt := range tests {
+		body := string(renderCalendar(tt.lists, tt.component))
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: got %q; want it to contain %q", tt.name, body, want)
+			}
+		}
+		for _, unwanted := range tt.unwanted {
+			if strings.Contains(body, unwanted) {
+				t.Errorf("%s: got %q; want no %q", tt.name, body, unwanted)
+			}
+		}
+		//the same lists always give the same feed, which the ETag depends on
+		if again := string(renderCalendar(tt.lists, tt.component)); again != body {
+			t.Errorf("%s: rendering twice gave different feeds", tt.name)
+		}
+	}
+}
+
+func TestWriteICalLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"short", "SUMMARY:milk", "SUMMARY:milk\r\n"},
+		{"exactly 75", strings.Repeat("a", 75), strings.Repeat("a", 75) + "\r\n"},
+		{"folded", strings.Repeat("a", 80), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 5) + "\r\n"},
+		{"folded twice", strings.Repeat("a", 150), strings.Repeat("a", 75) + "\r\n " + strings.Repeat("a", 74) + "\r\n " + "a\r\n"},
+		{"multi-byte", strings.Repeat("a", 74) + "é", strings.Repeat("a", 74) + "\r\n é\r\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeICalLine(&buf, tt.in)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestICalEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"milk", "milk"},
+		{"a,b;c", `a\,b\;c`},
+		{`back\slash`, `back\\slash`},
+		{"two\r\nlines\nhere", `two\nlines\nhere`},
+	}
+	for _, tt := range tests {
+		if got := icalEscape(tt.in); got != tt.want {
+			t.Errorf("%q: got %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+//Filename: cmd/api/collab.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+const (
+	collabWriteWait  = 10 * time.Second
+	collabPongWait   = 60 * time.Second
+	collabPingPeriod = 50 * time.Second
+	collabMaxMessage = 64 * 1024
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// collabMessage is every message the server sends on a collaboration channel
+type collabMessage struct {
+	Type    string      `json:"type"`
+	List    *data.List  `json:"list,omitempty"`
+	Viewers []string    `json:"viewers,omitempty"`
+	Error   interface{} `json:"error,omitempty"`
+}
+
+// collabRequest is every message a client sends. "patch" is the only type so far
+type collabRequest struct {
+	Type    string `json:"type"`
+	Version int32  `json:"version"`
+	listPatch
+}
+
+// a collabClient is one websocket connection viewing a list. done is closed when the reader stops
+// and stopped when the writer does, so neither side can block waiting on the other
+type collabClient struct {
+	name    string
+	send    chan collabMessage
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// push() queues a message for the client unless the connection has gone away
+func (c *collabClient) push(msg collabMessage) {
+	select {
+	case c.send <- msg:
+	case <-c.done:
+	case <-c.stopped:
+	}
+}
+
+// presenceRegistry keeps track of who is viewing each list on this server
+type presenceRegistry struct {
+	mu    sync.Mutex
+	rooms map[int64]map[*collabClient]struct{}
+}
+
+func newPresenceRegistry() *presenceRegistry {
+	return &presenceRegistry{
+		rooms: make(map[int64]map[*collabClient]struct{}),
+	}
+}
+
+// join() adds the client to the list's room and tells everyone in it
+func (p *presenceRegistry) join(listID int64, client *collabClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rooms[listID] == nil {
+		p.rooms[listID] = make(map[*collabClient]struct{})
+	}
+	p.rooms[listID][client] = struct{}{}
+	p.announce(listID)
+}
+
+// leave() removes the client from the list's room and tells whoever is left
+func (p *presenceRegistry) leave(listID int64, client *collabClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.rooms[listID], client)
+	if len(p.rooms[listID]) == 0 {
+		delete(p.rooms, listID)
+		return
+	}
+	p.announce(listID)
+}
+
+// announce() sends the current viewers to everyone in the room. the caller must hold the lock.
+// presence is best effort so a client with a full buffer misses the update
+func (p *presenceRegistry) announce(listID int64) {
+	viewers := []string{}
+	for client := range p.rooms[listID] {
+		viewers = append(viewers, client.name)
+	}
+	sort.Strings(viewers)
+	for client := range p.rooms[listID] {
+		select {
+		case client.send <- collabMessage{Type: "presence", Viewers: viewers}:
+		default:
+		}
+	}
+}
+
+// collabListHandler for the "GET /v1/list/:id/ws" endpoint
+// clients receive every change to the list and the names of the other viewers,
+// and can send patches which are saved the same way as PATCH /v1/list/:id
+func (app *application) collabListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	list, err := app.models.List.Get(workspace.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	//viewers are shown by their member name, callers without credentials only when -auth-required=false
+	c := app.contextGetCaller(r)
+	name := "anonymous"
+	if !c.anonymous() {
+		name = c.member.Name
+	}
+	//Upgrade() has already written an error response if it fails
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+	defer conn.Close()
+
+	client := &collabClient{
+		name:    name,
+		send:    make(chan collabMessage, 16),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	//subscribe before sending the snapshot so no change slips in between
+	events := app.events.subscribe()
+	defer app.events.unsubscribe(events)
+	client.send <- collabMessage{Type: "snapshot", List: list}
+	app.presence.join(id, client)
+	defer app.presence.leave(id, client)
+
+	go app.collabWriter(conn, client, events, id)
+	app.collabReader(r, conn, client, workspace.ID, id)
+	close(client.done)
+}
+
+// collabReader() handles messages from the client until the connection closes.
+// r is the upgrade request, which carries the caller every patch is checked against
+func (app *application) collabReader(r *http.Request, conn *websocket.Conn, client *collabClient, workspaceID, listID int64) {
+	c := app.contextGetCaller(r)
+	conn.SetReadLimit(collabMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				app.logger.Println(err)
+			}
+			return
+		}
+		var req collabRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			client.push(collabMessage{Type: "error", Error: "message contains badly-formed JSON"})
+			continue
+		}
+		switch req.Type {
+		case "patch":
+			//the upgrade is a GET, which viewers and read-only keys can make, so a patch is checked as a write
+			if !c.can(r, data.RoleMember) || !c.hasScope(data.ScopeWrite) {
+				client.push(collabMessage{Type: "error", Error: "you are not allowed to do this"})
+				continue
+			}
+			client.push(app.applyCollabPatch(workspaceID, listID, req))
+		default:
+			client.push(collabMessage{Type: "error", Error: "unknown message type"})
+		}
+	}
+}
+
+// collabWriter() is the only goroutine that writes to the connection. it closes the
+// connection when it stops, which in turn stops the reader
+func (app *application) collabWriter(conn *websocket.Conn, client *collabClient, events chan *data.ListEvent, listID int64) {
+	ticker := time.NewTicker(collabPingPeriod)
+	defer func() {
+		ticker.Stop()
+		close(client.stopped)
+		conn.Close()
+	}()
+	write := func(msg collabMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+		return conn.WriteJSON(msg)
+	}
+	closeWith := func(code int, text string) {
+		conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+	}
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-app.quit:
+			closeWith(websocket.CloseGoingAway, "server shutting down, please reconnect")
+			return
+		case msg := <-client.send:
+			if err := write(msg); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "client fell behind, please reconnect")
+				return
+			}
+			if event.ListID != listID {
+				continue
+			}
+			if err := write(collabMessage{Type: event.Event, List: event.List}); err != nil {
+				return
+			}
+			if event.Event == data.EventListDeleted {
+				closeWith(websocket.CloseNormalClosure, "list deleted")
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// applyCollabPatch() saves a patch sent over a collaboration channel. the patch must name the
+// version it was made against, and goes through the same validation and versioned update as the http handler
+func (app *application) applyCollabPatch(workspaceID, listID int64, req collabRequest) collabMessage {
+	list, err := app.models.List.Get(workspaceID, listID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return collabMessage{Type: "error", Error: "the list no longer exists"}
+		default:
+			app.logger.Println(err)
+			return collabMessage{Type: "error", Error: "the server encounter a problem and could not process your request"}
+		}
+	}
+	v := validator.New()
+	v.Check(req.Version > 0, "version", "must be provided")
+	if !v.Valid() {
+		return collabMessage{Type: "error", Error: v.Errors}
+	}
+	//the patch was made against an older version
+	if list.Version != req.Version {
+		return collabMessage{Type: "conflict", List: list, Error: "unable to update the record due to an edit conflict, please try again"}
+	}
+	previousStatus := list.Status
+	req.apply(list)
+	if data.ValidateList(v, list); !v.Valid() {
+		return collabMessage{Type: "error", Error: v.Errors}
+	}
+	_, err = app.saveListUpdate(list, previousStatus)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return collabMessage{Type: "conflict", Error: "unable to update the record due to an edit conflict, please try again"}
+		case errors.Is(err, data.ErrQuotaExceeded):
+			return collabMessage{Type: "error", Error: "the workspace has reached its limit on the number of lists"}
+		case errors.Is(err, data.ErrInvalidAssignee):
+			return collabMessage{Type: "error", Error: map[string]string{"assignee_ids": invalidAssigneeMessage}}
+		case errors.Is(err, data.ErrInvalidParent):
+			return collabMessage{Type: "error", Error: map[string]string{"parent_id": invalidParentMessage}}
+		case errors.Is(err, data.ErrWIPLimitExceeded):
+			return collabMessage{Type: "error", Error: map[string]string{"status": wipLimitMessage}}
+		default:
+			app.logger.Println(err)
+			return collabMessage{Type: "error", Error: "the server encounter a problem and could not process your request"}
+		}
+	}
+	return collabMessage{Type: "ack", List: list}
+}
@@ -0,0 +1,85 @@
+//Filename: cmd/api/collab_test.go
+
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"todo.joelical.net/internal/data"
+)
+
+func TestCollabPushAfterWriterStops(t *testing.T) {
+	client := &collabClient{
+		send:    make(chan collabMessage, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	client.push(collabMessage{Type: "ack"})
+	//the buffer is full and nothing is reading it any more
+	close(client.stopped)
+
+	pushed := make(chan struct{})
+	go func() {
+		client.push(collabMessage{Type: "ack"})
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked after the writer stopped")
+	}
+}
+
+func TestCollabPatchPermissions(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	member := func(role string, scopes ...string) *caller {
+		return &caller{member: &data.Member{ID: 1, WorkspaceID: 1, Name: "sam", Role: role}, scopes: scopes}
+	}
+	tests := []struct {
+		name    string
+		caller  *caller
+		message string
+		want    string
+	}{
+		{"viewer", member(data.RoleViewer, data.ScopeWrite), `{"type":"patch","version":1,"task":"x"}`, "you are not allowed to do this"},
+		{"read only key", member(data.RoleAdmin, data.ScopeRead), `{"type":"patch","version":1,"task":"x"}`, "you are not allowed to do this"},
+		{"member", member(data.RoleMember, data.ScopeWrite), `{"type":"cursor"}`, "unknown message type"},
+	}
+	for _, tt := range tests {
+		client := &collabClient{
+			send:    make(chan collabMessage, 1),
+			done:    make(chan struct{}),
+			stopped: make(chan struct{}),
+		}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			app.collabReader(app.contextSetCaller(r, tt.caller), conn, client, 1, 1)
+		}))
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(tt.message))
+		select {
+		case msg := <-client.send:
+			if msg.Type != "error" || msg.Error != tt.want {
+				t.Errorf("%s: got %+v; want error %q", tt.name, msg, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: got no reply", tt.name)
+		}
+		conn.Close()
+		ts.Close()
+	}
+}
@@ -0,0 +1,259 @@
+//Filename: cmd/api/comments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// createCommentHandler for the "POST /v1/list/:id/comments" endpoint
+// a member comments under their own name. without credentials the author names themselves,
+// the same as on the collaboration channel. mentioned members are emailed
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	listID := list.ID
+	var input struct {
+		Author string `json:"author"`
+		Body   string `json:"body"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	comment := &data.Comment{
+		ListID:   listID,
+		Author:   input.Author,
+		Body:     input.Body,
+		Mentions: data.ParseMentions(input.Body),
+	}
+	if c := app.contextGetCaller(r); !c.anonymous() {
+		comment.Author = c.member.Name
+		comment.AuthorID = &c.member.ID
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Insert(comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.publishCommentEvent(data.EventCommentCreated, list.WorkspaceID, comment, comment.Mentions)
+	app.notifyMentions(list, comment, comment.Mentions)
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d/comments/%d", app.contextGetWorkspace(r).ID, listID, comment.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentsHandler for the "GET /v1/list/:id/comments" endpoint
+// comments come oldest first. next_cursor is passed back as ?cursor= to get the following page,
+// it is empty on the last page. new comments never shift the pages already read
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	listID := list.ID
+	v := validator.New()
+	qs := r.URL.Query()
+	limit := app.readInt(qs, "limit", 20, v)
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maxinum of 100")
+	after := int64(0)
+	if cursor := qs.Get("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		v.Check(err == nil && id > 0, "cursor", "must be a cursor returned by a previous page")
+		after = id
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	comments, more, err := app.models.Comments.GetPage(listID, after, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	nextCursor := ""
+	if more {
+		nextCursor = strconv.FormatInt(comments[len(comments)-1].ID, 10)
+	}
+	env := envelope{"comments": comments, "metadata": envelope{"next_cursor": nextCursor}}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readComment() loads the ":comment_id" comment on the ":id" list of the request's workspace.
+// ok is false once an error response has been sent
+func (app *application) readComment(w http.ResponseWriter, r *http.Request) (*data.List, *data.Comment, bool) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	commentID, err := app.readNamedIDParam(r, "comment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+	comment, err := app.models.Comments.Get(list.ID, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+	return list, comment, true
+}
+
+// isCommentAuthor() reports whether the caller wrote the comment. a comment written without
+// credentials can only be changed without them, in the open mode where nobody has to sign in
+func (app *application) isCommentAuthor(r *http.Request, comment *data.Comment) bool {
+	c := app.contextGetCaller(r)
+	if c.anonymous() {
+		return comment.AuthorID == nil
+	}
+	return comment.AuthorID != nil && *comment.AuthorID == c.member.ID
+}
+
+// showCommentHandler for the "GET /v1/list/:id/comments/:comment_id" endpoint
+func (app *application) showCommentHandler(w http.ResponseWriter, r *http.Request) {
+	_, comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCommentHandler for the "PATCH /v1/list/:id/comments/:comment_id" endpoint
+// only the author can change a comment, and only its body. anyone mentioned for the first time
+// is announced to webhooks and emailed
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	list, comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+	if !app.isCommentAuthor(r, comment) {
+		app.notCommentAuthorResponse(w, r)
+		return
+	}
+	var input struct {
+		Body *string `json:"body"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	previous := comment.Mentions
+	if input.Body != nil {
+		comment.Body = *input.Body
+		comment.Mentions = data.ParseMentions(comment.Body)
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	mentioned := []string{}
+	for _, name := range comment.Mentions {
+		if !validator.In(name, previous...) {
+			mentioned = append(mentioned, name)
+		}
+	}
+	app.publishCommentEvent(data.EventCommentUpdated, list.WorkspaceID, comment, mentioned)
+	app.notifyMentions(list, comment, mentioned)
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler for the "DELETE /v1/list/:id/comments/:comment_id" endpoint
+// only the author can delete a comment
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	list, comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+	if !app.isCommentAuthor(r, comment) {
+		app.notCommentAuthorResponse(w, r)
+		return
+	}
+	err := app.models.Comments.Delete(list.ID, comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// notifyMentions() emails the members of the list's workspace named in mentioned, in the background.
+// names that aren't members, members without an email and the author mentioning themselves are skipped
+func (app *application) notifyMentions(list *data.List, comment *data.Comment, mentioned []string) {
+	if len(mentioned) == 0 {
+		return
+	}
+	app.background(func() {
+		for _, name := range mentioned {
+			member, err := app.models.Members.GetByName(list.WorkspaceID, name)
+			if err != nil {
+				if !errors.Is(err, data.ErrRecordNotFound) {
+					app.logger.Println(err)
+				}
+				continue
+			}
+			if member.Email == "" || (comment.AuthorID != nil && *comment.AuthorID == member.ID) {
+				continue
+			}
+			err = app.mailer.Send(member.Email, "mention.tmpl", map[string]interface{}{
+				"Member":  member,
+				"List":    list,
+				"Comment": comment,
+			})
+			if err != nil {
+				app.logger.Println(err)
+			}
+		}
+	})
+}
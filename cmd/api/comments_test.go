@@ -0,0 +1,158 @@
+//Filename: cmd/api/comments_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestIsCommentAuthor(t *testing.T) {
+	app := &application{}
+	member := func(id int64) *caller {
+		return &caller{member: &data.Member{ID: id, WorkspaceID: 1, Name: "sam", Role: data.RoleOwner}, scopes: []string{data.ScopeWrite}}
+	}
+	sams, anonymous := int64(7), (*int64)(nil)
+	tests := []struct {
+		name     string
+		caller   *caller
+		authorID *int64
+		want     bool
+	}{
+		{"author", member(7), &sams, true},
+		{"someone else, even an owner", member(8), &sams, false},
+		{"member on an anonymous comment", member(7), anonymous, false},
+		{"anonymous on a member's comment", anonymousCaller, &sams, false},
+		{"anonymous on an anonymous comment", anonymousCaller, anonymous, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPatch, "/v1/list/1/comments/1", nil)
+		r = app.contextSetCaller(r, tt.caller)
+		if got := app.isCommentAuthor(r, &data.Comment{AuthorID: tt.authorID}); got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommentHandlers(t *testing.T) {
+	app := newTestApp(t)
+	//the mention emails go out in the background, they have to finish before the database goes away
+	defer app.wg.Wait()
+	sam := &data.Member{WorkspaceID: data.DefaultWorkspaceID, Name: "sam", Role: data.RoleMember}
+	alex := &data.Member{WorkspaceID: data.DefaultWorkspaceID, Name: "alex", Role: data.RoleOwner}
+	for _, member := range []*data.Member{sam, alex} {
+		if err := app.models.Members.Insert(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asSam := &caller{member: sam, scopes: []string{data.ScopeWrite}}
+	asAlex := &caller{member: alex, scopes: []string{data.ScopeWrite}}
+	list := &data.List{WorkspaceID: data.DefaultWorkspaceID, Name: "home", Task: "milk", Status: "todo"}
+	if err := app.models.List.Insert(list); err != nil {
+		t.Fatal(err)
+	}
+	listPath := fmt.Sprintf("/v1/list/%d/comments", list.ID)
+	const commentPattern = "/v1/list/:id/comments/:comment_id"
+
+	//members always comment under their own name
+	w := serveInWorkspace(t, app, asSam, "/v1/list/:id/comments", app.createCommentHandler, http.MethodPost, listPath, map[string]string{"author": "alex", "body": "hi @alex"})
+	var created struct {
+		Comment data.Comment `json:"comment"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("got status %d, %v; want 201", w.Code, err)
+	}
+	comment := created.Comment
+	if comment.Author != "sam" || comment.AuthorID == nil || *comment.AuthorID != sam.ID || fmt.Sprint(comment.Mentions) != "[alex]" {
+		t.Errorf("got comment %+v; want sam's mentioning alex", comment)
+	}
+	commentPath := fmt.Sprintf("%s/%d", listPath, comment.ID)
+
+	tests := []struct {
+		name    string
+		caller  *caller
+		method  string
+		target  string
+		body    interface{}
+		want    int
+		handler http.HandlerFunc
+	}{
+		{"anonymous without a name", anonymousCaller, http.MethodPost, listPath, map[string]string{"body": "hello"}, http.StatusUnprocessableEntity, app.createCommentHandler},
+		{"anonymous with a name", anonymousCaller, http.MethodPost, listPath, map[string]string{"author": "kim", "body": "hello"}, http.StatusCreated, app.createCommentHandler},
+		{"no body", asSam, http.MethodPost, listPath, map[string]string{"body": " "}, http.StatusUnprocessableEntity, app.createCommentHandler},
+		{"missing list", asSam, http.MethodPost, "/v1/list/999999/comments", map[string]string{"body": "hello"}, http.StatusNotFound, app.createCommentHandler},
+		{"first page", asSam, http.MethodGet, listPath + "?limit=1", nil, http.StatusOK, app.listCommentsHandler},
+		{"zero limit", asSam, http.MethodGet, listPath + "?limit=0", nil, http.StatusUnprocessableEntity, app.listCommentsHandler},
+		{"bad cursor", asSam, http.MethodGet, listPath + "?cursor=abc", nil, http.StatusUnprocessableEntity, app.listCommentsHandler},
+		//only the author changes a comment, an owner can't either
+		{"edit by someone else", asAlex, http.MethodPatch, commentPath, map[string]string{"body": "mine now"}, http.StatusForbidden, app.updateCommentHandler},
+		{"edit by the author", asSam, http.MethodPatch, commentPath, map[string]string{"body": "hi @kim"}, http.StatusOK, app.updateCommentHandler},
+		{"edit to nothing", asSam, http.MethodPatch, commentPath, map[string]string{"body": ""}, http.StatusUnprocessableEntity, app.updateCommentHandler},
+		{"delete by someone else", asAlex, http.MethodDelete, commentPath, nil, http.StatusForbidden, app.deleteCommentHandler},
+		{"delete by the author", asSam, http.MethodDelete, commentPath, nil, http.StatusOK, app.deleteCommentHandler},
+		{"show deleted", asSam, http.MethodGet, commentPath, nil, http.StatusNotFound, app.showCommentHandler},
+	}
+	for _, tt := range tests {
+		pattern := "/v1/list/:id/comments"
+		if tt.target == commentPath {
+			pattern = commentPattern
+		}
+		w := serveInWorkspace(t, app, tt.caller, pattern, tt.handler, tt.method, tt.target, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d; want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+
+	//sam's comment is gone and the anonymous one is left
+	if got, _, err := app.models.Comments.GetPage(list.ID, 0, 10); err != nil || len(got) != 1 || got[0].Author != "kim" {
+		t.Errorf("got comments %+v, %v; want only kim's", got, err)
+	}
+}
+
+func TestCommentPages(t *testing.T) {
+	app := newTestApp(t)
+	list := &data.List{WorkspaceID: data.DefaultWorkspaceID, Name: "home", Task: "milk", Status: "todo"}
+	if err := app.models.List.Insert(list); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"one", "two", "three"} {
+		if err := app.models.Comments.Insert(&data.Comment{ListID: list.ID, Author: "kim", Body: body, Mentions: []string{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type page struct {
+		Comments []*data.Comment `json:"comments"`
+		Metadata struct {
+			NextCursor string `json:"next_cursor"`
+		} `json:"metadata"`
+	}
+	//following next_cursor reads every comment once, oldest first
+	bodies := []string{}
+	cursor := ""
+	for pages := 0; pages == 0 || cursor != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("next_cursor never ran out")
+		}
+		target := fmt.Sprintf("/v1/list/%d/comments?limit=2", list.ID)
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		w := serveInWorkspace(t, app, anonymousCaller, "/v1/list/:id/comments", app.listCommentsHandler, http.MethodGet, target, nil)
+		var p page
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		for _, comment := range p.Comments {
+			bodies = append(bodies, comment.Body)
+		}
+		cursor = p.Metadata.NextCursor
+	}
+	if fmt.Sprint(bodies) != "[one two three]" {
+		t.Errorf("got comments %v; want [one two three]", bodies)
+	}
+}
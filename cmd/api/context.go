@@ -0,0 +1,102 @@
+//Filename: cmd/api/context.go
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"todo.joelical.net/internal/data"
+)
+
+// a custom type for our context keys so they can't collide with keys from other packages
+type contextKey string
+
+const (
+	workspaceContextKey = contextKey("workspace")
+	callerContextKey    = contextKey("caller")
+	// the server's ConnContext hook stores the request's connection under this key
+	connContextKey = contextKey("conn")
+)
+
+// contextSetWorkspace() returns a copy of the request with the workspace added to its context
+func (app *application) contextSetWorkspace(r *http.Request, workspace *data.Workspace) *http.Request {
+	ctx := context.WithValue(r.Context(), workspaceContextKey, workspace)
+	return r.WithContext(ctx)
+}
+
+// contextGetWorkspace() returns the workspace set by the inWorkspace() middleware.
+// it is only called from handlers behind that middleware so a missing value is a bug
+func (app *application) contextGetWorkspace(r *http.Request) *data.Workspace {
+	workspace, ok := r.Context().Value(workspaceContextKey).(*data.Workspace)
+	if !ok {
+		panic("missing workspace value in request context")
+	}
+	return workspace
+}
+
+// a caller is the member a request was authenticated as and the scopes their credential allows.
+// requests without credentials have no member and are only let through when -auth-required=false,
+// which trusts them with the default workspace
+type caller struct {
+	member *data.Member
+	scopes []string
+	// the caller sent a signed token
+	token bool
+}
+
+var anonymousCaller = &caller{}
+
+// anonymous() reports whether the request came without credentials
+func (c *caller) anonymous() bool {
+	return c.member == nil
+}
+
+// allows() reports whether the caller's credential allows the request's method.
+// anonymous callers can do anything, the authenticate() middleware has already decided to let them in
+func (c *caller) allows(r *http.Request) bool {
+	if c.anonymous() {
+		return true
+	}
+	scope := data.ScopeWrite
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		scope = data.ScopeRead
+	}
+	return c.hasScope(scope)
+}
+
+// hasScope() reports whether the caller's credential carries the scope. write takes in read
+func (c *caller) hasScope(scope string) bool {
+	if c.anonymous() {
+		return true
+	}
+	for _, s := range c.scopes {
+		if s == scope || s == data.ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// can() reports whether the caller's role is at least role and their credential allows the request's method
+func (c *caller) can(r *http.Request, role string) bool {
+	if c.anonymous() {
+		return true
+	}
+	return data.RoleAtLeast(c.member.Role, role) && c.allows(r)
+}
+
+// contextSetCaller() returns a copy of the request with the caller added to its context
+func (app *application) contextSetCaller(r *http.Request, c *caller) *http.Request {
+	ctx := context.WithValue(r.Context(), callerContextKey, c)
+	return r.WithContext(ctx)
+}
+
+// contextGetCaller() returns the caller set by the authenticate() middleware, or an anonymous caller
+func (app *application) contextGetCaller(r *http.Request) *caller {
+	c, ok := r.Context().Value(callerContextKey).(*caller)
+	if !ok {
+		return anonymousCaller
+	}
+	return c
+}
@@ -0,0 +1,113 @@
+//Filename: cmd/api/db_test.go
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"todo.joelical.net/internal/data"
+)
+
+// newTestApp() returns an application backed by a schema of its own with every migration applied.
+// like the tests in internal/data it is skipped unless TODO_TEST_DB_DSN is set
+func newTestApp(t *testing.T) *application {
+	t.Helper()
+	dsn := os.Getenv("TODO_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TODO_TEST_DB_DSN is not set")
+	}
+	b := make([]byte, 6)
+	rand.Read(b)
+	schema := "test_" + hex.EncodeToString(b)
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	_, err = admin.Exec(`CREATE SCHEMA ` + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+	})
+
+	//lib/pq passes search_path on to the server so every connection in the pool uses the schema
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&search_path=" + schema
+		} else {
+			dsn += "?search_path=" + schema
+		}
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(string(migration))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+	}
+	return &application{logger: log.New(io.Discard, "", 0), models: data.NewModels(db)}
+}
+
+// serveInWorkspace() routes a request to the handler registered at pattern, with the default workspace
+// and caller c in its context the way inWorkspace() would leave them
+func serveInWorkspace(t *testing.T, app *application, c *caller, pattern string, handler http.HandlerFunc, method, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = bytes.NewReader(js)
+	}
+	workspace, err := app.models.Workspaces.Get(data.DefaultWorkspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httprouter.New()
+	router.HandlerFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetCaller(r, c)
+		handler(w, app.contextSetWorkspace(r, workspace))
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, target, payload))
+	return w
+}
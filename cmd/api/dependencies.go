@@ -0,0 +1,179 @@
+//Filename: cmd/api/dependencies.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// createDependencyHandler for the "POST /v1/list/:id/dependencies" endpoint
+// the list is blocked by the one named in blocked_by until that one is done
+func (app *application) createDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		BlockedBy int64 `json:"blocked_by"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.BlockedBy > 0, "blocked_by", "must be provided")
+	v.Check(input.BlockedBy != list.ID, "blocked_by", "must not be the list itself")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	dependency := &data.Dependency{ListID: list.ID, BlockedByID: input.BlockedBy}
+	err = app.models.Dependencies.Insert(list.WorkspaceID, dependency)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("blocked_by", "must be a list in the same workspace")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCycle):
+			v.AddError("blocked_by", "must not already be waiting on this list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	//reload the list so blocked reflects the new dependency
+	list, err = app.models.List.Get(list.WorkspaceID, list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d/dependencies", list.WorkspaceID, list.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"dependency": dependency, "list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listDependenciesHandler for the "GET /v1/list/:id/dependencies" endpoint
+// it returns the lists this one is directly blocked by
+func (app *application) listDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	blockers, err := app.models.Dependencies.GetBlockers(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"blocked_by": blockers}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteDependencyHandler for the "DELETE /v1/list/:id/dependencies/:blocked_by_id" endpoint
+func (app *application) deleteDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	blockedByID, err := app.readNamedIDParam(r, "blocked_by_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Dependencies.Delete(list.ID, blockedByID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "dependency successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// graphHandler for the "GET /v1/list/:id/graph" endpoint
+// it returns every list upstream and downstream of this one, as JSON or with ?format=dot for Graphviz
+func (app *application) graphHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	v := validator.New()
+	format := app.readString(r.URL.Query(), "format", "json")
+	v.Check(validator.In(format, "json", "dot"), "format", "must be one of json or dot")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	graph, err := app.models.Dependencies.GetGraph(list.WorkspaceID, list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if format == "json" {
+		err = app.writeJSON(w, http.StatusOK, envelope{"graph": graph}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+	_, err = w.Write([]byte(formatDOT(graph, list.ID)))
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// formatDOT() writes the graph in the Graphviz DOT language. finished lists are green, blocked ones red,
+// and the list the graph was asked for has a bold border
+func formatDOT(graph *data.Graph, focus int64) string {
+	var b strings.Builder
+	b.WriteString("digraph dependencies {\n\trankdir=LR;\n\tnode [shape=box, style=filled, fillcolor=white];\n")
+	for _, node := range graph.Nodes {
+		attrs := []string{"label=" + dotQuote(fmt.Sprintf("#%d %s\n%s", node.ID, node.Name, node.Status))}
+		switch {
+		case node.Done():
+			attrs = append(attrs, "fillcolor=palegreen")
+		case node.Blocked:
+			attrs = append(attrs, "fillcolor=lightpink")
+		}
+		if node.ID == focus {
+			attrs = append(attrs, "penwidth=3")
+		}
+		fmt.Fprintf(&b, "\t%d [%s];\n", node.ID, strings.Join(attrs, ", "))
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "\t%d -> %d;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuoter escapes text for a double-quoted DOT string
+var dotQuoter = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotQuoter.Replace(s) + `"`
+}
@@ -0,0 +1,29 @@
+//Filename: cmd/api/dependencies_test.go
+
+package main
+
+import (
+	"testing"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestFormatDOT(t *testing.T) {
+	graph := &data.Graph{
+		Nodes: []*data.List{
+			{ID: 1, Name: `Say "hi"`, Status: "done"},
+			{ID: 2, Name: "Line\nbreak", Status: "todo", Blocked: true},
+		},
+		Edges: []data.Edge{{From: 1, To: 2}},
+	}
+	want := "digraph dependencies {\n" +
+		"\trankdir=LR;\n" +
+		"\tnode [shape=box, style=filled, fillcolor=white];\n" +
+		"\t1 [label=\"#1 Say \\\"hi\\\"\\ndone\", fillcolor=palegreen];\n" +
+		"\t2 [label=\"#2 Line\\nbreak\\ntodo\", fillcolor=lightpink, penwidth=3];\n" +
+		"\t1 -> 2;\n" +
+		"}\n"
+	if got := formatDOT(graph, 2); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
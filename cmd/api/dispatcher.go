@@ -0,0 +1,174 @@
+//Filename: cmd/api/dispatcher.go
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+// settings for the webhook dispatcher
+const (
+	webhookPollInterval = time.Second
+	webhookBatchSize    = 10
+	webhookTimeout      = 10 * time.Second
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookMaxFailures  = 5
+)
+
+// publishListEvent() queues a webhook delivery for a change to a list, for the webhooks of the list's workspace.
+// a failure here should not fail the request that changed the list so it is only logged
+func (app *application) publishListEvent(event string, list *data.List) {
+	payload, err := json.Marshal(envelope{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"list":        list,
+	})
+	if err != nil {
+		app.logger.Println(err)
+		return
+	}
+	err = app.models.Webhooks.Enqueue(list.WorkspaceID, event, payload)
+	if err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// publishCommentEvent() queues a webhook delivery for a new or edited comment. mentioned holds the
+// names the comment mentions for the first time, a chat bot receiving the webhook can notify them.
+// only the webhooks of the workspace the list is in receive it
+func (app *application) publishCommentEvent(event string, workspaceID int64, comment *data.Comment, mentioned []string) {
+	payload, err := json.Marshal(envelope{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"comment":     comment,
+		"mentioned":   mentioned,
+	})
+	if err != nil {
+		app.logger.Println(err)
+		return
+	}
+	err = app.models.Webhooks.Enqueue(workspaceID, event, payload)
+	if err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// dispatchWebhooks() runs in the background and delivers queued webhook events until the server shuts down
+func (app *application) dispatchWebhooks() {
+	client := &http.Client{Timeout: webhookTimeout}
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.quit:
+			return
+		case <-ticker.C:
+		}
+		//the lease must outlast a full batch of slow receivers
+		deliveries, err := app.models.Webhooks.ClaimDeliveries(webhookBatchSize, webhookBatchSize*webhookTimeout+time.Minute)
+		if err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		for _, delivery := range deliveries {
+			app.deliverWebhook(client, delivery)
+		}
+	}
+}
+
+// deliverWebhook() makes one attempt at sending a delivery and records the outcome
+func (app *application) deliverWebhook(client *http.Client, delivery *data.Delivery) {
+	attemptWebhook(client, delivery)
+	err := app.models.Webhooks.RecordAttempt(delivery, webhookMaxFailures)
+	if err != nil {
+		app.logger.Println(err)
+	}
+}
+
+// attemptWebhook() sends the delivery and updates its status, error and next attempt time to match the outcome.
+// a delivery that won't be tried again has no next attempt
+func attemptWebhook(client *http.Client, delivery *data.Delivery) {
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+
+	statusCode, err := sendWebhook(client, delivery)
+	delivery.LastStatusCode = int32(statusCode)
+	switch {
+	case err == nil:
+		delivery.Status = data.DeliverySucceeded
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = data.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = data.DeliveryPending
+		delivery.LastError = err.Error()
+		next := time.Now().Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+}
+
+// sendWebhook() POSTs the payload to the receiver. anything other than a 2xx response is an error
+func sendWebhook(client *http.Client, delivery *data.Delivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-webhooks/"+version)
+	req.Header.Set("X-Todo-Event", delivery.Event)
+	req.Header.Set("X-Todo-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Todo-Timestamp", timestamp)
+	req.Header.Set("X-Todo-Signature", "sha256="+signWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	//drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook() returns the hex encoded HMAC-SHA256 of "<timestamp>.<payload>".
+// including the timestamp lets receivers reject replayed deliveries
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff() doubles the wait after every failed attempt up to webhookMaxBackoff
+func webhookBackoff(attempts int32) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := int32(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,134 @@
+//Filename: cmd/api/dispatcher_test.go
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestSignWebhook(t *testing.T) {
+	//the receiver side of the documented scheme: HMAC-SHA256 of "<timestamp>.<payload>"
+	mac := hmac.New(sha256.New, []byte("0123456789abcdef"))
+	mac.Write([]byte(`1700000000.{"event":"list.created"}`))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	got := signWebhook("0123456789abcdef", "1700000000", []byte(`{"event":"list.created"}`))
+	if got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if signWebhook("another secret..", "1700000000", []byte(`{"event":"list.created"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if signWebhook("0123456789abcdef", "1700000001", []byte(`{"event":"list.created"}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{8, 1280 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %s; want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestAttemptWebhook(t *testing.T) {
+	payload := []byte(`{"event":"list.updated"}`)
+	var got *http.Request
+	var body []byte
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	delivery := &data.Delivery{
+		ID:      42,
+		Event:   data.EventListUpdated,
+		Payload: payload,
+		Status:  data.DeliveryPending,
+		URL:     ts.URL,
+		Secret:  "0123456789abcdef",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		attemptWebhook(ts.Client(), delivery)
+		if delivery.Status != data.DeliverySucceeded || delivery.Attempts != 1 {
+			t.Fatalf("got status %q after %d attempts; want succeeded after 1", delivery.Status, delivery.Attempts)
+		}
+		if delivery.LastStatusCode != http.StatusOK || delivery.LastError != "" || delivery.NextAttemptAt != nil {
+			t.Errorf("got code %d, error %q and next attempt %v", delivery.LastStatusCode, delivery.LastError, delivery.NextAttemptAt)
+		}
+		if string(body) != string(payload) {
+			t.Errorf("got body %s; want %s", body, payload)
+		}
+		if got.Header.Get("X-Todo-Event") != data.EventListUpdated || got.Header.Get("X-Todo-Delivery") != "42" {
+			t.Errorf("got event %q and delivery %q headers", got.Header.Get("X-Todo-Event"), got.Header.Get("X-Todo-Delivery"))
+		}
+		want := "sha256=" + signWebhook(delivery.Secret, got.Header.Get("X-Todo-Timestamp"), payload)
+		if got.Header.Get("X-Todo-Signature") != want {
+			t.Errorf("got signature %q; want %q", got.Header.Get("X-Todo-Signature"), want)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		delivery.Status = data.DeliveryPending
+		before := time.Now()
+		attemptWebhook(ts.Client(), delivery)
+		if delivery.Status != data.DeliveryPending || delivery.Attempts != 2 {
+			t.Fatalf("got status %q after %d attempts; want pending after 2", delivery.Status, delivery.Attempts)
+		}
+		if delivery.LastStatusCode != http.StatusServiceUnavailable || !strings.Contains(delivery.LastError, "503") {
+			t.Errorf("got code %d and error %q", delivery.LastStatusCode, delivery.LastError)
+		}
+		if delivery.NextAttemptAt == nil {
+			t.Fatal("no next attempt for a delivery that will be retried")
+		}
+		wait := delivery.NextAttemptAt.Sub(before)
+		if wait < webhookBackoff(2) || wait > webhookBackoff(2)+time.Second {
+			t.Errorf("next attempt in %s; want %s", wait, webhookBackoff(2))
+		}
+	})
+
+	t.Run("give up", func(t *testing.T) {
+		delivery.Attempts = webhookMaxAttempts - 1
+		attemptWebhook(ts.Client(), delivery)
+		if delivery.Status != data.DeliveryFailed || delivery.NextAttemptAt != nil {
+			t.Errorf("got status %q after %d attempts with next attempt %v; want failed with none", delivery.Status, delivery.Attempts, delivery.NextAttemptAt)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		delivery.Attempts = 0
+		delivery.URL = "http://127.0.0.1:1"
+		attemptWebhook(ts.Client(), delivery)
+		if delivery.Status != data.DeliveryPending || delivery.LastStatusCode != 0 || delivery.LastError == "" {
+			t.Errorf("got status %q, code %d and error %q", delivery.Status, delivery.LastStatusCode, delivery.LastError)
+		}
+	})
+}
@@ -61,3 +61,47 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	message := "unable to update the record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+// the request needs credentials and has none
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// the credentials sent with the request are wrong or have been revoked
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// the caller isn't allowed to make the change
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you are not allowed to do this"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// the workspace has no room for more lists
+func (app *application) quotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the workspace has reached its limit on the number of lists"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// the workspace has no room for more attachments
+func (app *application) storageQuotaExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the workspace has reached its limit on the size of attachments"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// the person already has a timer running in the workspace
+func (app *application) timerRunningResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a timer is already running for this user, stop it before starting another"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// someone other than the author tried to change a comment
+func (app *application) notCommentAuthorResponse(w http.ResponseWriter, r *http.Request) {
+	message := "only the author of this comment can change it"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
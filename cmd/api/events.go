@@ -0,0 +1,115 @@
+//Filename: cmd/api/events.go
+
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/data"
+)
+
+// listEventHub fans list events out to every subscriber in this process
+type listEventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *data.ListEvent]struct{}
+}
+
+func newListEventHub() *listEventHub {
+	return &listEventHub{
+		subscribers: make(map[chan *data.ListEvent]struct{}),
+	}
+}
+
+// subscribe() returns a channel that receives every event broadcast from now on
+func (h *listEventHub) subscribe() chan *data.ListEvent {
+	ch := make(chan *data.ListEvent, 64)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe() stops delivering events to the channel and closes it
+func (h *listEventHub) unsubscribe(ch chan *data.ListEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// broadcast() never blocks. a subscriber whose buffer is full is dropped and its channel closed,
+// clients are expected to reconnect and resume from the last event they saw
+func (h *listEventHub) broadcast(event *data.ListEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// reset() drops every subscriber. it is used when events may have been missed,
+// clients reconnect and resume from storage the same way as when they fall behind
+func (h *listEventHub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// listenForListEvents() runs in the background. it waits for the lists trigger to NOTIFY and
+// broadcasts the new events to the hub, so changes made through any replica reach every client.
+// ids only commit in order within a workspace so each announced event is read by its id,
+// and notifications arrive in commit order which keeps every workspace's events in order
+func (app *application) listenForListEvents() {
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.Println(err)
+		}
+	})
+	err := listener.Listen(data.ListEventsChannel)
+	if err != nil {
+		app.logger.Println(err)
+		listener.Close()
+		return
+	}
+	defer listener.Close()
+
+	for {
+		select {
+		case <-app.quit:
+			return
+		case n := <-listener.Notify:
+			//a nil notification means the connection was re-established and we may have missed some
+			if n == nil {
+				app.events.reset()
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				app.logger.Println(err)
+				continue
+			}
+			event, err := app.models.Events.Get(id)
+			if err != nil {
+				app.logger.Println(err)
+				app.events.reset()
+				continue
+			}
+			app.events.broadcast(event)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+//Filename: cmd/api/export.go
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// the content type of each export format
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"json": "application/json",
+	"md":   "text/markdown; charset=utf-8",
+}
+
+// exportListHandler for the "GET /v1/list/export" endpoint
+// it takes the same filters as GET /v1/list but returns every matching list rather than a page
+func (app *application) exportListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string
+		Status   string
+		Format   string
+		Assignee data.Assignee
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Name = app.readString(qs, "name", "")
+	input.Status = app.readString(qs, "status", "")
+	input.Format = app.readString(qs, "format", "csv")
+	input.Assignee = app.readAssignee(r, qs, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "name", "status", "position", "priority", "-id", "-name", "-status", "-position", "-priority"}
+	//there is no paging so only the sort is checked
+	v.Check(validator.In(input.Filters.Sort, input.Filters.SortList...), "sort", "invalid sort value")
+	v.Check(validator.In(input.Format, "csv", "json", "md"), "format", "must be one of csv, json or md")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	filename := fmt.Sprintf("lists-%s.%s", time.Now().UTC().Format("20060102"), input.Format)
+	w.Header().Set("Content-Type", exportContentTypes[input.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	workspace := app.contextGetWorkspace(r)
+	app.writeExport(w, r, input.Format, func(fn func(*data.List) error) error {
+		return app.models.List.Export(workspace.ID, input.Name, input.Status, input.Assignee, input.Filters, fn)
+	})
+}
+
+// exportSource calls fn once for each list going into an export
+type exportSource func(fn func(*data.List) error) error
+
+// writeExport() renders the lists from each in the given format
+// rows are held back until the buffer fills so a failure early on can still be answered with a 500
+func (app *application) writeExport(w http.ResponseWriter, r *http.Request, format string, each exportSource) {
+	ew := &exportWriter{w: w}
+	bw := bufio.NewWriterSize(ew, 64*1024)
+	var err error
+	switch format {
+	case "csv":
+		err = exportCSV(bw, each)
+	case "json":
+		err = exportJSON(bw, each)
+	case "md":
+		err = exportMarkdown(bw, each)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		if !ew.started {
+			w.Header().Del("Content-Disposition")
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		//the status line has already gone out, so cut the connection rather than
+		//let the client take a truncated file for a finished one
+		app.logError(r, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportWriter notes whether any of the export has reached the client yet
+type exportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	ew.started = true
+	return ew.w.Write(p)
+}
+
+// exportCSV() writes a header row then one row per list
+func exportCSV(w io.Writer, each exportSource) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"id", "created_at", "name", "task", "status", "due_date", "labels", "recurrence", "version"})
+	if err != nil {
+		return err
+	}
+	err = each(func(list *data.List) error {
+		return cw.Write([]string{
+			strconv.FormatInt(list.ID, 10),
+			list.CreatedAt.Format(time.RFC3339),
+			csvCell(list.Name),
+			csvCell(list.Task),
+			csvCell(list.Status),
+			formatDueDate(list.DueDate),
+			csvCell(strings.Join(list.Labels, ";")),
+			csvCell(list.Recurrence),
+			strconv.FormatInt(int64(list.Version), 10),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell() prefixes a value with ' when a spreadsheet would otherwise read it as a formula
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// formatDueDate() returns the due date as RFC 3339 or an empty string when there is none
+func formatDueDate(due *time.Time) string {
+	if due == nil {
+		return ""
+	}
+	return due.Format(time.RFC3339)
+}
+
+// exportJSON() writes a json array, one list at a time
+func exportJSON(w io.Writer, each exportSource) error {
+	_, err := w.Write([]byte("["))
+	if err != nil {
+		return err
+	}
+	separator := "\n"
+	err = each(func(list *data.List) error {
+		js, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\t%s", separator, js)
+		separator = ",\n"
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("\n]\n"))
+	return err
+}
+
+// exportMarkdown() writes a checklist with finished tasks ticked off
+func exportMarkdown(w io.Writer, each exportSource) error {
+	_, err := w.Write([]byte("# Lists\n\n"))
+	if err != nil {
+		return err
+	}
+	return each(func(list *data.List) error {
+		check := " "
+		if list.Done() {
+			check = "x"
+		}
+		_, err := fmt.Fprintf(w, "- [%s] **%s**: %s _(%s)_", check, markdownEscape(list.Name), markdownEscape(list.Task), markdownEscape(list.Status))
+		if err != nil {
+			return err
+		}
+		if list.DueDate != nil {
+			_, err = fmt.Fprintf(w, " due %s", list.DueDate.Format("2006-01-02"))
+			if err != nil {
+				return err
+			}
+		}
+		for _, label := range list.Labels {
+			_, err = fmt.Fprintf(w, " `%s`", strings.ReplaceAll(label, "`", "'"))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = w.Write([]byte("\n"))
+		return err
+	})
+}
+
+// markdownEscaper backslash-escapes the characters that would change how a line renders
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]",
+	"<", "\\<", ">", "\\>", "#", "\\#", "|", "\\|", "\r\n", " ", "\n", " ",
+)
+
+// markdownEscape() makes user text safe to place on a single markdown line
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
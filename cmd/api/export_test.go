@@ -0,0 +1,137 @@
+//Filename: cmd/api/export_test.go
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+// listSource feeds a fixed set of lists to an export, failing after the first n when err is set
+func listSource(lists []*data.List, n int, err error) exportSource {
+	return func(fn func(*data.List) error) error {
+		for i, list := range lists {
+			if err != nil && i == n {
+				return err
+			}
+			if e := fn(list); e != nil {
+				return e
+			}
+		}
+		return err
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"groceries", "groceries"},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.in); got != tt.want {
+			t.Errorf("%q: got %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"**bold**", `\*\*bold\*\*`},
+		{"[link](x)", `\[link\](x)`},
+		{"two\nlines", "two lines"},
+		{"# heading", `\# heading`},
+	}
+	for _, tt := range tests {
+		if got := markdownEscape(tt.in); got != tt.want {
+			t.Errorf("%q: got %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	created := time.Date(2029, 12, 1, 9, 0, 0, 0, time.UTC)
+	lists := []*data.List{
+		{ID: 1, CreatedAt: created, Name: "=cmd", Task: "milk", Status: "done", DueDate: &due, Labels: []string{"home", "shop"}, Version: 2},
+		{ID: 2, CreatedAt: created, Name: "report", Task: "write *it*", Status: "todo", Version: 1},
+	}
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"csv", []string{
+			"id,created_at,name,task,status,due_date,labels,recurrence,version\n",
+			"1,2029-12-01T09:00:00Z,'=cmd,milk,done,2030-01-02T00:00:00Z,home;shop,,2\n",
+			"2,2029-12-01T09:00:00Z,report,write *it*,todo,,,,1\n",
+		}},
+		{"json", []string{"[\n\t{\"id\":1,", `"name":"=cmd"`, ",\n\t{\"id\":2,", "\n]\n"}},
+		{"md", []string{
+			"# Lists\n\n",
+			"- [x] **=cmd**: milk _(done)_ due 2030-01-02 `home` `shop`\n",
+			"- [ ] **report**: write \\*it\\* _(todo)_\n",
+		}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/v1/list/export?format="+tt.format, nil)
+		app.writeExport(w, r, tt.format, listSource(lists, 0, nil))
+		body := w.Body.String()
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d; want 200", tt.format, w.Code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: got body %q; want it to contain %q", tt.format, body, want)
+			}
+		}
+	}
+}
+
+func TestWriteExportFailure(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	failure := errors.New("connection reset")
+
+	//nothing has reached the client yet so the failure gets a proper status
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Disposition", `attachment; filename="lists.csv"`)
+	r := httptest.NewRequest(http.MethodGet, "/v1/list/export", nil)
+	app.writeExport(w, r, "csv", listSource([]*data.List{{ID: 1}, {ID: 2}}, 1, failure))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("early failure: got status %d and disposition %q; want 500 and none", w.Code, w.Header().Get("Content-Disposition"))
+	}
+
+	//once rows have gone out the handler has to abort instead of finishing a 200
+	lists := make([]*data.List, 2000)
+	for i := range lists {
+		lists[i] = &data.List{ID: int64(i + 1), Task: strings.Repeat("x", 100)}
+	}
+	w = httptest.NewRecorder()
+	defer func() {
+		if got := recover(); got != http.ErrAbortHandler {
+			t.Errorf("late failure: got panic %v; want http.ErrAbortHandler", got)
+		}
+	}()
+	app.writeExport(w, r, "csv", listSource(lists, 1500, failure))
+}
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"todo.joelical.net/internal/validator"
@@ -31,6 +32,26 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 
 }
 
+// readNamedIDParam() reads a second id from the request url, such as ":reminder_id"
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return id, nil
+}
+
+// readVersionParam() reads the ":version" parameter from the request url
+func (app *application) readVersionParam(r *http.Request) (int32, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	version, err := strconv.ParseInt(params.ByName("version"), 10, 32)
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid version parameter")
+	}
+	return int32(version), nil
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, headers http.Header) error {
 	//convert our map into a json object
 	js, err := json.MarshalIndent(data, "", "\t")
@@ -143,3 +164,21 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	return intValue
 }
+
+// the layout of dates in query strings
+const dateLayout = "2006-01-02"
+
+// the readDate() method reads a date in the form 2006-01-02 from the query string as midnight UTC.
+// if the value is not a valid date then a validation error is added to the validation errors map
+func (app *application) readDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		v.AddError(key, "must be a date in the form YYYY-MM-DD")
+		return defaultValue
+	}
+	return date
+}
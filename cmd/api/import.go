@@ -0,0 +1,413 @@
+//Filename: cmd/api/import.go
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+const (
+	// the largest file that can be imported, 10MB
+	importMaxBytes = 10 << 20
+	// the most rows a single import may contain
+	importMaxRows = 5000
+)
+
+// importRow is one task read from an uploaded file along with anything wrong with it.
+// errors keep the row out of the import, warnings are only there to be read
+type importRow struct {
+	Row      int               `json:"row"`
+	List     *data.List        `json:"list"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	Warnings map[string]string `json:"warnings,omitempty"`
+}
+
+// importReport is returned for both a dry run and an applied import
+type importReport struct {
+	Format  string       `json:"format"`
+	DryRun  bool         `json:"dry_run"`
+	Total   int          `json:"total"`
+	Valid   int          `json:"valid"`
+	Invalid int          `json:"invalid"`
+	Warned  int          `json:"warned"`
+	Rows    []*importRow `json:"rows"`
+}
+
+// importDefaults are the values used when a file does not provide them
+type importDefaults struct {
+	name   string
+	status string
+}
+
+// importListHandler for the "POST /v1/list/import" endpoint
+// it accepts a multipart upload with a "file" part and reports what would be created.
+// with ?apply=true the lists are created in one transaction, and only if every row is valid
+func (app *application) importListHandler(w http.ResponseWriter, r *http.Request) {
+	app.extendDeadlines(r, uploadTimeout)
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+	err := r.ParseMultipartForm(importMaxBytes)
+	if err != nil {
+		switch {
+		case err.Error() == "http: request body too large":
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", importMaxBytes))
+		default:
+			app.badRequestResponse(w, r, errors.New("body must be a multipart form with a file"))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("the file field must be provided"))
+		return
+	}
+	defer file.Close()
+
+	v := validator.New()
+	format := r.FormValue("format")
+	if format == "" {
+		format = "csv"
+	}
+	defaults := importDefaults{
+		name:   r.FormValue("name"),
+		status: r.FormValue("status"),
+	}
+	if defaults.status == "" {
+		defaults.status = "todo"
+	}
+	apply := app.readString(r.URL.Query(), "apply", "false")
+	v.Check(validator.In(format, "csv", "trello", "todoist"), "format", "must be one of csv, trello or todoist")
+	v.Check(validator.In(apply, "true", "false"), "apply", "must be true or false")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	//todoist exports one project per file and the project is only named by the file
+	if defaults.name == "" && format == "todoist" {
+		defaults.name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	var rows []*importRow
+	switch format {
+	case "csv":
+		rows, err = parseCSVImport(file, defaults)
+	case "trello":
+		rows, err = parseTrelloImport(file, defaults)
+	case "todoist":
+		rows, err = parseTodoistImport(file, defaults)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if len(rows) > importMaxRows {
+		app.badRequestResponse(w, r, fmt.Errorf("file must not contain more than %d rows", importMaxRows))
+		return
+	}
+
+	report := &importReport{Format: format, DryRun: apply != "true", Total: len(rows), Rows: rows}
+	lists := make([]*data.List, 0, len(rows))
+	for _, row := range rows {
+		rv := validator.New()
+		for key, message := range row.Errors {
+			rv.AddError(key, message)
+		}
+		data.ValidateList(rv, row.List)
+		if !rv.Valid() {
+			row.Errors = rv.Errors
+			report.Invalid++
+			continue
+		}
+		report.Valid++
+		if len(row.Warnings) > 0 {
+			report.Warned++
+		}
+		row.List.WorkspaceID = app.contextGetWorkspace(r).ID
+		lists = append(lists, row.List)
+	}
+
+	if report.DryRun {
+		err = app.writeJSON(w, http.StatusOK, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if report.Invalid > 0 {
+		env := envelope{"error": "the file contains invalid rows, nothing was imported", "import": report}
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.List.InsertAll(lists)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	for _, list := range lists {
+		app.publishListEvent(data.EventListCreated, list)
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"import": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// parseCSVImport() reads a csv file with a header row. the columns are matched by name, in any order:
+// name, task, status, due_date, labels (separated by ";") and recurrence. a file from GET /v1/list/export can be imported as is
+func parseCSVImport(file io.Reader, defaults importDefaults) ([]*importRow, error) {
+	cr := csv.NewReader(file)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("the csv file must start with a header row")
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		switch column {
+		case "title", "content":
+			column = "task"
+		case "due", "due date":
+			column = "due_date"
+		case "tags":
+			column = "labels"
+		}
+		if _, exists := columns[column]; !exists {
+			columns[column] = i
+		}
+	}
+	if _, ok := columns["task"]; !ok {
+		return nil, errors.New("the csv file must have a task column")
+	}
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := []*importRow{}
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the csv file could not be read: %v", err)
+		}
+		row := &importRow{Row: line, List: &data.List{
+			Name:       field(record, "name"),
+			Task:       field(record, "task"),
+			Status:     field(record, "status"),
+			Labels:     splitLabels(field(record, "labels"), ";"),
+			Recurrence: field(record, "recurrence"),
+		}}
+		setImportDueDate(row, field(record, "due_date"))
+		applyImportDefaults(row.List, defaults)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseTrelloImport() reads a board exported from Trello as JSON.
+// each open card becomes a task named after the board, with the card's column as its status
+func parseTrelloImport(file io.Reader, defaults importDefaults) ([]*importRow, error) {
+	var board struct {
+		Name  string `json:"name"`
+		Lists []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"lists"`
+		Cards []struct {
+			Name        string     `json:"name"`
+			IDList      string     `json:"idList"`
+			Due         *time.Time `json:"due"`
+			DueComplete bool       `json:"dueComplete"`
+			Closed      bool       `json:"closed"`
+			Labels      []struct {
+				Name  string `json:"name"`
+				Color string `json:"color"`
+			} `json:"labels"`
+		} `json:"cards"`
+	}
+	err := json.NewDecoder(file).Decode(&board)
+	if err != nil {
+		return nil, errors.New("the file is not a valid Trello board export")
+	}
+	columns := make(map[string]string)
+	for _, list := range board.Lists {
+		columns[list.ID] = list.Name
+	}
+	if defaults.name == "" {
+		defaults.name = board.Name
+	}
+
+	rows := []*importRow{}
+	for i, card := range board.Cards {
+		//archived cards stay behind
+		if card.Closed {
+			continue
+		}
+		status := columns[card.IDList]
+		if card.DueComplete {
+			status = "done"
+		}
+		labels := []string{}
+		for _, label := range card.Labels {
+			//unnamed trello labels are only a colour
+			if label.Name != "" {
+				labels = append(labels, label.Name)
+			} else if label.Color != "" {
+				labels = append(labels, label.Color)
+			}
+		}
+		list := &data.List{
+			Task:    card.Name,
+			Status:  status,
+			DueDate: card.Due,
+			Labels:  labels,
+		}
+		applyImportDefaults(list, defaults)
+		rows = append(rows, &importRow{Row: i + 1, List: list})
+	}
+	return rows, nil
+}
+
+// parseTodoistImport() reads a project exported from Todoist as csv.
+// section rows become the status of the tasks under them and @words in a task become labels
+func parseTodoistImport(file io.Reader, defaults importDefaults) ([]*importRow, error) {
+	cr := csv.NewReader(file)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.New("the file is not a valid Todoist export")
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))] = i
+	}
+	for _, column := range []string{"TYPE", "CONTENT", "DATE"} {
+		if _, ok := columns[column]; !ok {
+			return nil, errors.New("the file is not a valid Todoist export")
+		}
+	}
+	field := func(record []string, column string) string {
+		i := columns[column]
+		if i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := []*importRow{}
+	section := ""
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the file could not be read: %v", err)
+		}
+		switch strings.ToLower(field(record, "TYPE")) {
+		case "section":
+			section = field(record, "CONTENT")
+		case "task":
+			words := []string{}
+			labels := []string{}
+			for _, word := range strings.Fields(field(record, "CONTENT")) {
+				if strings.HasPrefix(word, "@") && len(word) > 1 {
+					labels = append(labels, word[1:])
+				} else {
+					words = append(words, word)
+				}
+			}
+			row := &importRow{Row: line, List: &data.List{
+				Task:   strings.Join(words, " "),
+				Status: section,
+				Labels: labels,
+			}}
+			//todoist writes dates the way they were typed, e.g. "every monday" or "tomorrow",
+			//so one we can't read only costs the task its due date
+			date := field(record, "DATE")
+			if due, ok := parseImportDate(date); ok {
+				row.List.DueDate = due
+			} else {
+				row.Warnings = map[string]string{"due_date": fmt.Sprintf("%q is not a date we can read, the task was given no due date", date)}
+			}
+			applyImportDefaults(row.List, defaults)
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// importDateLayouts are the due date formats an import understands
+var importDateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+// parseImportDate() parses a due date. an empty value is no due date and parses fine
+func parseImportDate(value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	for _, layout := range importDateLayouts {
+		due, err := time.Parse(layout, value)
+		if err == nil {
+			return &due, true
+		}
+	}
+	return nil, false
+}
+
+// setImportDueDate() parses a due date, recording an error on the row if it can't
+func setImportDueDate(row *importRow, value string) {
+	due, ok := parseImportDate(value)
+	if !ok {
+		row.Errors = map[string]string{"due_date": "must be a date in YYYY-MM-DD or RFC 3339 format"}
+		return
+	}
+	row.List.DueDate = due
+}
+
+// applyImportDefaults() fills in the name and status when the file left them empty
+func applyImportDefaults(list *data.List, defaults importDefaults) {
+	if list.Name == "" {
+		list.Name = defaults.name
+	}
+	if list.Status == "" {
+		list.Status = defaults.status
+	}
+}
+
+// splitLabels() splits a label column and drops empty values
+func splitLabels(value, separator string) []string {
+	labels := []string{}
+	for _, label := range strings.Split(value, separator) {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,71 @@
+//Filename: cmd/api/import_test.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoistImportDates(t *testing.T) {
+	file := "TYPE,CONTENT,PRIORITY,DATE\n" +
+		"section,Doing,,\n" +
+		"task,buy milk @home,1,2030-01-02\n" +
+		"task,call bank,1,every monday\n" +
+		"task,stretch,1,\n"
+	rows, err := parseTodoistImport(strings.NewReader(file), importDefaults{name: "errands", status: "todo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		task    string
+		due     *time.Time
+		warning bool
+	}{
+		{"buy milk", &due, false},
+		{"call bank", nil, true},
+		{"stretch", nil, false},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows; want %d", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		row := rows[i]
+		if row.List.Task != tt.task || row.List.Status != "Doing" {
+			t.Errorf("row %d: got task %q in %q; want %q in Doing", i, row.List.Task, row.List.Status, tt.task)
+		}
+		if (row.List.DueDate == nil) != (tt.due == nil) || (tt.due != nil && !row.List.DueDate.Equal(*tt.due)) {
+			t.Errorf("%s: got due date %v; want %v", tt.task, row.List.DueDate, tt.due)
+		}
+		if len(row.Errors) != 0 {
+			t.Errorf("%s: got errors %v; want none", tt.task, row.Errors)
+		}
+		if _, warned := row.Warnings["due_date"]; warned != tt.warning {
+			t.Errorf("%s: got warnings %v; want a due_date warning %t", tt.task, row.Warnings, tt.warning)
+		}
+	}
+}
+
+func TestParseCSVImportDates(t *testing.T) {
+	tests := []struct {
+		due   string
+		valid bool
+	}{
+		{"", true},
+		{"2030-01-02", true},
+		{"2030-01-02 09:30", true},
+		{"2030-01-02T09:30:00Z", true},
+		{"tomorrow", false},
+	}
+	for _, tt := range tests {
+		rows, err := parseCSVImport(strings.NewReader("task,due_date\nmilk,"+tt.due+"\n"), importDefaults{name: "errands", status: "todo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, invalid := rows[0].Errors["due_date"]; invalid == tt.valid {
+			t.Errorf("%q: got errors %v; want valid %t", tt.due, rows[0].Errors, tt.valid)
+		}
+	}
+}
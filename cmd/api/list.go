@@ -3,9 +3,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"todo.joelical.net/internal/data"
 	"todo.joelical.net/internal/validator"
@@ -15,9 +19,17 @@ import (
 func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
 	// our target decode destination
 	var input struct {
-		Name   string `json:"name"`
-		Task   string `json:"task"`
-		Status string `json:"status"`
+		Name           string     `json:"name"`
+		Task           string     `json:"task"`
+		Status         string     `json:"status"`
+		DueDate        *time.Time `json:"due_date"`
+		Labels         []string   `json:"labels"`
+		Recurrence     string     `json:"recurrence"`
+		AssigneeIDs    []int64    `json:"assignee_ids"`
+		ParentID       *int64     `json:"parent_id"`
+		CompletionRule string     `json:"completion_rule"`
+		Estimate       *int32     `json:"estimate"`
+		Priority       int16      `json:"priority"`
 	}
 	//initialize a new json.decode instance
 	err := app.readJSON(w, r, &input)
@@ -27,9 +39,19 @@ func (app *application) createListHandler(w http.ResponseWriter, r *http.Request
 	}
 	//copy the values from the input struct to a new lists struct
 	list := &data.List{
-		Name:   input.Name,
-		Task:   input.Task,
-		Status: input.Status,
+		Name:           input.Name,
+		Task:           input.Task,
+		Status:         input.Status,
+		DueDate:        input.DueDate,
+		Labels:         input.Labels,
+		Recurrence:     input.Recurrence,
+		AssigneeIDs:    input.AssigneeIDs,
+		ParentID:       input.ParentID,
+		CompletionRule: input.CompletionRule,
+		Estimate:       input.Estimate,
+		Priority:       input.Priority,
+		//new lists go into the workspace named in the url
+		WorkspaceID: app.contextGetWorkspace(r).ID,
 	}
 
 	//Initialize a new validator instance
@@ -43,11 +65,24 @@ func (app *application) createListHandler(w http.ResponseWriter, r *http.Request
 	//create a list
 	err = app.models.List.Insert(list)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrInvalidAssignee):
+			v.AddError("assignee_ids", invalidAssigneeMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInvalidParent):
+			v.AddError("parent_id", invalidParentMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
+	app.publishListEvent(data.EventListCreated, list)
 	//create a location header for the newly created resource
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/list/%d", list.ID))
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d", list.WorkspaceID, list.ID))
 	//write the response with 201 -created status code with the body being the list data and the header being the headers map
 	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
 	if err != nil {
@@ -64,7 +99,7 @@ func (app *application) showListHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	//Fetch the specific list
-	list, err := app.models.List.Get(id)
+	list, err := app.models.List.Get(app.contextGetWorkspace(r).ID, id)
 	//handle errors
 	if err != nil {
 		switch {
@@ -83,6 +118,179 @@ func (app *application) showListHandler(w http.ResponseWriter, r *http.Request)
 
 }
 
+// listPatch holds the changes a client sends for a list
+// the fields are pointers because pointers have a default value of nil
+// if the filed remains nil, then we know user did not update it
+type listPatch struct {
+	Name           *string      `json:"name"`
+	Task           *string      `json:"task"`
+	Status         *string      `json:"status"`
+	DueDate        nullableTime `json:"due_date"`
+	Labels         []string     `json:"labels"`
+	Recurrence     *string      `json:"recurrence"`
+	AssigneeIDs    []int64      `json:"assignee_ids"`
+	ParentID       nullableID   `json:"parent_id"`
+	CompletionRule *string      `json:"completion_rule"`
+	Estimate       nullableInt  `json:"estimate"`
+	Priority       *int16       `json:"priority"`
+}
+
+// nullableID is an id that can be sent as null, unlike the pointer fields where null means "not sent".
+// "parent_id": null moves a subtask back to the top level
+type nullableID struct {
+	Set bool
+	ID  *int64
+}
+
+func (n *nullableID) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	return json.Unmarshal(b, &n.ID)
+}
+
+// the validation message for assignee_ids naming someone outside the workspace
+const invalidAssigneeMessage = "must only contain members of the workspace"
+
+// nullableInt works the same way for numbers. "estimate": null clears the estimate
+type nullableInt struct {
+	Set   bool
+	Value *int32
+}
+
+func (n *nullableInt) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	return json.Unmarshal(b, &n.Value)
+}
+
+// nullableTime works the same way for dates. "due_date": null clears the due date
+type nullableTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (n *nullableTime) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	return json.Unmarshal(b, &n.Time)
+}
+
+// the validation message for a parent_id that is missing or would make a cycle
+const invalidParentMessage = "must be a list in the same workspace that is not this list or one of its subtasks"
+
+// apply() copies the fields the user sent onto the list
+func (p listPatch) apply(list *data.List) {
+	if p.Name != nil {
+		list.Name = *p.Name
+	}
+	if p.Task != nil {
+		list.Task = *p.Task
+	}
+	if p.Status != nil {
+		list.Status = *p.Status
+	}
+	if p.DueDate.Set {
+		list.DueDate = p.DueDate.Time
+	}
+	if p.Labels != nil {
+		list.Labels = p.Labels
+	}
+	if p.Recurrence != nil {
+		list.Recurrence = *p.Recurrence
+	}
+	if p.AssigneeIDs != nil {
+		list.AssigneeIDs = p.AssigneeIDs
+	}
+	if p.ParentID.Set {
+		list.ParentID = p.ParentID.ID
+	}
+	if p.CompletionRule != nil {
+		list.CompletionRule = *p.CompletionRule
+	}
+	if p.Estimate.Set {
+		list.Estimate = p.Estimate.Value
+	}
+	if p.Priority != nil {
+		list.Priority = *p.Priority
+	}
+}
+
+// saveListUpdate() saves an edited list and publishes the change. previousStatus is the status
+// the list had before the edit. when the edit marks a recurring list as done the next occurrence
+// is created in the same transaction and returned. lists finished by completion rules are published too
+func (app *application) saveListUpdate(list *data.List, previousStatus string) (*data.List, error) {
+	next := nextOccurrence(list, previousStatus)
+	var completed []*data.List
+	var err error
+	if next == nil {
+		completed, err = app.models.List.Update(list)
+	} else {
+		completed, err = app.models.List.UpdateWithNext(list, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+	app.publishListEvent(data.EventListUpdated, list)
+	for _, other := range completed {
+		app.publishListEvent(data.EventListUpdated, other)
+	}
+	if next != nil {
+		app.publishListEvent(data.EventListCreated, next)
+	}
+	return next, nil
+}
+
+// nextOccurrence() returns the next occurrence of a recurring list that has just been marked done,
+// or nil if there isn't one. the finished list stops recurring so finishing it again won't repeat it
+func nextOccurrence(list *data.List, previousStatus string) *data.List {
+	wasDone := (&data.List{Status: previousStatus}).Done()
+	if wasDone || !list.Done() || list.Recurrence == "" || list.DueDate == nil {
+		return nil
+	}
+	//the rule passed ValidateList so it parses
+	rule, err := validator.ParseRRule(list.Recurrence)
+	if err != nil {
+		return nil
+	}
+	due, ok := rule.Next(*list.DueDate)
+	if !ok {
+		return nil
+	}
+	list.Recurrence = ""
+	return &data.List{
+		WorkspaceID:    list.WorkspaceID,
+		Name:           list.Name,
+		Task:           list.Task,
+		Status:         previousStatus,
+		DueDate:        &due,
+		Labels:         append([]string{}, list.Labels...),
+		Recurrence:     rule.Remaining().String(),
+		AssigneeIDs:    append([]int64{}, list.AssigneeIDs...),
+		ParentID:       list.ParentID,
+		CompletionRule: list.CompletionRule,
+		Estimate:       list.Estimate,
+		Priority:       list.Priority,
+	}
+}
+
+// readList() loads the ":id" list from the request's workspace for the handlers of things that
+// belong to a list. ok is false once an error response has been sent
+func (app *application) readList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	list, err := app.models.List.Get(app.contextGetWorkspace(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return list, true
+}
+
 // updateListHandler for the "PUT /v1/list/:id" endpoint
 func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
 	//this method does a partial replacement
@@ -93,7 +301,7 @@ func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	//fetch the orginal record from the database
-	list, err := app.models.List.Get(id)
+	list, err := app.models.List.Get(app.contextGetWorkspace(r).ID, id)
 	//handle errors
 	if err != nil {
 		switch {
@@ -106,13 +314,7 @@ func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request
 	}
 	//create an input struct to hold data read in from the user
 	// our target decode destination
-	//update input struct to use pointers because pointers have a default value of nil
-	//if the filed remains nil, then we know user did not update it
-	var input struct {
-		Name   *string `json:"name"`
-		Task   *string `json:"task"`
-		Status *string `json:"status"`
-	}
+	var input listPatch
 	//initialize a new json.decode instance
 	err = app.readJSON(w, r, &input)
 	if err != nil {
@@ -120,15 +322,8 @@ func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	//check input struct for those updates
-	if input.Name != nil {
-		list.Name = *input.Name
-	}
-	if input.Task != nil {
-		list.Task = *input.Task
-	}
-	if input.Status != nil {
-		list.Status = *input.Status
-	}
+	previousStatus := list.Status
+	input.apply(list)
 
 	//perform validation on the updated list. if validation fails, then we send a 422 - unprocessable entity response to the user
 	//Initialize a new validator instance
@@ -140,18 +335,35 @@ func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	//pass the updated list record to the update() method
-	err = app.models.List.Update(list)
+	//finishing a recurring task also creates its next occurrence
+	next, err := app.saveListUpdate(list, previousStatus)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrQuotaExceeded):
+			app.quotaExceededResponse(w, r)
+		case errors.Is(err, data.ErrInvalidAssignee):
+			v.AddError("assignee_ids", invalidAssigneeMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		//moving the list under itself or one of its subtasks is caught when saving
+		case errors.Is(err, data.ErrInvalidParent):
+			v.AddError("parent_id", invalidParentMessage)
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrWIPLimitExceeded):
+			v.AddError("status", wipLimitMessage)
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	env := envelope{"list": list}
+	if next != nil {
+		env["next"] = next
+	}
 	//write the data returned by get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -168,7 +380,8 @@ func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	//delete the list from the database. sends a 404 not found status code to the user if there is no matching record.
-	err = app.models.List.Delete(id)
+	//subtasks are deleted along with the list
+	subtasks, err := app.models.List.Delete(app.contextGetWorkspace(r).ID, id)
 	//handle errors
 	if err != nil {
 		switch {
@@ -179,6 +392,10 @@ func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	app.publishListEvent(data.EventListDeleted, &data.List{ID: id, WorkspaceID: app.contextGetWorkspace(r).ID})
+	for _, subtask := range subtasks {
+		app.publishListEvent(data.EventListDeleted, &data.List{ID: subtask, WorkspaceID: app.contextGetWorkspace(r).ID})
+	}
 	//return a 200 status ok to the user with a success message
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
 	if err != nil {
@@ -210,14 +427,16 @@ func (app *application) displayListHandler(w http.ResponseWriter, r *http.Reques
 	//get the sort information
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	//specify the allowed sort values
-	input.Filters.SortList = []string{"id", "name", "status", "-id", "-name", "-status"}
+	input.Filters.SortList = []string{"id", "name", "status", "position", "priority", "-id", "-name", "-status", "-position", "-priority"}
+	//assignee=me|<member id>|none
+	assignee := app.readAssignee(r, qs, v)
 	//check for validation errors
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	//get a invenortu of all list
-	lists, metadata, err := app.models.List.GetAll(input.Name, input.Status, input.Filters)
+	lists, metadata, err := app.models.List.GetAll(app.contextGetWorkspace(r).ID, input.Name, input.Status, assignee, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -229,3 +448,137 @@ func (app *application) displayListHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// readAssignee() reads the "assignee" query parameter. "me" is the caller, which needs an api key or token,
+// "none" is lists assigned to nobody and a number is a member id
+func (app *application) readAssignee(r *http.Request, qs url.Values, v *validator.Validator) data.Assignee {
+	s := qs.Get("assignee")
+	switch s {
+	case "":
+		return data.Assignee{}
+	case "none":
+		return data.Assignee{Unassigned: true}
+	case "me":
+		c := app.contextGetCaller(r)
+		if c.anonymous() {
+			v.AddError("assignee", "me needs an authenticated member")
+			return data.Assignee{}
+		}
+		return data.Assignee{MemberID: c.member.ID}
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		v.AddError("assignee", "must be me, none or a member id")
+		return data.Assignee{}
+	}
+	return data.Assignee{MemberID: id}
+}
+
+// myTasksHandler for the "GET /v1/me/tasks" endpoint. it shows every list assigned to the caller, soonest due
+// first, then the highest priority first, then in board order. lists in other workspaces are included when
+// the caller signs in to them with the same sso account
+func (app *application) myTasksHandler(w http.ResponseWriter, r *http.Request) {
+	c := app.contextGetCaller(r)
+	if c.anonymous() {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	filters := data.Filters{
+		Page:     app.readInt(qs, "page", 1, v),
+		PageSize: app.readInt(qs, "page_size", 20, v),
+		//the order is fixed
+		Sort:     "due_date",
+		SortList: []string{"due_date"},
+	}
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	memberIDs, err := app.models.Members.GetLinkedIDs(c.member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	lists, metadata, err := app.models.List.GetAssigned(memberIDs, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSubtasksHandler for the "GET /v1/list/:id/subtasks" endpoint
+// the subtasks come back as a tree, each with its own subtasks inside it
+func (app *application) listSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	subtasks, err := app.models.List.GetSubtasks(list.WorkspaceID, list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list, "subtasks": subtasks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moveListHandler for the "PATCH /v1/list/:id/move" endpoint
+// before is the id of the list that should come just before this one and after the one that should come just after it.
+// sending only one of them puts the list right next to it. renumbered holds the lists around the gap
+// when it had to be widened, they keep their order but have new positions
+func (app *application) moveListHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Before int64 `json:"before"`
+		After  int64 `json:"after"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Before > 0 || input.After > 0, "before", "must be provided if after is not")
+	v.Check(input.Before >= 0, "before", "must be a valid list id")
+	v.Check(input.After >= 0, "after", "must be a valid list id")
+	v.Check(input.Before != id, "before", "must not be the list itself")
+	v.Check(input.After != id, "after", "must not be the list itself")
+	v.Check(input.Before == 0 || input.Before != input.After, "after", "must not be the same as before")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	list, renumbered, err := app.models.List.Move(app.contextGetWorkspace(r).ID, id, input.Before, input.After)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInvalidMove):
+			v.AddError("before", "must be a list in the same workspace that comes before after")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishListEvent(data.EventListUpdated, list)
+	for _, other := range renumbered {
+		app.publishListEvent(data.EventListUpdated, other)
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list, "renumbered": renumbered}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
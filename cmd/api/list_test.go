@@ -0,0 +1,113 @@
+//Filename: cmd/api/list_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+func TestReadAssignee(t *testing.T) {
+	app := &application{}
+	sam := &caller{member: &data.Member{ID: 7, WorkspaceID: 1, Name: "sam", Role: data.RoleMember}, scopes: []string{data.ScopeRead}}
+	tests := []struct {
+		query  string
+		caller *caller
+		want   data.Assignee
+		valid  bool
+	}{
+		{"", anonymousCaller, data.Assignee{}, true},
+		{"assignee=me", sam, data.Assignee{MemberID: 7}, true},
+		{"assignee=me", anonymousCaller, data.Assignee{}, false},
+		{"assignee=none", anonymousCaller, data.Assignee{Unassigned: true}, true},
+		{"assignee=12", anonymousCaller, data.Assignee{MemberID: 12}, true},
+		{"assignee=0", sam, data.Assignee{}, false},
+		{"assignee=sam", sam, data.Assignee{}, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/list?"+tt.query, nil)
+		r = app.contextSetCaller(r, tt.caller)
+		v := validator.New()
+		got := app.readAssignee(r, r.URL.Query(), v)
+		if got != tt.want || v.Valid() != tt.valid {
+			t.Errorf("%q: got %+v, valid %t; want %+v, %t", tt.query, got, v.Valid(), tt.want, tt.valid)
+		}
+	}
+}
+
+func TestListPatchNullableFields(t *testing.T) {
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	estimate := int32(3)
+	parent := int64(7)
+	tests := []struct {
+		name    string
+		body    string
+		cleared bool
+	}{
+		{"absent", `{"name":"renamed"}`, false},
+		{"null", `{"due_date":null,"estimate":null,"parent_id":null}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := &data.List{DueDate: &due, Estimate: &estimate, ParentID: &parent}
+			var patch listPatch
+			if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+				t.Fatal(err)
+			}
+			patch.apply(list)
+			if (list.DueDate == nil) != tt.cleared {
+				t.Errorf("got due_date %v", list.DueDate)
+			}
+			if (list.Estimate == nil) != tt.cleared {
+				t.Errorf("got estimate %v", list.Estimate)
+			}
+			if (list.ParentID == nil) != tt.cleared {
+				t.Errorf("got parent_id %v", list.ParentID)
+			}
+		})
+	}
+
+	list := &data.List{}
+	var patch listPatch
+	if err := json.Unmarshal([]byte(`{"due_date":"2030-01-02T00:00:00Z"}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+	patch.apply(list)
+	if list.DueDate == nil || !list.DueDate.Equal(due) {
+		t.Errorf("got due_date %v; want %v", list.DueDate, due)
+	}
+}
+
+func TestListPriority(t *testing.T) {
+	tests := []struct {
+		body  string
+		want  int16
+		valid bool
+	}{
+		{`{}`, data.PriorityMedium, true},
+		{`{"priority":0}`, data.PriorityNone, true},
+		{`{"priority":3}`, data.PriorityHigh, true},
+		{`{"priority":4}`, 4, false},
+		{`{"priority":-1}`, -1, false},
+	}
+	for _, tt := range tests {
+		//a patch without a priority leaves the list's alone
+		list := &data.List{Name: "n", Task: "t", Status: "todo", Priority: data.PriorityMedium}
+		var patch listPatch
+		if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+			t.Fatal(err)
+		}
+		patch.apply(list)
+		v := validator.New()
+		data.ValidateList(v, list)
+		if list.Priority != tt.want || v.Valid() != tt.valid {
+			t.Errorf("%s: got priority %d, valid %t; want %d, %t", tt.body, list.Priority, v.Valid(), tt.want, tt.valid)
+		}
+	}
+}
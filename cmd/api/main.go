@@ -4,15 +4,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/jwt"
+	"todo.joelical.net/internal/mailer"
+	"todo.joelical.net/internal/oidc"
+	"todo.joelical.net/internal/storage"
 )
 
 // the application version number
@@ -28,13 +34,59 @@ type config struct {
 		maxIdleConns int
 		maxIdleTime  string
 	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	auth struct {
+		required bool
+		//"token" for tokens kept in the database, or "jwt" for signed tokens
+		mode    string
+		jwtKeys string
+	}
+	//sso sign in, off unless an issuer is given
+	oidc struct {
+		issuer       string
+		clientID     string
+		clientSecret string
+		redirectURL  string
+	}
+	//where attachments are kept, "local" or "s3"
+	storage struct {
+		backend string
+		dir     string
+		s3      struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+		}
+	}
 }
 
 // dependence injection - so its availale to our handlers
 type application struct {
-	config config
-	logger *log.Logger
-	models data.Models
+	config    config
+	logger    *log.Logger
+	models    data.Models
+	events    *listEventHub
+	presence  *presenceRegistry
+	notifiers map[string]Notifier
+	mailer    mailer.Mailer
+	//signs and checks tokens with -auth-mode=jwt, nil otherwise
+	jwt         *jwt.KeySet
+	revocations *tokenRevocations
+	//the sso provider and the sign ins waiting for it, nil without -oidc-issuer
+	oidc       *oidc.Provider
+	oidcLogins *oidcLogins
+	blobs      storage.BlobStore
+	//closed when the server shuts down, background workers stop when they see it
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
 func main() {
@@ -46,6 +98,28 @@ func main() {
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	//the defaults suit a local SMTP stand-in such as MailHog
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 1025, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("TODO_SMTP_USERNAME"), "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("TODO_SMTP_PASSWORD"), "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Todo <no-reply@todo.joelical.net>", "SMTP sender")
+	//turning it off lets requests without credentials manage the default workspace, e.g. to add its first owner
+	flag.BoolVar(&cfg.auth.required, "auth-required", true, "Reject requests that don't send a token or API key")
+	flag.StringVar(&cfg.auth.mode, "auth-mode", "token", "Authentication tokens (token | jwt)")
+	flag.StringVar(&cfg.auth.jwtKeys, "jwt-keys", os.Getenv("TODO_JWT_KEYS"), "JWT keys as kid:alg:base64url-key, comma separated, the first one signs")
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", os.Getenv("TODO_OIDC_ISSUER"), "OpenID Connect issuer URL for SSO sign in")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", os.Getenv("TODO_OIDC_CLIENT_ID"), "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", os.Getenv("TODO_OIDC_CLIENT_SECRET"), "OpenID Connect client secret, empty for a public client")
+	flag.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "http://localhost:4000/v1/auth/oidc/callback", "OpenID Connect redirect URL registered with the provider")
+	flag.StringVar(&cfg.storage.backend, "storage", "local", "Attachment storage (local | s3)")
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for local attachment storage")
+	//the defaults suit a local S3 stand-in such as MinIO
+	flag.StringVar(&cfg.storage.s3.endpoint, "s3-endpoint", "http://localhost:9000", "S3 endpoint")
+	flag.StringVar(&cfg.storage.s3.region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.storage.s3.bucket, "s3-bucket", "todo-attachments", "S3 bucket")
+	flag.StringVar(&cfg.storage.s3.accessKey, "s3-access-key", os.Getenv("TODO_S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.storage.s3.secretKey, "s3-secret-key", os.Getenv("TODO_S3_SECRET_KEY"), "S3 secret key")
 	flag.Parse() // need to do this step so we can access the flags
 
 	//create a logger
@@ -59,28 +133,62 @@ func main() {
 	defer db.Close()
 	//log the successful connection pool
 	logger.Println("database connection pool established")
+	keys, err := openJWTKeys(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	provider, err := openOIDC(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	blobs, err := openBlobStore(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
 	//create an instance of our application struct
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
+		config:      cfg,
+		logger:      logger,
+		models:      data.NewModels(db),
+		events:      newListEventHub(),
+		presence:    newPresenceRegistry(),
+		mailer:      mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		jwt:         keys,
+		revocations: newTokenRevocations(),
+		oidc:        provider,
+		oidcLogins:  newOIDCLogins(),
+		blobs:       blobs,
+		quit:        make(chan struct{}),
+	}
+	app.notifiers = map[string]Notifier{
+		data.ReminderEmail:   emailNotifier{mailer: app.mailer},
+		data.ReminderWebhook: webhookNotifier{client: &http.Client{Timeout: reminderTimeout}},
+	}
+	//start delivering queued webhook events in the background
+	app.background(app.dispatchWebhooks)
+	//pass list changes announced by postgres on to stream subscribers
+	app.background(app.listenForListEvents)
+	//send reminders as they fall due
+	app.background(app.scheduleReminders)
+	//signed tokens are checked against the revocations in memory, so they have to be there before we serve
+	if app.jwt != nil {
+		revoked, err := app.models.Members.GetTokenRevocations()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		app.revocations.replace(revoked)
+		go app.listenForTokenRevocations()
 	}
+	//remove the files of deleted attachments
+	app.background(app.sweepBlobs)
 	//create our new servemux
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
-	//create our HTTP server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-	}
-	//we start our server
-	logger.Printf("starting %s server on %s", cfg.env, srv.Addr)
-	err = srv.ListenAndServe()
-	logger.Fatal(err)
-
+	//start the server, serve() only returns once it has shut down
+	err = app.serve()
+	if err != nil {
+		logger.Fatal(err)
+	}
 }
 
 // openDB() function returns a *sql.DB connection pool
@@ -107,3 +215,41 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// openJWTKeys() reads the signing keys when signed tokens are turned on
+func openJWTKeys(cfg config) (*jwt.KeySet, error) {
+	switch cfg.auth.mode {
+	case "token":
+		return nil, nil
+	case "jwt":
+		return jwt.ParseKeys(cfg.auth.jwtKeys)
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.auth.mode)
+	}
+}
+
+// openOIDC() finds the sso provider when an issuer is given
+func openOIDC(cfg config) (*oidc.Provider, error) {
+	if cfg.oidc.issuer == "" {
+		return nil, nil
+	}
+	if cfg.oidc.clientID == "" {
+		return nil, errors.New("-oidc-issuer needs -oidc-client-id")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return oidc.Discover(ctx, cfg.oidc.issuer, cfg.oidc.clientID, cfg.oidc.clientSecret, cfg.oidc.redirectURL)
+}
+
+// openBlobStore() returns the store the config asks for attachments to be kept in
+func openBlobStore(cfg config) (storage.BlobStore, error) {
+	switch cfg.storage.backend {
+	case "local":
+		return storage.NewLocal(cfg.storage.dir)
+	case "s3":
+		s3 := cfg.storage.s3
+		return storage.NewS3(s3.endpoint, s3.region, s3.bucket, s3.accessKey, s3.secretKey), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
@@ -0,0 +1,216 @@
+//Filename: cmd/api/members.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// canManageRole() reports whether the caller may give someone the role or change someone who has it.
+// it takes an admin, and only an owner can make or change another owner
+func (app *application) canManageRole(r *http.Request, role string) bool {
+	c := app.contextGetCaller(r)
+	if !c.can(r, data.RoleAdmin) {
+		return false
+	}
+	return c.anonymous() || c.member.Role == data.RoleOwner || role != data.RoleOwner
+}
+
+// createMemberHandler for the "POST /v1/members" endpoint
+// the role defaults to member. the new member has no password, they choose one through a password reset sent to their email
+func (app *application) createMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	member := &data.Member{
+		WorkspaceID: app.contextGetWorkspace(r).ID,
+		Name:        input.Name,
+		Email:       input.Email,
+		Role:        data.RoleMember,
+	}
+	if input.Role != "" {
+		member.Role = input.Role
+	}
+	v := validator.New()
+	if data.ValidateMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.canManageRole(r, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.Members.Insert(member)
+	if err != nil {
+		app.memberSaveErrorResponse(w, r, v, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/members/%d", member.WorkspaceID, member.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// memberSaveErrorResponse() answers a failed insert or update of a member
+func (app *application) memberSaveErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateName):
+		v.AddError("name", "a member with this name already exists in the workspace")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrDuplicateEmail):
+		v.AddError("email", "a member with this email already exists in the workspace")
+		app.failedValidationResponse(w, r, v.Errors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMembersHandler for the "GET /v1/members" endpoint
+func (app *application) listMembersHandler(w http.ResponseWriter, r *http.Request) {
+	members, err := app.models.Members.GetAll(app.contextGetWorkspace(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMember() reads the :id parameter and fetches that member of the request's workspace.
+// it sends the error response itself and returns false if there is no such member
+func (app *application) readMember(w http.ResponseWriter, r *http.Request) (*data.Member, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	member, err := app.models.Members.Get(app.contextGetWorkspace(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return member, true
+}
+
+// showMemberHandler for the "GET /v1/members/:id" endpoint
+func (app *application) showMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.readMember(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// isCaller() reports whether the request was authenticated as the member.
+// a member's name and email are only changed by themselves, or anyone could point a password reset at their own inbox
+func (app *application) isCaller(r *http.Request, member *data.Member) bool {
+	c := app.contextGetCaller(r)
+	return !c.anonymous() && c.member.ID == member.ID
+}
+
+// updateMemberHandler for the "PATCH /v1/members/:id" endpoint
+// members change their own name and email, admins change roles
+func (app *application) updateMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.readMember(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+		Role  *string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if (input.Name != nil || input.Email != nil) && !app.isCaller(r, member) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	if input.Role != nil && !app.canManageRole(r, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	if input.Name != nil {
+		member.Name = *input.Name
+	}
+	if input.Email != nil {
+		member.Email = *input.Email
+	}
+	if input.Role != nil {
+		member.Role = *input.Role
+	}
+	v := validator.New()
+	if data.ValidateMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if input.Role != nil && !app.canManageRole(r, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.Members.Update(member)
+	if err != nil {
+		app.memberSaveErrorResponse(w, r, v, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMemberHandler for the "DELETE /v1/members/:id" endpoint
+// members can leave and admins can remove them, their tokens and api keys are revoked with them
+func (app *application) deleteMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member, ok := app.readMember(w, r)
+	if !ok {
+		return
+	}
+	if !app.isCaller(r, member) && !app.canManageRole(r, member.Role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err := app.models.Members.Delete(member.WorkspaceID, member.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,164 @@
+//Filename: cmd/api/middleware.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// inWorkspace() loads the workspace named by the ":ws" parameter and puts it in the request context.
+// the older routes without a ":ws" parameter use the caller's workspace, or the default one for anonymous requests
+func (app *application) inWorkspace(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		//a member's credentials only work in their own workspace, which is also where the older routes go for them
+		c := app.contextGetCaller(r)
+		id := int64(data.DefaultWorkspaceID)
+		if !c.anonymous() {
+			id = c.member.WorkspaceID
+		}
+		if param := httprouter.ParamsFromContext(r.Context()).ByName("ws"); param != "" {
+			var err error
+			id, err = strconv.ParseInt(param, 10, 64)
+			if err != nil || id < 1 {
+				app.notFoundResponse(w, r)
+				return
+			}
+		}
+		//the other workspaces have members of their own, so they always need credentials
+		if c.anonymous() && id != data.DefaultWorkspaceID {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		workspace, err := app.models.Workspaces.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		//reading needs any role and changing anything needs at least member, routes that need more are wrapped in requireRole()
+		if !c.anonymous() && c.member.WorkspaceID != workspace.ID {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		role := data.RoleMember
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			role = data.RoleViewer
+		}
+		if !c.can(r, role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next(w, app.contextSetWorkspace(r, workspace))
+	}
+}
+
+// requireRole() only lets callers with at least the given role through. it goes inside inWorkspace()
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.contextGetCaller(r).can(r, role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// the routes anyone can use without credentials, on top of the calendar feeds
+var publicPaths = map[string]bool{
+	"/v1/healthcheck":           true,
+	"/v1/tokens/authentication": true,
+	"/v1/tokens/password-reset": true,
+	"/v1/users/password":        true,
+	"/v1/auth/oidc/login":       true,
+	"/v1/auth/oidc/callback":    true,
+}
+
+// authenticate() reads the "Authorization" header and puts the member the credential belongs to in the request
+// context. it takes "Bearer <token>" with a token from POST /v1/tokens/authentication, and "ApiKey <key>" for scripts.
+// with -auth-mode=jwt the token is a signed one, which is checked without going to the database.
+// requests without the header are turned away unless -auth-required=false lets them carry on anonymously.
+// the healthcheck, calendar feeds and the routes for signing in and resetting a password never need it,
+// calendar apps can't send headers and neither does a browser signing in with sso
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			public := publicPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/v1/calendar/")
+			if app.config.auth.required && !public {
+				app.authenticationRequiredResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		scheme, credential, _ := strings.Cut(header, " ")
+		var c *caller
+		switch {
+		case scheme == "ApiKey" && data.ValidAPIKeyPlaintext(credential):
+			key, err := app.models.APIKeys.Use(credential)
+			if err != nil {
+				app.credentialErrorResponse(w, r, err)
+				return
+			}
+			c = &caller{member: key.Member, scopes: key.Scopes}
+		case scheme == "Bearer" && app.jwt != nil:
+			claims, err := app.jwt.Verify(credential, time.Now())
+			if err != nil {
+				app.invalidCredentialsResponse(w, r)
+				return
+			}
+			id, err := strconv.ParseInt(claims.Subject, 10, 64)
+			if err != nil || app.revocations.revoked(id, claims.IssuedAt) {
+				app.invalidCredentialsResponse(w, r)
+				return
+			}
+			//the member is as they were when the token was issued, a change of name or role shows once it runs out
+			member := &data.Member{ID: id, WorkspaceID: claims.Workspace, Name: claims.Name, Role: claims.Role}
+			c = &caller{member: member, scopes: strings.Fields(claims.Scope), token: true}
+		case scheme == "Bearer":
+			v := validator.New()
+			if data.ValidateTokenPlaintext(v, credential); !v.Valid() {
+				app.invalidCredentialsResponse(w, r)
+				return
+			}
+			member, err := app.models.Members.GetForToken(data.PurposeAuthentication, credential)
+			if err != nil {
+				app.credentialErrorResponse(w, r, err)
+				return
+			}
+			//signing in with a password gives the member everything they can do
+			c = &caller{member: member, scopes: []string{data.ScopeWrite}}
+		default:
+			app.invalidCredentialsResponse(w, r)
+			return
+		}
+		if !c.allows(r) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, app.contextSetCaller(r, c))
+	})
+}
+
+// credentialErrorResponse() answers a credential that couldn't be looked up
+func (app *application) credentialErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.invalidCredentialsResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
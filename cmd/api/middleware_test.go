@@ -0,0 +1,272 @@
+//Filename: cmd/api/middleware_test.go
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/jwt"
+)
+
+func TestCallerAllows(t *testing.T) {
+	member := func(scopes ...string) *caller {
+		return &caller{member: &data.Member{ID: 1, Name: "sam"}, scopes: scopes}
+	}
+	tests := []struct {
+		name   string
+		caller *caller
+		method string
+		want   bool
+	}{
+		{"anonymous", anonymousCaller, http.MethodDelete, true},
+		{"read only key reads", member(data.ScopeRead), http.MethodGet, true},
+		{"read only key writes", member(data.ScopeRead), http.MethodPost, false},
+		{"write scope reads", member(data.ScopeWrite), http.MethodGet, true},
+		{"write scope writes", member(data.ScopeWrite), http.MethodPatch, true},
+		{"no scopes", member(), http.MethodGet, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/v1/list", nil)
+		if got := tt.caller.allows(r); got != tt.want {
+			t.Errorf("%s: allows(%s) = %t; want %t", tt.name, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestCallerHasScope(t *testing.T) {
+	member := func(scopes ...string) *caller {
+		return &caller{member: &data.Member{ID: 1, Name: "sam"}, scopes: scopes}
+	}
+	tests := []struct {
+		name   string
+		caller *caller
+		scope  string
+		want   bool
+	}{
+		{"anonymous", anonymousCaller, data.ScopeWrite, true},
+		{"read only key", member(data.ScopeRead), data.ScopeWrite, false},
+		{"write takes in read", member(data.ScopeWrite), data.ScopeRead, true},
+		{"no scopes", member(), data.ScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.caller.hasScope(tt.scope); got != tt.want {
+			t.Errorf("%s: hasScope(%s) = %t; want %t", tt.name, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestInWorkspaceAnonymous(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	handler := app.inWorkspace(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("an anonymous caller reached another workspace")
+	})
+	//the default workspace is looked up first so only the others can be checked without a database
+	for _, path := range []string{"/v1/workspaces/2/list", "/v1/workspaces/2/members"} {
+		router := httprouter.New()
+		router.HandlerFunc(http.MethodGet, "/v1/workspaces/:ws/*rest", handler)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d; want 401", path, rr.Code)
+		}
+	}
+}
+
+func TestCallerCan(t *testing.T) {
+	member := func(role string, scopes ...string) *caller {
+		return &caller{member: &data.Member{ID: 1, WorkspaceID: 1, Name: "sam", Role: role}, scopes: scopes}
+	}
+	tests := []struct {
+		name   string
+		caller *caller
+		method string
+		role   string
+		want   bool
+	}{
+		{"anonymous", anonymousCaller, http.MethodDelete, data.RoleOwner, true},
+		{"viewer reads", member(data.RoleViewer, data.ScopeRead), http.MethodGet, data.RoleViewer, true},
+		{"viewer writes", member(data.RoleViewer, data.ScopeRead, data.ScopeWrite), http.MethodPost, data.RoleMember, false},
+		{"member writes", member(data.RoleMember, data.ScopeWrite), http.MethodPatch, data.RoleMember, true},
+		{"write scope reads", member(data.RoleMember, data.ScopeWrite), http.MethodGet, data.RoleViewer, true},
+		{"read only key writes", member(data.RoleOwner, data.ScopeRead), http.MethodPost, data.RoleMember, false},
+		{"member manages", member(data.RoleMember, data.ScopeWrite), http.MethodPost, data.RoleAdmin, false},
+		{"admin manages", member(data.RoleAdmin, data.ScopeWrite), http.MethodPost, data.RoleAdmin, true},
+		{"admin deletes the workspace", member(data.RoleAdmin, data.ScopeWrite), http.MethodDelete, data.RoleOwner, false},
+		{"owner deletes the workspace", member(data.RoleOwner, data.ScopeWrite), http.MethodDelete, data.RoleOwner, true},
+		{"no scopes", member(data.RoleOwner), http.MethodGet, data.RoleViewer, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/v1/list", nil)
+		if got := tt.caller.can(r, tt.role); got != tt.want {
+			t.Errorf("%s: can(%s, %s) = %t; want %t", tt.name, tt.method, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	var reached *caller
+	handler := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = app.contextGetCaller(r)
+	}))
+
+	tests := []struct {
+		name          string
+		required      bool
+		path          string
+		authorization string
+		status        int
+	}{
+		{"open", false, "/v1/list", "", http.StatusOK},
+		{"required", true, "/v1/list", "", http.StatusUnauthorized},
+		{"healthcheck", true, "/v1/healthcheck", "", http.StatusOK},
+		{"calendar feed", true, "/v1/calendar/abc.ics", "", http.StatusOK},
+		{"sign in", true, "/v1/tokens/authentication", "", http.StatusOK},
+		{"password reset", true, "/v1/users/password", "", http.StatusOK},
+		{"sso sign in", true, "/v1/auth/oidc/login", "", http.StatusOK},
+		{"sso callback", true, "/v1/auth/oidc/callback", "", http.StatusOK},
+		{"calendar tokens", true, "/v1/tokens/calendar", "", http.StatusUnauthorized},
+		{"other scheme", false, "/v1/list", "Basic abc", http.StatusUnauthorized},
+		{"malformed token", false, "/v1/list", "Bearer abc", http.StatusUnauthorized},
+		{"malformed key", false, "/v1/list", "ApiKey todo_abc", http.StatusUnauthorized},
+		{"no key", false, "/v1/list", "ApiKey", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		reached = nil
+		app.config.auth.required = tt.required
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d; want %d", tt.name, rr.Code, tt.status)
+		}
+		if tt.status == http.StatusOK && (reached == nil || !reached.anonymous()) {
+			t.Errorf("%s: the handler did not see an anonymous caller", tt.name)
+		}
+		if tt.status == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s: got WWW-Authenticate %q; want Bearer", tt.name, rr.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthenticateBearer(t *testing.T) {
+	keys, err := jwt.ParseKeys("a:HS256:" + base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("s", 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{logger: log.New(io.Discard, "", 0), jwt: keys, revocations: newTokenRevocations()}
+	sam := &caller{member: &data.Member{ID: 7, WorkspaceID: 2, Name: "sam", Role: data.RoleMember}, scopes: []string{data.ScopeRead, data.ScopeWrite}}
+
+	//swap the api key caller for a read only token
+	r := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(`{"scopes": ["read"]}`))
+	rr := httptest.NewRecorder()
+	app.createAuthenticationTokenHandler(rr, app.contextSetCaller(r, sam))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusCreated, rr.Body)
+	}
+	var body struct {
+		Token struct {
+			Token string `json:"token"`
+		} `json:"authentication_token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	var reached *caller
+	handler := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = app.contextGetCaller(r)
+	}))
+	r = httptest.NewRequest(http.MethodGet, "/v1/list", nil)
+	r.Header.Set("Authorization", "Bearer "+body.Token.Token)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK || reached == nil {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if reached.member.ID != sam.member.ID || reached.member.WorkspaceID != 2 || reached.member.Role != data.RoleMember || !reached.token || len(reached.scopes) != 1 || reached.scopes[0] != data.ScopeRead {
+		t.Errorf("got caller %+v, member %+v", reached, reached.member)
+	}
+
+	//a token can't ask for more than the key had, or be swapped for another token.
+	//without credentials a password is needed
+	tests := []struct {
+		name   string
+		caller *caller
+		body   string
+		status int
+	}{
+		{"anonymous", anonymousCaller, "", http.StatusUnprocessableEntity},
+		{"token", reached, "", http.StatusForbidden},
+		{"wider scopes", &caller{member: sam.member, scopes: []string{data.ScopeRead}}, `{"scopes": ["write"]}`, http.StatusUnprocessableEntity},
+		{"no scopes", sam, `{"scopes": []}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		app.createAuthenticationTokenHandler(rr, app.contextSetCaller(r, tt.caller))
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d; want %d", tt.name, rr.Code, tt.status)
+		}
+	}
+
+	for _, token := range []string{"abc", body.Token.Token + "x"} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/list", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: got status %d; want %d", token, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	//once sam's tokens are revoked the token stops working
+	app.revocations.set(sam.member.ID, time.Now())
+	r = httptest.NewRequest(http.MethodGet, "/v1/list", nil)
+	r.Header.Set("Authorization", "Bearer "+body.Token.Token)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("a revoked token: got status %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestTokenRevocations(t *testing.T) {
+	tr := newTokenRevocations()
+	revokedAt := time.Unix(1700000000, 0)
+	tr.set(1, revokedAt)
+	//an older revocation doesn't undo a newer one, and a removed member is remembered past a reload
+	tr.set(1, revokedAt.Add(-time.Hour))
+	tr.set(2, revokedAt)
+	tr.replace(map[int64]time.Time{1: revokedAt})
+
+	tests := []struct {
+		member   int64
+		issuedAt int64
+		want     bool
+	}{
+		{1, revokedAt.Unix() - 1, true},
+		{1, revokedAt.Unix(), true},
+		{1, revokedAt.Unix() + 1, false},
+		{2, revokedAt.Unix() - 1, true},
+		{3, revokedAt.Unix() - 1, false},
+	}
+	for _, tt := range tests {
+		if got := tr.revoked(tt.member, tt.issuedAt); got != tt.want {
+			t.Errorf("revoked(%d, %d) = %t; want %t", tt.member, tt.issuedAt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+//Filename: cmd/api/notifier.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/mailer"
+)
+
+// a Notifier sends a reminder about a list over one channel
+type Notifier interface {
+	Notify(reminder *data.Reminder, list *data.List) error
+}
+
+// emailNotifier emails the reminder to its target address using the reminder.tmpl template
+type emailNotifier struct {
+	mailer mailer.Mailer
+}
+
+func (n emailNotifier) Notify(reminder *data.Reminder, list *data.List) error {
+	return n.mailer.Send(reminder.Target, "reminder.tmpl", map[string]interface{}{
+		"Reminder": reminder,
+		"List":     list,
+	})
+}
+
+// webhookNotifier POSTs the reminder and the list as JSON to the target url
+type webhookNotifier struct {
+	client *http.Client
+}
+
+func (n webhookNotifier) Notify(reminder *data.Reminder, list *data.List) error {
+	payload, err := json.Marshal(envelope{
+		"event":       "list.reminder",
+		"occurred_at": time.Now().UTC(),
+		"reminder":    reminder,
+		"list":        list,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, reminder.Target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "todo-reminders/"+version)
+	req.Header.Set("X-Todo-Event", "list.reminder")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+//Filename: cmd/api/notifier_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/mailer"
+)
+
+// smtpStandIn is just enough of an SMTP server to accept mail from mailer.Mailer.
+// rcptReplies are used in turn to answer RCPT commands, after that every recipient is accepted
+type smtpStandIn struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	rcptReplies []string
+	connections int
+	messages    []string
+}
+
+func newSMTPStandIn(t *testing.T, rcptReplies ...string) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{listener: listener, rcptReplies: rcptReplies}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb := strings.ToUpper(strings.Fields(line + " ")[0]); verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			reply := "250 OK"
+			s.mu.Lock()
+			if len(s.rcptReplies) > 0 {
+				reply, s.rcptReplies = s.rcptReplies[0], s.rcptReplies[1:]
+			}
+			s.mu.Unlock()
+			tp.PrintfLine("%s", reply)
+		case "DATA":
+			tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, strings.Join(lines, "\n"))
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	reminder := &data.Reminder{Channel: data.ReminderEmail, Target: "alice@example.com"}
+	list := &data.List{Name: "Home", Task: "Water the plants", Status: "todo"}
+
+	t.Run("sent", func(t *testing.T) {
+		server := newSMTPStandIn(t)
+		notifier := emailNotifier{mailer: mailer.New("127.0.0.1", server.port(), "", "", "Todo <no-reply@example.com>")}
+		err := notifier.Notify(reminder, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(server.messages) != 1 {
+			t.Fatalf("got %d messages; want 1", len(server.messages))
+		}
+		msg := server.messages[0]
+		for _, want := range []string{"To: alice@example.com", "Subject: Reminder: Water the plants", "Task: Water the plants"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("message does not contain %q:\n%s", want, msg)
+			}
+		}
+	})
+
+	t.Run("temporary failure is retried", func(t *testing.T) {
+		server := newSMTPStandIn(t, "451 try again later")
+		notifier := emailNotifier{mailer: mailer.New("127.0.0.1", server.port(), "", "", "no-reply@example.com")}
+		err := notifier.Notify(reminder, list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if server.connections != 2 || len(server.messages) != 1 {
+			t.Errorf("got %d connections and %d messages; want 2 and 1", server.connections, len(server.messages))
+		}
+	})
+
+	t.Run("permanent failure is not retried", func(t *testing.T) {
+		server := newSMTPStandIn(t, "550 no such mailbox")
+		notifier := emailNotifier{mailer: mailer.New("127.0.0.1", server.port(), "", "", "no-reply@example.com")}
+		err := notifier.Notify(reminder, list)
+		if err == nil || !strings.Contains(err.Error(), "no such mailbox") {
+			t.Fatalf("got error %v", err)
+		}
+		if server.connections != 1 {
+			t.Errorf("got %d connections; want 1", server.connections)
+		}
+	})
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var event string
+	var body struct {
+		Event    string        `json:"event"`
+		Reminder data.Reminder `json:"reminder"`
+		List     data.List     `json:"list"`
+	}
+	status := http.StatusNoContent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event = r.Header.Get("X-Todo-Event")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	notifier := webhookNotifier{client: &http.Client{Timeout: time.Second}}
+	reminder := &data.Reminder{ID: 3, Channel: data.ReminderWebhook, Target: ts.URL + "/remind"}
+	list := &data.List{ID: 9, Task: "Water the plants"}
+
+	err := notifier.Notify(reminder, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event != "list.reminder" || body.Event != "list.reminder" || body.Reminder.ID != 3 || body.List.ID != 9 {
+		t.Errorf("got event %q and body %+v", event, body)
+	}
+
+	status = http.StatusInternalServerError
+	err = notifier.Notify(reminder, list)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("got error %v; want the 500 response", err)
+	}
+}
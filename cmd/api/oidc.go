@@ -0,0 +1,171 @@
+//Filename: cmd/api/oidc.go
+
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/oidc"
+	"todo.joelical.net/internal/validator"
+)
+
+// how long someone has to sign in at the provider before the login is forgotten
+const oidcLoginTTL = 10 * time.Minute
+
+// the cookie holding the state of the browser's sign in. the callback only goes ahead in the browser that started it,
+// so nobody can send someone else to our callback with their own code and sign them in as themselves
+const oidcStateCookie = "oidc_state"
+
+// logins anyone can start, so the number waiting is capped to keep memory bounded
+const oidcMaxPendingLogins = 10000
+
+// a pendingLogin is a sign in that was sent to the provider and hasn't come back yet
+type pendingLogin struct {
+	login       *oidc.Login
+	workspaceID int64
+	expires     time.Time
+}
+
+// oidcLogins keeps the pending logins on this server by their state
+type oidcLogins struct {
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+func newOIDCLogins() *oidcLogins {
+	return &oidcLogins{pending: make(map[string]pendingLogin)}
+}
+
+// add() remembers a login, it returns false when too many are waiting
+func (o *oidcLogins) add(p pendingLogin, now time.Time) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for state, old := range o.pending {
+		if now.After(old.expires) {
+			delete(o.pending, state)
+		}
+	}
+	if len(o.pending) >= oidcMaxPendingLogins {
+		return false
+	}
+	o.pending[p.login.State] = p
+	return true
+}
+
+// take() returns the login with the state and forgets it, so a callback can't be replayed
+func (o *oidcLogins) take(state string, now time.Time) (pendingLogin, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, ok := o.pending[state]
+	delete(o.pending, state)
+	if !ok || now.After(p.expires) {
+		return pendingLogin{}, false
+	}
+	return p, true
+}
+
+// oidcLoginHandler for the "GET /v1/auth/oidc/login" endpoint.
+// it sends the browser to the provider to sign in, ?workspace= picks the workspace to sign in to
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	workspaceID := app.readInt(r.URL.Query(), "workspace", int(data.DefaultWorkspaceID), v)
+	v.Check(workspaceID > 0, "workspace", "must be a positive integer")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	login, err := oidc.NewLogin()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	now := time.Now()
+	if !app.oidcLogins.add(pendingLogin{login: login, workspaceID: int64(workspaceID), expires: now.Add(oidcLoginTTL)}, now) {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "too many sign ins are in progress, try again in a few minutes")
+		return
+	}
+	app.setOIDCStateCookie(w, login.State, oidcLoginTTL)
+	http.Redirect(w, r, app.oidc.AuthURL(login), http.StatusFound)
+}
+
+// setOIDCStateCookie() sets the state cookie, or clears it with an empty state.
+// Lax still sends it when the provider redirects back to us
+func (app *application) setOIDCStateCookie(w http.ResponseWriter, state string, ttl time.Duration) {
+	maxAge := int(ttl.Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/v1/auth/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(app.config.oidc.redirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oidcCallbackHandler for the "GET /v1/auth/oidc/callback" endpoint, where the provider sends the browser back.
+// the provider's subject is matched to a member, or on their first sign in their verified email is.
+// members aren't created here, an admin adds them first so they get a role
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(qs.Get("state"))) != 1 {
+		app.badRequestResponse(w, r, errors.New("this sign in was not started in this browser, start again"))
+		return
+	}
+	app.setOIDCStateCookie(w, "", 0)
+	if qs.Get("error") != "" {
+		app.errorResponse(w, r, http.StatusUnauthorized, "sign in failed: "+qs.Get("error")+" "+qs.Get("error_description"))
+		return
+	}
+	pending, ok := app.oidcLogins.take(qs.Get("state"), time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, errors.New("unknown or expired sign in, start again"))
+		return
+	}
+	raw, err := app.oidc.Exchange(r.Context(), qs.Get("code"), pending.login)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrCodeRejected):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	token, err := app.oidc.Verify(r.Context(), raw, pending.login, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidToken):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	member, err := app.models.Members.GetBySubject(pending.workspaceID, token.Subject)
+	//an unverified email could be anyone's, so it is only trusted when the provider says it checked it
+	if errors.Is(err, data.ErrRecordNotFound) && token.Email != "" && token.EmailVerified {
+		member, err = app.models.Members.LinkSubject(pending.workspaceID, token.Email, token.Subject)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusForbidden, "you are not a member of this workspace, ask an admin to add your email")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeAuthenticationToken(w, r, http.StatusOK, member, []string{data.ScopeWrite})
+}
@@ -0,0 +1,88 @@
+//Filename: cmd/api/oidc_test.go
+
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/oidc"
+)
+
+func TestOIDCLogins(t *testing.T) {
+	logins := newOIDCLogins()
+	now := time.Now()
+	login, err := oidc.NewLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !logins.add(pendingLogin{login: login, expires: now.Add(oidcLoginTTL)}, now) {
+		t.Fatal("the login was not added")
+	}
+	if _, ok := logins.take("someone else's state", now); ok {
+		t.Error("an unknown state was found")
+	}
+	p, ok := logins.take(login.State, now)
+	if !ok || p.login != login {
+		t.Errorf("got login %+v, %t; want the login", p, ok)
+	}
+	//a callback can't be replayed
+	if _, ok := logins.take(login.State, now); ok {
+		t.Error("the login was taken twice")
+	}
+
+	late, _ := oidc.NewLogin()
+	logins.add(pendingLogin{login: late, expires: now.Add(oidcLoginTTL)}, now)
+	if _, ok := logins.take(late.State, now.Add(oidcLoginTTL+time.Second)); ok {
+		t.Error("an expired login was taken")
+	}
+}
+
+func TestOIDCStateCookie(t *testing.T) {
+	app := &application{
+		logger:     log.New(io.Discard, "", 0),
+		oidc:       &oidc.Provider{AuthorizationEndpoint: "https://idp.example.com/authorize"},
+		oidcLogins: newOIDCLogins(),
+	}
+	rr := httptest.NewRecorder()
+	app.oidcLoginHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusFound)
+	}
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || cookies[0].Value != state || !cookies[0].HttpOnly {
+		t.Fatalf("got cookies %+v; want an HttpOnly %s cookie holding %q", cookies, oidcStateCookie, state)
+	}
+
+	//the provider sends an error back, so the exchange with it is never reached
+	tests := []struct {
+		name   string
+		cookie string
+		status int
+	}{
+		{"no cookie", "", http.StatusBadRequest},
+		{"another browser's state", "someone-elses-state", http.StatusBadRequest},
+		{"same browser", state, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/auth/oidc/callback?error=access_denied&state="+url.QueryEscape(state), nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+		}
+		rr := httptest.NewRecorder()
+		app.oidcCallbackHandler(rr, r)
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d; want %d", tt.name, rr.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//Filename: cmd/api/revocations.go
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/data"
+)
+
+// tokenRevocations remembers when each member's signed tokens were last revoked, so the authenticate()
+// middleware can turn down a signed token issued before then without going to the database
+type tokenRevocations struct {
+	mu sync.RWMutex
+	at map[int64]time.Time
+}
+
+func newTokenRevocations() *tokenRevocations {
+	return &tokenRevocations{at: make(map[int64]time.Time)}
+}
+
+// set() records a revocation, an older one than we already know about changes nothing
+func (tr *tokenRevocations) set(memberID int64, at time.Time) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if at.After(tr.at[memberID]) {
+		tr.at[memberID] = at
+	}
+}
+
+// replace() swaps in every revocation read from the database
+func (tr *tokenRevocations) replace(at map[int64]time.Time) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for id, t := range tr.at {
+		//a removed member isn't in the database any more, keep what we heard about them
+		if _, ok := at[id]; !ok {
+			at[id] = t
+		}
+	}
+	tr.at = at
+}
+
+// revoked() reports whether a token issued to the member at issuedAt has been revoked.
+// token times are in whole seconds, so one issued in the same second as a revocation counts as revoked
+func (tr *tokenRevocations) revoked(memberID int64, issuedAt int64) bool {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	at, ok := tr.at[memberID]
+	return ok && issuedAt <= at.Unix()
+}
+
+// listenForTokenRevocations() runs in the background with -auth-mode=jwt. it loads the revocations
+// and then keeps them up to date from the NOTIFYs sent when a member's tokens are revoked
+func (app *application) listenForTokenRevocations() {
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.Println(err)
+		}
+	})
+	err := listener.Listen(data.TokensRevokedChannel)
+	if err != nil {
+		app.logger.Println(err)
+		return
+	}
+	app.loadTokenRevocations()
+
+	for {
+		select {
+		//a nil notification means the connection was re-established and we may have missed some
+		case n := <-listener.Notify:
+			if n == nil {
+				app.loadTokenRevocations()
+				continue
+			}
+			id, at, ok := strings.Cut(n.Extra, " ")
+			memberID, err := strconv.ParseInt(id, 10, 64)
+			seconds, err2 := strconv.ParseInt(at, 10, 64)
+			if !ok || err != nil || err2 != nil {
+				app.logger.Printf("bad token revocation %q", n.Extra)
+				continue
+			}
+			app.revocations.set(memberID, time.Unix(seconds, 0))
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// loadTokenRevocations() reads every revocation from the database
+func (app *application) loadTokenRevocations() {
+	at, err := app.models.Members.GetTokenRevocations()
+	if err != nil {
+		app.logger.Println(err)
+		return
+	}
+	app.revocations.replace(at)
+}
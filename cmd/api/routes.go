@@ -6,20 +6,118 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"todo.joelical.net/internal/data"
 )
 
-// create a method that returns a http router
-func (app *application) routes() *httprouter.Router {
+// create a method that returns the http handler for the api, the router wrapped in our middleware
+func (app *application) routes() http.Handler {
 	//Create a new httrouter router instance
 	router := httprouter.New()
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedesponse)
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/list", app.displayListHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/list", app.createListHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/list/:id", app.showListHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/list/:id", app.updateListHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/list/:id", app.deleteListHandler)
+	//every list belongs to a workspace. the routes are served under /v1/workspaces/:ws and also
+	//at their original paths, where inWorkspace() picks the default workspace
+	for _, prefix := range []string{"/v1", "/v1/workspaces/:ws"} {
+		router.HandlerFunc(http.MethodGet, prefix+"/list", app.inWorkspace(app.displayListHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list", app.inWorkspace(app.createListHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id", app.inWorkspace(app.listPostRoutes))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id", app.inWorkspace(app.listGetRoutes))
+		router.HandlerFunc(http.MethodPatch, prefix+"/list/:id", app.inWorkspace(app.updateListHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id", app.inWorkspace(app.deleteListHandler))
+		router.HandlerFunc(http.MethodPatch, prefix+"/list/:id/move", app.inWorkspace(app.moveListHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/subtasks", app.inWorkspace(app.listSubtasksHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/dependencies", app.inWorkspace(app.listDependenciesHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/dependencies", app.inWorkspace(app.createDependencyHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id/dependencies/:blocked_by_id", app.inWorkspace(app.deleteDependencyHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/graph", app.inWorkspace(app.graphHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/revisions", app.inWorkspace(app.listRevisionsHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/revisions/:version", app.inWorkspace(app.showRevisionHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/revert", app.inWorkspace(app.revertListHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/ws", app.inWorkspace(app.collabListHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/reminders", app.inWorkspace(app.listRemindersHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/reminders", app.inWorkspace(app.createReminderHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id/reminders/:reminder_id", app.inWorkspace(app.deleteReminderHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/comments", app.inWorkspace(app.listCommentsHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/comments", app.inWorkspace(app.createCommentHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/comments/:comment_id", app.inWorkspace(app.showCommentHandler))
+		router.HandlerFunc(http.MethodPatch, prefix+"/list/:id/comments/:comment_id", app.inWorkspace(app.updateCommentHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id/comments/:comment_id", app.inWorkspace(app.deleteCommentHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/attachments", app.inWorkspace(app.listAttachmentsHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/attachments", app.inWorkspace(app.createAttachmentHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/attachments/:attachment_id", app.inWorkspace(app.downloadAttachmentHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id/attachments/:attachment_id", app.inWorkspace(app.deleteAttachmentHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/timer/start", app.inWorkspace(app.startTimerHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/timer/stop", app.inWorkspace(app.stopTimerHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/list/:id/time-entries", app.inWorkspace(app.listTimeEntriesHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/list/:id/time-entries", app.inWorkspace(app.createTimeEntryHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/list/:id/time-entries/:entry_id", app.inWorkspace(app.deleteTimeEntryHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/board", app.inWorkspace(app.showBoardHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/board/columns", app.inWorkspace(app.showBoardColumnsHandler))
+		router.HandlerFunc(http.MethodPut, prefix+"/board/columns", app.inWorkspace(app.updateBoardColumnsHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/stats", app.inWorkspace(app.showStatsHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/reports/time", app.inWorkspace(app.timeReportHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/tokens/calendar", app.inWorkspace(app.listCalendarTokensHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/tokens/calendar", app.inWorkspace(app.createCalendarTokenHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/tokens/calendar/:id", app.inWorkspace(app.deleteCalendarTokenHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/sync", app.inWorkspace(app.pullSyncHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/sync", app.inWorkspace(app.pushSyncHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/members", app.inWorkspace(app.listMembersHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/members", app.inWorkspace(app.requireRole(data.RoleAdmin, app.createMemberHandler)))
+		router.HandlerFunc(http.MethodGet, prefix+"/members/:id", app.inWorkspace(app.showMemberHandler))
+		router.HandlerFunc(http.MethodPatch, prefix+"/members/:id", app.inWorkspace(app.updateMemberHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/members/:id", app.inWorkspace(app.deleteMemberHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/members/:id/api-keys", app.inWorkspace(app.revokeMemberAPIKeysHandler))
+		router.HandlerFunc(http.MethodGet, prefix+"/api-keys", app.inWorkspace(app.listAPIKeysHandler))
+		router.HandlerFunc(http.MethodPost, prefix+"/api-keys", app.inWorkspace(app.createAPIKeyHandler))
+		router.HandlerFunc(http.MethodDelete, prefix+"/api-keys/:id", app.inWorkspace(app.deleteAPIKeyHandler))
+		//webhooks carry every change in the workspace to another server, so only admins manage them
+		router.HandlerFunc(http.MethodGet, prefix+"/webhooks", app.inWorkspace(app.requireRole(data.RoleAdmin, app.listWebhooksHandler)))
+		router.HandlerFunc(http.MethodPost, prefix+"/webhooks", app.inWorkspace(app.requireRole(data.RoleAdmin, app.createWebhookHandler)))
+		router.HandlerFunc(http.MethodGet, prefix+"/webhooks/:id", app.inWorkspace(app.requireRole(data.RoleAdmin, app.showWebhookHandler)))
+		router.HandlerFunc(http.MethodPatch, prefix+"/webhooks/:id", app.inWorkspace(app.requireRole(data.RoleAdmin, app.updateWebhookHandler)))
+		router.HandlerFunc(http.MethodDelete, prefix+"/webhooks/:id", app.inWorkspace(app.requireRole(data.RoleAdmin, app.deleteWebhookHandler)))
+		router.HandlerFunc(http.MethodGet, prefix+"/webhooks/:id/deliveries", app.inWorkspace(app.requireRole(data.RoleAdmin, app.listDeliveriesHandler)))
+	}
+	//the caller's own workspace
+	router.HandlerFunc(http.MethodGet, "/v1/me/tasks", app.inWorkspace(app.myTasksHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces", app.listWorkspacesHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces", app.createWorkspaceHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:ws", app.inWorkspace(app.showWorkspaceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:ws", app.inWorkspace(app.requireRole(data.RoleAdmin, app.updateWorkspaceHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:ws", app.inWorkspace(app.requireRole(data.RoleOwner, app.deleteWorkspaceHandler)))
+	//the feed token decides the workspace
+	router.HandlerFunc(http.MethodGet, "/v1/calendar/:token", app.calendarFeedHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updatePasswordHandler)
+	if app.oidc != nil {
+		router.HandlerFunc(http.MethodGet, "/v1/auth/oidc/login", app.oidcLoginHandler)
+		router.HandlerFunc(http.MethodGet, "/v1/auth/oidc/callback", app.oidcCallbackHandler)
+	}
 
-	return router
+	return app.authenticate(router)
+}
+
+// httprouter won't let a fixed path segment share a position with the :id wildcard,
+// so the fixed GET /v1/list/... paths are picked out here before falling back to showListHandler
+func (app *application) listGetRoutes(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("id") {
+	case "stream":
+		app.streamListHandler(w, r)
+	case "export":
+		app.exportListHandler(w, r)
+	default:
+		app.showListHandler(w, r)
+	}
+}
+
+// the same applies to POST /v1/list/import and the POST /v1/list/:id/... routes
+func (app *application) listPostRoutes(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("id") {
+	case "import":
+		app.importListHandler(w, r)
+	default:
+		app.methodNotAllowedesponse(w, r)
+	}
 }
@@ -0,0 +1,102 @@
+//Filename: cmd/api/scheduler.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+// settings for the reminder scheduler
+const (
+	reminderPollInterval = 5 * time.Second
+	reminderBatchSize    = 20
+	reminderTimeout      = 30 * time.Second
+	reminderMaxAttempts  = 5
+	reminderRetryDelay   = time.Minute
+)
+
+// scheduleReminders() runs in the background and sends reminders once they are due, until the server shuts down.
+// every replica can run it, ClaimDue() makes sure each reminder is only picked up once
+func (app *application) scheduleReminders() {
+	ticker := time.NewTicker(reminderPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.quit:
+			return
+		case <-ticker.C:
+		}
+		//the lease must outlast a full batch of slow notifiers
+		reminders, err := app.models.Reminders.ClaimDue(reminderBatchSize, reminderBatchSize*reminderTimeout+time.Minute)
+		if err != nil {
+			app.logger.Println(err)
+			continue
+		}
+		//each reminder is sent in its own goroutine so one slow mail server doesn't hold up the batch
+		for _, reminder := range reminders {
+			reminder := reminder
+			app.background(func() {
+				app.sendReminder(reminder)
+			})
+		}
+	}
+}
+
+// sendReminder() makes one attempt at sending a reminder and records the outcome
+func (app *application) sendReminder(reminder *data.Reminder) {
+	list, err := app.models.List.Get(reminder.WorkspaceID, reminder.ListID)
+	if err != nil {
+		//a deleted list takes its reminders with it
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.Println(err)
+		}
+		return
+	}
+	app.attemptReminder(reminder, list)
+	err = app.models.Reminders.RecordAttempt(reminder)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logger.Println(err)
+	}
+}
+
+// attemptReminder() sends the reminder unless the list is already done, and updates the
+// reminder's status, error and next attempt time to match the outcome
+func (app *application) attemptReminder(reminder *data.Reminder, list *data.List) {
+	reminder.LastError = ""
+	switch {
+	case list.Done():
+		reminder.Status = data.ReminderSkipped
+	default:
+		reminder.Attempts++
+		err := app.notify(reminder, list)
+		switch {
+		case err == nil:
+			now := time.Now()
+			reminder.Status = data.ReminderSent
+			reminder.SentAt = &now
+		case reminder.Attempts >= reminderMaxAttempts:
+			reminder.Status = data.ReminderFailed
+			reminder.LastError = err.Error()
+		default:
+			reminder.LastError = err.Error()
+			reminder.NextAttemptAt = time.Now().Add(time.Duration(reminder.Attempts) * reminderRetryDelay)
+		}
+	}
+	if reminder.NextAttemptAt.IsZero() {
+		reminder.NextAttemptAt = time.Now()
+	}
+}
+
+// notify() hands the reminder to the notifier for its channel
+func (app *application) notify(reminder *data.Reminder, list *data.List) error {
+	notifier, ok := app.notifiers[reminder.Channel]
+	if !ok {
+		return fmt.Errorf("no notifier for the %q channel", reminder.Channel)
+	}
+	return notifier.Notify(reminder, list)
+}
@@ -0,0 +1,78 @@
+//Filename: cmd/api/scheduler_test.go
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+// a stubNotifier records the reminders it is asked to send and fails with err
+type stubNotifier struct {
+	sent []*data.Reminder
+	err  error
+}
+
+func (n *stubNotifier) Notify(reminder *data.Reminder, list *data.List) error {
+	n.sent = append(n.sent, reminder)
+	return n.err
+}
+
+func TestAttemptReminder(t *testing.T) {
+	notifier := &stubNotifier{}
+	app := &application{notifiers: map[string]Notifier{data.ReminderWebhook: notifier}}
+	open := &data.List{Status: "todo"}
+
+	t.Run("sent", func(t *testing.T) {
+		reminder := &data.Reminder{Channel: data.ReminderWebhook, Status: data.ReminderPending}
+		app.attemptReminder(reminder, open)
+		if reminder.Status != data.ReminderSent || reminder.SentAt == nil || reminder.Attempts != 1 {
+			t.Errorf("got status %q, sent at %v after %d attempts", reminder.Status, reminder.SentAt, reminder.Attempts)
+		}
+		if len(notifier.sent) != 1 || notifier.sent[0] != reminder {
+			t.Errorf("notifier was called %d times", len(notifier.sent))
+		}
+	})
+
+	t.Run("skipped when done", func(t *testing.T) {
+		notifier.sent = nil
+		reminder := &data.Reminder{Channel: data.ReminderWebhook, Status: data.ReminderPending}
+		app.attemptReminder(reminder, &data.List{Status: "Done"})
+		if reminder.Status != data.ReminderSkipped || reminder.Attempts != 0 || len(notifier.sent) != 0 {
+			t.Errorf("got status %q after %d attempts and %d sends", reminder.Status, reminder.Attempts, len(notifier.sent))
+		}
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		notifier.err = errors.New("receiver responded with 503 Service Unavailable")
+		reminder := &data.Reminder{Channel: data.ReminderWebhook, Status: data.ReminderPending, Attempts: 1}
+		before := time.Now()
+		app.attemptReminder(reminder, open)
+		if reminder.Status != data.ReminderPending || reminder.LastError != notifier.err.Error() {
+			t.Errorf("got status %q and error %q", reminder.Status, reminder.LastError)
+		}
+		wait := reminder.NextAttemptAt.Sub(before)
+		if wait < 2*reminderRetryDelay || wait > 2*reminderRetryDelay+time.Second {
+			t.Errorf("next attempt in %s; want %s", wait, 2*reminderRetryDelay)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		reminder := &data.Reminder{Channel: data.ReminderWebhook, Status: data.ReminderPending, Attempts: reminderMaxAttempts - 1}
+		app.attemptReminder(reminder, open)
+		if reminder.Status != data.ReminderFailed || reminder.LastError == "" {
+			t.Errorf("got status %q and error %q", reminder.Status, reminder.LastError)
+		}
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		reminder := &data.Reminder{Channel: data.ReminderEmail, Status: data.ReminderPending}
+		app.attemptReminder(reminder, open)
+		if reminder.Status != data.ReminderPending || reminder.LastError != `no notifier for the "email" channel` {
+			t.Errorf("got status %q and error %q", reminder.Status, reminder.LastError)
+		}
+	})
+}
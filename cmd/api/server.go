@@ -0,0 +1,88 @@
+//Filename: cmd/api/server.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve() runs the HTTP server until it receives SIGINT or SIGTERM, then shuts down gracefully:
+// in-flight requests are given time to finish and the background workers and email sends are waited for
+func (app *application) serve() error {
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Handler:      app.routes(),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+		//keep the connection in the request context so upload handlers can extend its deadlines
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connContextKey, c)
+		},
+	}
+	shutdownError := make(chan error)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+		app.logger.Printf("shutting down server, signal: %s", s)
+
+		//tell the workers to stop once their current batch is done. event streams and collaboration
+		//channels close too, otherwise they would hold Shutdown() open until they time out
+		close(app.quit)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		//queued work is waited for even if some requests didn't finish in time
+		app.logger.Println("completing background tasks")
+		app.wg.Wait()
+		shutdownError <- err
+	}()
+
+	app.logger.Printf("starting %s server on %s", app.config.env, srv.Addr)
+	err := srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	err = <-shutdownError
+	if err != nil {
+		return err
+	}
+	app.logger.Println("stopped server")
+	return nil
+}
+
+// extendDeadlines() gives a request longer than the server's ReadTimeout and WriteTimeout, for uploads
+// that can take a while to arrive over a slow connection. the server resets the deadlines for the next request
+func (app *application) extendDeadlines(r *http.Request, timeout time.Duration) {
+	conn, ok := r.Context().Value(connContextKey).(net.Conn)
+	if !ok {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+}
+
+// background() runs fn in a goroutine that graceful shutdown waits for.
+// a panic is logged rather than taking the server down
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Println(fmt.Errorf("%s", err))
+			}
+		}()
+		fn()
+	}()
+}
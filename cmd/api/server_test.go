@@ -0,0 +1,63 @@
+//Filename: cmd/api/server_test.go
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExtendDeadlines(t *testing.T) {
+	app := &application{}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload" {
+			app.extendDeadlines(r, 5*time.Second)
+		}
+		n, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestTimeout)
+			return
+		}
+		w.Write([]byte(strconv.FormatInt(n, 10)))
+	}))
+	ts.Config.ReadTimeout = 200 * time.Millisecond
+	ts.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connContextKey, c)
+	}
+	ts.Start()
+	defer ts.Close()
+
+	//a body that takes longer than the ReadTimeout to arrive
+	slowUpload := func(path string) (string, error) {
+		body, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 5; i++ {
+				time.Sleep(100 * time.Millisecond)
+				pw.Write([]byte("chunk"))
+			}
+			pw.Close()
+		}()
+		resp, err := ts.Client().Post(ts.URL+path, "application/octet-stream", body)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	got, err := slowUpload("/upload")
+	if err != nil || got != "25" {
+		t.Errorf("got %q, %v; want the whole upload", got, err)
+	}
+	got, err = slowUpload("/other")
+	if err == nil && got == "25" {
+		t.Error("the ReadTimeout did not apply to other requests")
+	}
+}
@@ -0,0 +1,45 @@
+//Filename: cmd/api/stats.go
+
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"todo.joelical.net/internal/validator"
+)
+
+// showStatsHandler for the "GET /v1/stats" endpoint
+// from and to are UTC dates and both days are included. they default to the last two weeks.
+// estimates are added up in the workspace's estimate_unit, lists without one count as zero
+func (app *application) showStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := app.readDate(qs, "to", today, v)
+	from := app.readDate(qs, "from", to.AddDate(0, 0, -13), v)
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "must be within a year of from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	stats, err := app.models.Stats.Get(workspace.ID, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{
+		"stats": stats,
+		"metadata": envelope{
+			"from":          from.Format(dateLayout),
+			"to":            to.Format(dateLayout),
+			"estimate_unit": workspace.EstimateUnit,
+		},
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,40 @@
+//Filename: cmd/api/stats_test.go
+
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatsWindowValidation(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	tests := []struct {
+		query  string
+		errors []string
+	}{
+		{"from=2024-03-05&to=2024-03-01", []string{"to"}},
+		{"from=2023-01-01&to=2024-03-01", []string{"to"}},
+		{"from=yesterday", []string{"from"}},
+		{"from=2024-03-01&to=01/03/2024", []string{"to"}},
+		//a bad to falls back to today, which the default from is still before
+		{"to=2024-13-01", []string{"to"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.showStatsHandler(w, httptest.NewRequest(http.MethodGet, "/v1/stats?"+tt.query, nil))
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d; want 422", tt.query, w.Code)
+			continue
+		}
+		for _, key := range tt.errors {
+			if !strings.Contains(w.Body.String(), `"`+key+`"`) {
+				t.Errorf("%s: got %s; want an error for %s", tt.query, w.Body, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+//Filename: cmd/api/stream.go
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+const (
+	// how often a comment is written so proxies don't close an idle stream
+	streamHeartbeat = 15 * time.Second
+	// a stream is ended before the server's WriteTimeout cuts it off. EventSource
+	// reconnects by itself and sends Last-Event-ID so nothing is missed
+	streamMaxDuration = 25 * time.Second
+	// how long a client should wait before reconnecting, in milliseconds
+	streamRetry = 1000
+)
+
+// streamListHandler for the "GET /v1/list/stream" endpoint. it sends list changes as server-sent events.
+// assignee narrows the stream the same way as on "GET /v1/list", assignee=me follows the caller's own lists.
+// a list is matched on how it looks after the change
+func (app *application) streamListHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverErrorResponse(w, r, errors.New("streaming is not supported by the response writer"))
+		return
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	//only send the events the client asked for
+	events := app.readCSV(qs, "events", data.ListEvents)
+	for _, event := range events {
+		v.Check(validator.In(event, data.ListEvents...), "events", "contains an unknown event")
+	}
+	assignee := app.readAssignee(r, qs, v)
+	//browsers send the Last-Event-ID header when reconnecting, the query parameter is for everyone else
+	lastID := int64(0)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = qs.Get("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		v.Check(err == nil && id >= 0, "last_event_id", "must be a positive integer")
+		lastID = id
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	workspace := app.contextGetWorkspace(r)
+	//subscribe before replaying so nothing that happens during the replay is lost
+	ch := app.events.subscribe()
+	defer app.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry)
+	flusher.Flush()
+
+	send := func(event *data.ListEvent) error {
+		//the replay and the hub can both hand us the same event
+		//the hub carries every workspace's events. ids are only in order within a workspace
+		//so lastID must never move past an event from another one
+		if event.WorkspaceID != workspace.ID || event.ID <= lastID {
+			return nil
+		}
+		lastID = event.ID
+		if !validator.In(event.Event, events...) || (event.List != nil && !assignee.Matches(event.List)) {
+			return nil
+		}
+		js, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, js)
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	//replay whatever the client missed
+	if lastEventID != "" {
+		for {
+			missed, err := app.models.Events.GetSince(workspace.ID, lastID, 100)
+			if err != nil {
+				app.logError(r, err)
+				return
+			}
+			for _, event := range missed {
+				if err := send(event); err != nil {
+					app.logError(r, err)
+					return
+				}
+			}
+			if len(missed) < 100 {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(streamMaxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		//the client reconnects to another replica, or to this one once it restarts
+		case <-app.quit:
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-ch:
+			//the hub dropped us for falling behind, the client will resume from lastID
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				app.logError(r, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+//Filename: cmd/api/stream_test.go
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/data"
+)
+
+// streamRecorder lets the test read what has been streamed while the handler is still writing
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	mu sync.Mutex
+}
+
+func (s *streamRecorder) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseRecorder.Write(b)
+}
+
+func (s *streamRecorder) body() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ResponseRecorder.Body.String()
+}
+
+func TestStreamListHandler(t *testing.T) {
+	app := &application{events: newListEventHub(), quit: make(chan struct{})}
+	r := httptest.NewRequest("GET", "/v1/list/stream?events=list.updated&assignee=me", nil)
+	r = app.contextSetWorkspace(r, &data.Workspace{ID: 1})
+	r = app.contextSetCaller(r, &caller{member: &data.Member{ID: 3, WorkspaceID: 1, Name: "sam", Role: data.RoleViewer}, scopes: []string{data.ScopeRead}})
+	w := &streamRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	finished := make(chan struct{})
+	go func() {
+		app.streamListHandler(w, r)
+		close(finished)
+	}()
+	//wait for the handler to subscribe
+	for i := 0; ; i++ {
+		app.events.mu.Lock()
+		subscribed := len(app.events.subscribers) == 1
+		app.events.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the handler did not subscribe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	events := []*data.ListEvent{
+		//another workspace's event must not move the stream past the ids it has seen
+		{ID: 7, Event: data.EventListUpdated, WorkspaceID: 2, List: &data.List{ID: 1, AssigneeIDs: []int64{3}}},
+		{ID: 5, Event: data.EventListUpdated, WorkspaceID: 1, List: &data.List{ID: 2, AssigneeIDs: []int64{3}}},
+		{ID: 6, Event: data.EventListCreated, WorkspaceID: 1, List: &data.List{ID: 3, AssigneeIDs: []int64{3}}},
+		//sam only follows their own lists
+		{ID: 8, Event: data.EventListUpdated, WorkspaceID: 1, List: &data.List{ID: 4, AssigneeIDs: []int64{4}}},
+		{ID: 9, Event: data.EventListUpdated, WorkspaceID: 1, List: &data.List{ID: 5, AssigneeIDs: []int64{4, 3}}},
+	}
+	for _, event := range events {
+		app.events.broadcast(event)
+	}
+	for i := 0; !strings.Contains(w.body(), "id: 9\n"); i++ {
+		if i == 100 {
+			t.Fatalf("the last event was not streamed:\n%s", w.body())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	//shutting down ends the stream straight away
+	close(app.quit)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("the stream did not end when the server shut down")
+	}
+	body := w.body()
+	for _, want := range []string{"id: 5\n", "id: 9\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("stream does not contain %q:\n%s", want, body)
+		}
+	}
+	for _, unwanted := range []string{"id: 6\n", "id: 7\n", "id: 8\n"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("stream contains %q:\n%s", unwanted, body)
+		}
+	}
+}
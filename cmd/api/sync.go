@@ -0,0 +1,227 @@
+//Filename: cmd/api/sync.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+const (
+	// the number of change events read for a single GET /v1/sync response
+	syncPageSize = 500
+	// the most changes a client may push in one POST /v1/sync
+	syncMaxBatch = 100
+)
+
+// syncChange is a single change made by a client while it was offline
+type syncChange struct {
+	Op          string    `json:"op"`
+	ClientID    string    `json:"client_id"`
+	ID          int64     `json:"id"`
+	BaseVersion int32     `json:"base_version"`
+	List        listPatch `json:"list"`
+}
+
+// syncResult tells the client what happened to one of its changes.
+// on a conflict List holds the server copy so the client can resolve it
+type syncResult struct {
+	Index    int               `json:"index"`
+	ClientID string            `json:"client_id,omitempty"`
+	Status   string            `json:"status"`
+	List     *data.List        `json:"list,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// pullSyncHandler for the "GET /v1/sync" endpoint
+// it returns the current state of every list changed after the since token and the ids of deleted lists.
+// clients keep calling with the returned token until has_more is false
+func (app *application) pullSyncHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	since, err := strconv.ParseInt(app.readString(r.URL.Query(), "since", "0"), 10, 64)
+	v.Check(err == nil && since >= 0, "since", "must be a valid sync token")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	events, err := app.models.Events.GetSince(app.contextGetWorkspace(r).ID, since, syncPageSize)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	//only the last change to each list in this page matters
+	latest := make(map[int64]*data.ListEvent)
+	order := []int64{}
+	token := since
+	for _, event := range events {
+		if _, seen := latest[event.ListID]; !seen {
+			order = append(order, event.ListID)
+		}
+		latest[event.ListID] = event
+		token = event.ID
+	}
+	lists := []*data.List{}
+	deleted := []int64{}
+	for _, id := range order {
+		event := latest[id]
+		if event.Event == data.EventListDeleted {
+			deleted = append(deleted, id)
+		} else {
+			lists = append(lists, event.List)
+		}
+	}
+	env := envelope{
+		"lists":    lists,
+		"deleted":  deleted,
+		"token":    strconv.FormatInt(token, 10),
+		"has_more": len(events) == syncPageSize,
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// pushSyncHandler for the "POST /v1/sync" endpoint
+// every change is applied on its own and gets its own result, a conflict in one does not stop the rest
+func (app *application) pushSyncHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Changes []syncChange `json:"changes"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.Changes) > 0, "changes", "must contain at least one change")
+	v.Check(len(input.Changes) <= syncMaxBatch, "changes", "must not contain more than 100 changes")
+	for _, change := range input.Changes {
+		v.Check(validator.In(change.Op, "create", "update", "delete"), "changes", "op must be one of create, update or delete")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	workspace := app.contextGetWorkspace(r)
+	results := make([]syncResult, len(input.Changes))
+	for i, change := range input.Changes {
+		result, err := app.applySyncChange(workspace.ID, change)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		result.Index = i
+		result.ClientID = change.ClientID
+		results[i] = result
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applySyncChange() applies one client change using the same version checks as the list handlers
+func (app *application) applySyncChange(workspaceID int64, change syncChange) (syncResult, error) {
+	v := validator.New()
+	if change.Op == "create" {
+		list := &data.List{WorkspaceID: workspaceID}
+		change.List.apply(list)
+		if data.ValidateList(v, list); !v.Valid() {
+			return syncResult{Status: "invalid", Errors: v.Errors}, nil
+		}
+		err := app.models.List.Insert(list)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrQuotaExceeded):
+				return syncQuotaExceeded(), nil
+			case errors.Is(err, data.ErrInvalidAssignee):
+				return syncResult{Status: "invalid", Errors: map[string]string{"assignee_ids": invalidAssigneeMessage}}, nil
+			case errors.Is(err, data.ErrInvalidParent):
+				return syncResult{Status: "invalid", Errors: map[string]string{"parent_id": invalidParentMessage}}, nil
+			default:
+				return syncResult{}, err
+			}
+		}
+		app.publishListEvent(data.EventListCreated, list)
+		return syncResult{Status: "applied", List: list}, nil
+	}
+
+	list, err := app.models.List.Get(workspaceID, change.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return syncResult{Status: "not_found"}, nil
+		default:
+			return syncResult{}, err
+		}
+	}
+	//the client changed a version it no longer has
+	if list.Version != change.BaseVersion {
+		return syncResult{Status: "conflict", List: list}, nil
+	}
+
+	if change.Op == "delete" {
+		subtasks, err := app.models.List.DeleteVersion(workspaceID, list.ID, list.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return app.syncConflict(workspaceID, list.ID)
+			default:
+				return syncResult{}, err
+			}
+		}
+		app.publishListEvent(data.EventListDeleted, &data.List{ID: list.ID, WorkspaceID: workspaceID})
+		for _, subtask := range subtasks {
+			app.publishListEvent(data.EventListDeleted, &data.List{ID: subtask, WorkspaceID: workspaceID})
+		}
+		return syncResult{Status: "applied"}, nil
+	}
+
+	previousStatus := list.Status
+	change.List.apply(list)
+	if data.ValidateList(v, list); !v.Valid() {
+		return syncResult{Status: "invalid", Errors: v.Errors}, nil
+	}
+	_, err = app.saveListUpdate(list, previousStatus)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return app.syncConflict(workspaceID, list.ID)
+		case errors.Is(err, data.ErrQuotaExceeded):
+			return syncQuotaExceeded(), nil
+		case errors.Is(err, data.ErrInvalidAssignee):
+			return syncResult{Status: "invalid", Errors: map[string]string{"assignee_ids": invalidAssigneeMessage}}, nil
+		case errors.Is(err, data.ErrInvalidParent):
+			return syncResult{Status: "invalid", Errors: map[string]string{"parent_id": invalidParentMessage}}, nil
+		case errors.Is(err, data.ErrWIPLimitExceeded):
+			return syncResult{Status: "invalid", Errors: map[string]string{"status": wipLimitMessage}}, nil
+		default:
+			return syncResult{}, err
+		}
+	}
+	return syncResult{Status: "applied", List: list}, nil
+}
+
+// syncConflict() reports a conflict that was only caught when writing, along with the list as it is now
+func (app *application) syncConflict(workspaceID, id int64) (syncResult, error) {
+	list, err := app.models.List.Get(workspaceID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return syncResult{Status: "not_found"}, nil
+		default:
+			return syncResult{}, err
+		}
+	}
+	return syncResult{Status: "conflict", List: list}, nil
+}
+
+// syncQuotaExceeded() reports a change that would take the workspace over its list quota
+func syncQuotaExceeded() syncResult {
+	return syncResult{Status: "invalid", Errors: map[string]string{"workspace": "has reached its limit on the number of lists"}}
+}
@@ -0,0 +1,160 @@
+//Filename: cmd/api/sync_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestSyncValidation(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	tooMany := `{"changes":[` + strings.TrimSuffix(strings.Repeat(`{"op":"delete","id":1},`, syncMaxBatch+1), ",") + `]}`
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		body    string
+		want    int
+	}{
+		{"bad since", app.pullSyncHandler, http.MethodGet, "/v1/sync?since=abc", "", http.StatusUnprocessableEntity},
+		{"negative since", app.pullSyncHandler, http.MethodGet, "/v1/sync?since=-1", "", http.StatusUnprocessableEntity},
+		{"no changes", app.pushSyncHandler, http.MethodPost, "/v1/sync", `{"changes":[]}`, http.StatusUnprocessableEntity},
+		{"too many changes", app.pushSyncHandler, http.MethodPost, "/v1/sync", tooMany, http.StatusUnprocessableEntity},
+		{"unknown op", app.pushSyncHandler, http.MethodPost, "/v1/sync", `{"changes":[{"op":"merge","id":1}]}`, http.StatusUnprocessableEntity},
+		{"unknown field", app.pushSyncHandler, http.MethodPost, "/v1/sync", `{"changes":[{"op":"update","list":{"colour":"red"}}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.want {
+			t.Errorf("%s: got status %d; want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestPushSyncConflicts(t *testing.T) {
+	app := newTestApp(t)
+	list := &data.List{WorkspaceID: data.DefaultWorkspaceID, Name: "home", Task: "milk", Status: "todo"}
+	if err := app.models.List.Insert(list); err != nil {
+		t.Fatal(err)
+	}
+	stale := list.Version
+	//someone else edits the list while the client is offline
+	list.Task = "oat milk"
+	if _, err := app.models.List.Update(list); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []map[string]interface{}{
+		{"op": "update", "client_id": "a", "id": list.ID, "base_version": stale, "list": map[string]interface{}{"task": "eggs"}},
+		{"op": "update", "client_id": "b", "id": list.ID, "base_version": list.Version, "list": map[string]interface{}{"status": "doing"}},
+		{"op": "delete", "client_id": "c", "id": list.ID, "base_version": list.Version},
+		{"op": "update", "client_id": "d", "id": list.ID + 1000, "base_version": 1},
+		{"op": "create", "client_id": "e", "list": map[string]interface{}{"name": "work"}},
+		{"op": "create", "client_id": "f", "list": map[string]interface{}{"name": "work", "task": "report", "status": "todo"}},
+	}
+	w := serveInWorkspace(t, app, anonymousCaller, "/v1/sync", app.pushSyncHandler, http.MethodPost, "/v1/sync", map[string]interface{}{"changes": changes})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d; want 200: %s", w.Code, w.Body)
+	}
+	var response struct {
+		Results []syncResult `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		clientID string
+		status   string
+		version  int32
+	}{
+		//the server copy comes back so the client can resolve the conflict
+		{"a", "conflict", list.Version},
+		{"b", "applied", list.Version + 1},
+		//b already moved the list on, so the delete is based on a version that is gone
+		{"c", "conflict", list.Version + 1},
+		{"d", "not_found", 0},
+		{"e", "invalid", 0},
+		{"f", "applied", 1},
+	}
+	if len(response.Results) != len(tests) {
+		t.Fatalf("got %d results; want %d", len(response.Results), len(tests))
+	}
+	for i, tt := range tests {
+		result := response.Results[i]
+		version := int32(0)
+		if result.List != nil {
+			version = result.List.Version
+		}
+		if result.Index != i || result.ClientID != tt.clientID || result.Status != tt.status || version != tt.version {
+			t.Errorf("%s: got %d %q at version %d; want %d %q at version %d", tt.clientID, result.Index, result.Status, version, i, tt.status, tt.version)
+		}
+	}
+	if errs := response.Results[4].Errors; errs["task"] == "" || errs["status"] == "" {
+		t.Errorf("got errors %v; want task and status", errs)
+	}
+	if task := response.Results[0].List.Task; task != "oat milk" {
+		t.Errorf("got the conflicting list's task %q; want the server's oat milk", task)
+	}
+}
+
+func TestPullSync(t *testing.T) {
+	app := newTestApp(t)
+	kept := &data.List{WorkspaceID: data.DefaultWorkspaceID, Name: "home", Task: "milk", Status: "todo"}
+	gone := &data.List{WorkspaceID: data.DefaultWorkspaceID, Name: "home", Task: "eggs", Status: "todo"}
+	for _, list := range []*data.List{kept, gone} {
+		if err := app.models.List.Insert(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept.Status = "doing"
+	if _, err := app.models.List.Update(kept); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.models.List.Delete(data.DefaultWorkspaceID, gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	type page struct {
+		Lists   []*data.List `json:"lists"`
+		Deleted []int64      `json:"deleted"`
+		Token   string       `json:"token"`
+		HasMore bool         `json:"has_more"`
+	}
+	pull := func(since string) page {
+		w := serveInWorkspace(t, app, anonymousCaller, "/v1/sync", app.pullSyncHandler, http.MethodGet, "/v1/sync?since="+since, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("since %s: got status %d; want 200", since, w.Code)
+		}
+		var p page
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	//only the latest state of each list is sent, and deleted lists are tombstones
+	first := pull("0")
+	if len(first.Lists) != 1 || first.Lists[0].ID != kept.ID || first.Lists[0].Status != "doing" {
+		t.Errorf("got lists %+v; want only the kept list, doing", first.Lists)
+	}
+	if len(first.Deleted) != 1 || first.Deleted[0] != gone.ID || first.HasMore {
+		t.Errorf("got deleted %v, has_more %t; want [%d], false", first.Deleted, first.HasMore, gone.ID)
+	}
+
+	//nothing has changed since the token
+	second := pull(first.Token)
+	if len(second.Lists) != 0 || len(second.Deleted) != 0 || second.Token != first.Token {
+		t.Errorf("got %+v after the token; want nothing new and the same token", second)
+	}
+}
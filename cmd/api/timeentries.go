@@ -0,0 +1,307 @@
+//Filename: cmd/api/timeentries.go
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// startTimerHandler for the "POST /v1/list/:id/timer/start" endpoint
+// a person can only have one timer running in the workspace, so the one running has to be stopped first.
+// a member times themselves, without credentials the person names themselves with user
+func (app *application) startTimerHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		User string `json:"user"`
+		Note string `json:"note"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	entry := &data.TimeEntry{
+		ListID: list.ID,
+		User:   input.User,
+		Note:   input.Note,
+	}
+	app.bookTimeEntry(r, entry)
+	v := validator.New()
+	if data.ValidateTimer(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.TimeEntries.Start(list.WorkspaceID, entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTimerRunning):
+			app.timerRunningResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d/time-entries", list.WorkspaceID, list.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// stopTimerHandler for the "POST /v1/list/:id/timer/stop" endpoint
+func (app *application) stopTimerHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		User string `json:"user"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	stop := &data.TimeEntry{User: input.User}
+	app.bookTimeEntry(r, stop)
+	v := validator.New()
+	if data.ValidateTimer(v, stop); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	entry, err := app.models.TimeEntries.Stop(list.ID, stop.User, stop.MemberID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user", "has no timer running on this list")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTimeEntryHandler for the "POST /v1/list/:id/time-entries" endpoint
+// for time that wasn't tracked with a timer. the entry has to have ended
+func (app *application) createTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		User      string     `json:"user"`
+		StartedAt time.Time  `json:"started_at"`
+		EndedAt   *time.Time `json:"ended_at"`
+		Note      string     `json:"note"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	entry := &data.TimeEntry{
+		ListID:    list.ID,
+		User:      input.User,
+		StartedAt: input.StartedAt,
+		EndedAt:   input.EndedAt,
+		Note:      input.Note,
+	}
+	app.bookTimeEntry(r, entry)
+	v := validator.New()
+	if data.ValidateTimeEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.TimeEntries.Insert(list.WorkspaceID, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d/list/%d/time-entries", list.WorkspaceID, list.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTimeEntriesHandler for the "GET /v1/list/:id/time-entries" endpoint
+// total_seconds includes the time so far on running timers
+func (app *application) listTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	entries, err := app.models.TimeEntries.GetAll(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Seconds
+	}
+	env := envelope{"time_entries": entries, "metadata": envelope{"total_seconds": total}}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTimeEntryHandler for the "DELETE /v1/list/:id/time-entries/:entry_id" endpoint
+// only the person who booked the entry or an admin can delete it
+func (app *application) deleteTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	entryID, err := app.readNamedIDParam(r, "entry_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	entry, err := app.models.TimeEntries.Get(list.ID, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !app.isTimeEntryOwner(r, entry) && !app.contextGetCaller(r).can(r, data.RoleAdmin) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.TimeEntries.Delete(list.ID, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "time entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// bookTimeEntry() puts a member's own name and id on the entry, whatever user the body gave
+func (app *application) bookTimeEntry(r *http.Request, entry *data.TimeEntry) {
+	if c := app.contextGetCaller(r); !c.anonymous() {
+		entry.User = c.member.Name
+		entry.MemberID = &c.member.ID
+	}
+}
+
+// isTimeEntryOwner() reports whether the caller booked the entry. like a comment, an entry
+// booked without credentials can only be changed without them
+func (app *application) isTimeEntryOwner(r *http.Request, entry *data.TimeEntry) bool {
+	c := app.contextGetCaller(r)
+	if c.anonymous() {
+		return entry.MemberID == nil
+	}
+	return entry.MemberID != nil && *entry.MemberID == c.member.ID
+}
+
+// timeReportHandler for the "GET /v1/reports/time" endpoint
+// from and to are UTC dates and both days are included. they default to the current month so far.
+// only stopped entries are counted, each on the day it started
+func (app *application) timeReportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	now := time.Now().UTC()
+	from := app.readDate(qs, "from", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), v)
+	to := app.readDate(qs, "to", now.Truncate(24*time.Hour), v)
+	groupBy := app.readString(qs, "group_by", "day")
+	format := app.readString(qs, "format", "json")
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) <= 366*24*time.Hour, "to", "must be within a year of from")
+	v.Check(validator.In(groupBy, data.TimeReportGroups...), "group_by", "must be one of day, task or user")
+	v.Check(validator.In(format, "json", "csv"), "format", "must be json or csv")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	report, err := app.models.TimeEntries.Report(app.contextGetWorkspace(r).ID, from, to.AddDate(0, 0, 1), groupBy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if format == "csv" {
+		filename := fmt.Sprintf("time-%s-%s.csv", from.Format("20060102"), to.Format("20060102"))
+		w.Header().Set("Content-Type", exportContentTypes["csv"])
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		err = writeTimeReportCSV(w, groupBy, report)
+		if err != nil {
+			app.logError(r, err)
+		}
+		return
+	}
+	var total int64
+	for _, row := range report {
+		total += row.Seconds
+	}
+	env := envelope{
+		"report": report,
+		"metadata": envelope{
+			"from":          from.Format(dateLayout),
+			"to":            to.Format(dateLayout),
+			"group_by":      groupBy,
+			"total_seconds": total,
+		},
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeTimeReportCSV() writes a header row then one row per group. hours are rounded to
+// two places for invoices, seconds are kept so nothing is lost adding the rows up
+func writeTimeReportCSV(w http.ResponseWriter, groupBy string, report []*data.TimeReportRow) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{groupBy, "list_id", "entries", "seconds", "hours"})
+	if err != nil {
+		return err
+	}
+	for _, row := range report {
+		listID := ""
+		if row.ListID != nil {
+			listID = strconv.FormatInt(*row.ListID, 10)
+		}
+		err = cw.Write([]string{
+			row.Group,
+			listID,
+			strconv.Itoa(row.Entries),
+			strconv.FormatInt(row.Seconds, 10),
+			strconv.FormatFloat(float64(row.Seconds)/3600, 'f', 2, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,67 @@
+//Filename: cmd/api/timeentries_test.go
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"todo.joelical.net/internal/data"
+)
+
+func TestBookTimeEntry(t *testing.T) {
+	app := &application{}
+	sam := &caller{member: &data.Member{ID: 7, WorkspaceID: 1, Name: "sam", Role: data.RoleMember}, scopes: []string{data.ScopeWrite}}
+	tests := []struct {
+		name     string
+		caller   *caller
+		user     string
+		wantUser string
+		wantID   int64
+	}{
+		{"member", sam, "", "sam", 7},
+		{"member naming someone else", sam, "alex", "sam", 7},
+		{"anonymous", anonymousCaller, "alex", "alex", 0},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/v1/list/1/timer/start", nil)
+		r = app.contextSetCaller(r, tt.caller)
+		entry := &data.TimeEntry{User: tt.user}
+		app.bookTimeEntry(r, entry)
+		var id int64
+		if entry.MemberID != nil {
+			id = *entry.MemberID
+		}
+		if entry.User != tt.wantUser || id != tt.wantID {
+			t.Errorf("%s: got user %q and member %d; want %q and %d", tt.name, entry.User, id, tt.wantUser, tt.wantID)
+		}
+	}
+}
+
+func TestIsTimeEntryOwner(t *testing.T) {
+	app := &application{}
+	member := func(id int64) *caller {
+		return &caller{member: &data.Member{ID: id, WorkspaceID: 1, Name: "sam", Role: data.RoleOwner}, scopes: []string{data.ScopeWrite}}
+	}
+	sams, anonymous := int64(7), (*int64)(nil)
+	tests := []struct {
+		name     string
+		caller   *caller
+		memberID *int64
+		want     bool
+	}{
+		{"owner", member(7), &sams, true},
+		{"someone else", member(8), &sams, false},
+		{"member on an anonymous entry", member(7), anonymous, false},
+		{"anonymous on a member's entry", anonymousCaller, &sams, false},
+		{"anonymous on an anonymous entry", anonymousCaller, anonymous, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodDelete, "/v1/list/1/time-entries/1", nil)
+		r = app.contextSetCaller(r, tt.caller)
+		if got := app.isTimeEntryOwner(r, &data.TimeEntry{MemberID: tt.memberID}); got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+//Filename: cmd/api/tokens.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/jwt"
+	"todo.joelical.net/internal/validator"
+)
+
+// how long the tokens last. a reset token is only good for a short while since it travels by email,
+// and a signed token is checked without the database so it is kept short too
+const (
+	authenticationTokenTTL = 24 * time.Hour
+	signedTokenTTL         = 15 * time.Minute
+	passwordResetTokenTTL  = 45 * time.Minute
+)
+
+// createAuthenticationTokenHandler for the "POST /v1/tokens/authentication" endpoint.
+// it signs a member in with their email and password and returns a token to send as "Authorization: Bearer <token>".
+// the member is looked up in the workspace in the body, or the default workspace.
+// with -auth-mode=jwt the token is signed, and a script can also trade its api key for one without a body,
+// or with scopes to narrow the token below the key's scopes
+func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Workspace int64    `json:"workspace"`
+		Email     string   `json:"email"`
+		Password  string   `json:"password"`
+		Scopes    []string `json:"scopes"`
+	}
+	//the body is optional when an api key is traded for a token
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	c := app.contextGetCaller(r)
+	if app.jwt != nil && input.Email == "" && !c.anonymous() {
+		//a token can't be swapped for a new one, or it would never have to run out
+		if c.token {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		if input.Scopes == nil {
+			input.Scopes = c.scopes
+		}
+		v := validator.New()
+		v.Check(len(input.Scopes) > 0, "scopes", "must contain at least one scope")
+		for _, scope := range input.Scopes {
+			v.Check(validator.In(scope, c.scopes...), "scopes", "must only contain scopes the api key has")
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.writeAuthenticationToken(w, r, http.StatusCreated, c.member, input.Scopes)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Email != "", "email", "must be provided")
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if input.Workspace == 0 {
+		input.Workspace = data.DefaultWorkspaceID
+	}
+	member, err := app.models.Members.GetByEmail(input.Workspace, input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	match, err := member.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	//signing in with a password gives the member everything they can do
+	app.writeAuthenticationToken(w, r, http.StatusCreated, member, []string{data.ScopeWrite})
+}
+
+// writeAuthenticationToken() answers with a new token for the member. with -auth-mode=jwt it is signed
+// and carries the scopes, otherwise it is kept in the database and allows everything
+func (app *application) writeAuthenticationToken(w http.ResponseWriter, r *http.Request, status int, member *data.Member, scopes []string) {
+	if app.jwt == nil {
+		token, err := app.models.Tokens.New(member.ID, authenticationTokenTTL, data.PurposeAuthentication)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeJSON(w, status, envelope{"authentication_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	now := time.Now()
+	claims := jwt.Claims{
+		Subject:   strconv.FormatInt(member.ID, 10),
+		Workspace: member.WorkspaceID,
+		Name:      member.Name,
+		Role:      member.Role,
+		Scope:     strings.Join(scopes, " "),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(signedTokenTTL).Unix(),
+	}
+	token, err := app.jwt.Sign(claims)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"authentication_token": envelope{
+		"token":  token,
+		"expiry": time.Unix(claims.ExpiresAt, 0).UTC(),
+		"scopes": scopes,
+	}}
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler for the "POST /v1/tokens/password-reset" endpoint.
+// it emails a single use token to the member with the email. the answer is the same whether or not
+// anyone has the email, so it can't be used to find out who is a member. workspace works as it does for signing in
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Workspace int64  `json:"workspace"`
+		Email     string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Email != "", "email", "must be provided")
+	v.Check(validator.Matches(input.Email, validator.EmailRX), "email", "must be a valid email address")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if input.Workspace == 0 {
+		input.Workspace = data.DefaultWorkspaceID
+	}
+	member, err := app.models.Members.GetByEmail(input.Workspace, input.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	default:
+		//only the newest email works, so an older one left in an inbox is no use
+		err = app.models.Tokens.DeleteAllForMember(data.PurposePasswordReset, member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err := app.models.Tokens.New(member.ID, passwordResetTokenTTL, data.PurposePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			err := app.mailer.Send(member.Email, "password_reset.tmpl", map[string]interface{}{
+				"Member":  member,
+				"Token":   token.Plaintext,
+				"Minutes": int(passwordResetTokenTTL.Minutes()),
+			})
+			if err != nil {
+				app.logger.Println(err)
+			}
+		})
+	}
+	message := "if a member has this email, an email with password reset instructions will be sent to it"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePasswordHandler for the "PUT /v1/users/password" endpoint.
+// it takes the token from a password reset email and the new password. the token can only be used once,
+// and every sign in token the member had, signed or not, is revoked so anyone else signed in as them is signed out
+func (app *application) updatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	member, err := app.models.Members.GetForToken(data.PurposePasswordReset, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if data.ValidatePasswordPlaintext(v, input.Password, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = member.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Members.ResetPassword(member, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
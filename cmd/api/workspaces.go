@@ -0,0 +1,192 @@
+//Filename: cmd/api/workspaces.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"todo.joelical.net/internal/data"
+	"todo.joelical.net/internal/validator"
+)
+
+// createWorkspaceHandler for the "POST /v1/workspaces" endpoint
+// the caller has to be an owner to make a workspace, and they become its owner under the same name.
+// credentials only work in their own workspace, so the response carries an api key for the new owner
+// with the scopes of the credential that made it. anonymous callers can't make one, they would have no way in
+func (app *application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	c := app.contextGetCaller(r)
+	if c.anonymous() {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+	if !c.can(r, data.RoleOwner) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	var input struct {
+		Name         string `json:"name"`
+		MaxLists     *int32 `json:"max_lists"`
+		MaxStorage   *int64 `json:"max_storage"`
+		EstimateUnit string `json:"estimate_unit"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	workspace := &data.Workspace{
+		Name:         input.Name,
+		MaxLists:     1000,
+		MaxStorage:   1 << 30,
+		EstimateUnit: data.EstimatePoints,
+	}
+	if input.MaxLists != nil {
+		workspace.MaxLists = *input.MaxLists
+	}
+	if input.MaxStorage != nil {
+		workspace.MaxStorage = *input.MaxStorage
+	}
+	if input.EstimateUnit != "" {
+		workspace.EstimateUnit = input.EstimateUnit
+	}
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Workspaces.Insert(workspace)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	owner := &data.Member{WorkspaceID: workspace.ID, Name: c.member.Name, Email: c.member.Email, Role: data.RoleOwner}
+	err = app.models.Members.Insert(owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	key := &data.APIKey{
+		MemberID:    owner.ID,
+		WorkspaceID: workspace.ID,
+		Name:        "workspace creation",
+		Scopes:      append([]string{}, c.scopes...),
+	}
+	err = app.models.APIKeys.New(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d", workspace.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": workspace, "api_key": key}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWorkspacesHandler for the "GET /v1/workspaces" endpoint
+// a signed in caller only sees the workspace they belong to
+func (app *application) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	c := app.contextGetCaller(r)
+	workspaces, err := app.models.Workspaces.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !c.anonymous() {
+		own := []*data.Workspace{}
+		for _, workspace := range workspaces {
+			if workspace.ID == c.member.WorkspaceID {
+				own = append(own, workspace)
+			}
+		}
+		workspaces = own
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspaces": workspaces}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWorkspaceHandler for the "GET /v1/workspaces/:ws" endpoint
+func (app *application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace := app.contextGetWorkspace(r)
+	err := app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkspaceHandler for the "PATCH /v1/workspaces/:ws" endpoint
+func (app *application) updateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace := app.contextGetWorkspace(r)
+	var input struct {
+		Name         *string `json:"name"`
+		MaxLists     *int32  `json:"max_lists"`
+		MaxStorage   *int64  `json:"max_storage"`
+		EstimateUnit *string `json:"estimate_unit"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		workspace.Name = *input.Name
+	}
+	if input.MaxLists != nil {
+		workspace.MaxLists = *input.MaxLists
+	}
+	if input.MaxStorage != nil {
+		workspace.MaxStorage = *input.MaxStorage
+	}
+	if input.EstimateUnit != nil {
+		workspace.EstimateUnit = *input.EstimateUnit
+	}
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Workspaces.Update(workspace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWorkspaceHandler for the "DELETE /v1/workspaces/:ws" endpoint
+// every list in the workspace is deleted with it
+func (app *application) deleteWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace := app.contextGetWorkspace(r)
+	//the /v1/list routes depend on the default workspace
+	if workspace.ID == data.DefaultWorkspaceID {
+		app.badRequestResponse(w, r, errors.New("the default workspace cannot be deleted"))
+		return
+	}
+	err := app.models.Workspaces.Delete(workspace.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "workspace successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -3,6 +3,8 @@ module todo.joelical.net
 go 1.19
 
 require (
+	github.com/gorilla/websocket v1.5.0
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/lib/pq v1.10.7
+	golang.org/x/crypto v0.21.0
 )
@@ -0,0 +1,226 @@
+//Filename: internal/data/apikeys.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/validator"
+)
+
+// an APIKey lets a script act as a member of a workspace. Scopes narrow what the key may do on top of
+// the member's role. the plaintext is "todo_<prefix>_<secret>" and is only shown when the key is made
+type APIKey struct {
+	ID          int64      `json:"id"`
+	MemberID    int64      `json:"member_id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Plaintext   string     `json:"key,omitempty"`
+	Hash        []byte     `json:"-"`
+	// the member the key belongs to, filled in when a key is used
+	Member *Member `json:"-"`
+}
+
+// the scopes a key can have. read allows GET requests, write allows everything else
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+var Scopes = []string{ScopeRead, ScopeWrite}
+
+// how a key starts, and how long the whole plaintext is
+const (
+	apiKeyStart  = "todo_"
+	apiKeyLength = len(apiKeyStart) + 8 + 1 + 26
+)
+
+// how often last_used_at is brought up to date, so a busy script doesn't write on every request
+const apiKeyUseResolution = time.Minute
+
+// generateAPIKey() returns a new key's prefix, plaintext and sha-256 hash
+func generateAPIKey() (string, string, []byte, error) {
+	randomBytes := make([]byte, 5)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", "", nil, err
+	}
+	prefix := apiKeyStart + strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes))
+	secret, _, err := generateToken()
+	if err != nil {
+		return "", "", nil, err
+	}
+	plaintext := prefix + "_" + secret
+	hash := sha256.Sum256([]byte(plaintext))
+	return prefix, plaintext, hash[:], nil
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range key.Scopes {
+		v.Check(validator.In(scope, Scopes...), "scopes", "must only contain read or write")
+	}
+}
+
+// ValidAPIKeyPlaintext() checks a key has the shape generateAPIKey() produces
+func ValidAPIKeyPlaintext(plaintext string) bool {
+	return len(plaintext) == apiKeyLength && strings.HasPrefix(plaintext, apiKeyStart)
+}
+
+// define an APIKeyModel which wraps a sql.db connection pool
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New() generates a key for key.MemberID and saves it. the plaintext is only available on the key afterwards
+func (m APIKeyModel) New(key *APIKey) error {
+	prefix, plaintext, hash, err := generateAPIKey()
+	if err != nil {
+		return err
+	}
+	key.Prefix, key.Plaintext, key.Hash = prefix, plaintext, hash
+	query := `
+		INSERT INTO api_keys (member_id, name, prefix, hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{key.MemberID, key.Name, key.Prefix, key.Hash, pq.Array(key.Scopes)}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAll() returns the keys in a workspace without their plaintext. a memberID other than 0 only returns that member's keys
+func (m APIKeyModel) GetAll(workspaceID, memberID int64) ([]*APIKey, error) {
+	query := `
+		SELECT k.id, k.member_id, m.workspace_id, k.created_at, k.name, k.prefix, k.scopes, k.last_used_at
+		FROM api_keys k
+		INNER JOIN workspace_members m ON m.id = k.member_id
+		WHERE m.workspace_id = $1
+		AND (k.member_id = $2 OR $2 = 0)
+		ORDER BY k.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(&key.ID, &key.MemberID, &key.WorkspaceID, &key.CreatedAt, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Use() looks a key up by its plaintext, along with its member, and records that it was used
+func (m APIKeyModel) Use(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		SELECT k.id, k.member_id, k.created_at, k.name, k.prefix, k.scopes, k.last_used_at,
+			m.id, m.workspace_id, m.created_at, m.name, m.email, m.role, m.password_hash, m.version
+		FROM api_keys k
+		INNER JOIN workspace_members m ON m.id = k.member_id
+		WHERE k.hash = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := APIKey{Member: &Member{}}
+	fields := []interface{}{&key.ID, &key.MemberID, &key.CreatedAt, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.LastUsedAt}
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(append(fields, key.Member.scanFields()...)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	key.WorkspaceID = key.Member.WorkspaceID
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyUseResolution {
+		err = m.DB.QueryRowContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 RETURNING last_used_at`, key.ID).Scan(&key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// Delete() revokes a key in a workspace. a memberID other than 0 only lets that member's keys be deleted
+func (m APIKeyModel) Delete(workspaceID, memberID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM api_keys k
+		USING workspace_members m
+		WHERE k.id = $1
+		AND m.id = k.member_id
+		AND m.workspace_id = $2
+		AND (k.member_id = $3 OR $3 = 0)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, workspaceID, memberID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAll() revokes every key of a member of the workspace, for when their keys may have leaked.
+// it returns how many were revoked
+func (m APIKeyModel) DeleteAll(workspaceID, memberID int64) (int64, error) {
+	query := `
+		DELETE FROM api_keys k
+		USING workspace_members m
+		WHERE k.member_id = $1
+		AND m.id = k.member_id
+		AND m.workspace_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, memberID, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,91 @@
+//Filename: internal/data/apikeys_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	prefix, plaintext, hash, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidAPIKeyPlaintext(plaintext) {
+		t.Errorf("%q is not a valid key", plaintext)
+	}
+	if len(prefix) != len(apiKeyStart)+8 || plaintext[:len(prefix)] != prefix {
+		t.Errorf("%q does not start with the prefix %q", plaintext, prefix)
+	}
+	if len(hash) != 32 {
+		t.Errorf("got a %d byte hash; want 32", len(hash))
+	}
+	_, other, _, err := generateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == plaintext {
+		t.Error("two keys are the same")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Role: RoleAdmin}
+	alex := &Member{WorkspaceID: DefaultWorkspaceID, Name: "alex", Role: RoleViewer}
+	for _, member := range []*Member{sam, alex} {
+		if err := models.Members.Insert(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := &APIKey{MemberID: alex.ID, Name: "ci", Scopes: []string{ScopeRead}}
+	if err := models.APIKeys.New(key); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := models.APIKeys.Use(key.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.ID != key.ID || used.Member.Name != "alex" || used.Member.Role != RoleViewer || used.LastUsedAt == nil {
+		t.Errorf("got key %+v for member %+v", used, used.Member)
+	}
+	if _, err := models.APIKeys.Use(key.Plaintext[:len(key.Plaintext)-1] + "0"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("using a wrong key returned %v; want ErrRecordNotFound", err)
+	}
+
+	//a member only sees and revokes their own keys
+	if keys, err := models.APIKeys.GetAll(DefaultWorkspaceID, sam.ID); err != nil || len(keys) != 0 {
+		t.Errorf("got %d keys for sam, %v; want none", len(keys), err)
+	}
+	if err := models.APIKeys.Delete(DefaultWorkspaceID, sam.ID, key.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("sam deleting alex's key returned %v; want ErrRecordNotFound", err)
+	}
+	keys, err := models.APIKeys.GetAll(DefaultWorkspaceID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Plaintext != "" || keys[0].Prefix != key.Prefix {
+		t.Errorf("got keys %+v; want the one key without its plaintext", keys)
+	}
+
+	//revoking all of sam's keys leaves alex's alone
+	if err := models.APIKeys.New(&APIKey{MemberID: sam.ID, Name: "laptop", Scopes: []string{ScopeRead}}); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := models.APIKeys.DeleteAll(DefaultWorkspaceID, sam.ID); err != nil || revoked != 1 {
+		t.Errorf("revoking sam's keys returned %d, %v; want 1", revoked, err)
+	}
+	if _, err := models.APIKeys.Use(key.Plaintext); err != nil {
+		t.Errorf("using alex's key after sam's were revoked returned %v", err)
+	}
+
+	//removing the member revokes their keys
+	if err := models.Members.Delete(DefaultWorkspaceID, alex.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.APIKeys.Use(key.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("using a removed member's key returned %v; want ErrRecordNotFound", err)
+	}
+}
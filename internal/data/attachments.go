@@ -0,0 +1,243 @@
+//Filename: internal/data/attachments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"todo.joelical.net/internal/validator"
+)
+
+// an Attachment is a file uploaded to a list. the bytes are kept in the blob store under StorageKey
+type Attachment struct {
+	ID          int64     `json:"id"`
+	ListID      int64     `json:"list_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	StorageKey  string    `json:"-"`
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Filename != "", "filename", "must be provided")
+	v.Check(len(attachment.Filename) <= 255, "filename", "must not be more than 255 bytes long")
+	v.Check(strings.IndexFunc(attachment.Filename, unicode.IsControl) == -1, "filename", "must not contain control characters")
+
+	v.Check(attachment.Size > 0, "file", "must not be empty")
+}
+
+// define an AttachmentModel which wraps a sql.db connection pool
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+// Insert() records an attachment whose bytes are already stored. the workspace row is locked while
+// the total is checked, so two uploads can't both fit in the last of the quota. ErrQuotaExceeded
+// means the caller should delete the blob again
+func (m AttachmentModel) Insert(workspaceID int64, attachment *Attachment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var maxStorage int64
+	err = tx.QueryRowContext(ctx, `SELECT max_storage FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceID).Scan(&maxStorage)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	var used int64
+	err = tx.QueryRowContext(ctx, storageUsedQuery, workspaceID).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if used+attachment.Size > maxStorage {
+		return ErrQuotaExceeded
+	}
+	query := `
+		INSERT INTO attachments (list_id, filename, content_type, size, storage_key)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	args := []interface{}{attachment.ListID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.StorageKey}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// storageUsedQuery totals the size of the attachments in a workspace
+const storageUsedQuery = `
+	SELECT COALESCE(SUM(attachments.size), 0)
+	FROM attachments
+	INNER JOIN lists ON lists.id = attachments.list_id
+	WHERE lists.workspace_id = $1
+`
+
+// StorageUsed() returns the total size of the attachments in a workspace
+func (m AttachmentModel) StorageUsed(workspaceID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var used int64
+	err := m.DB.QueryRowContext(ctx, storageUsedQuery, workspaceID).Scan(&used)
+	return used, err
+}
+
+// Get() allows us to retrieve a specific attachment on a list
+func (m AttachmentModel) Get(listID, id int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, list_id, created_at, filename, content_type, size, storage_key
+		FROM attachments
+		WHERE id = $1
+		AND list_id = $2
+	`
+	var attachment Attachment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, listID).Scan(
+		&attachment.ID,
+		&attachment.ListID,
+		&attachment.CreatedAt,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attachment, nil
+}
+
+// GetAll() returns the attachments on a list, oldest first
+func (m AttachmentModel) GetAll(listID int64) ([]*Attachment, error) {
+	query := `
+		SELECT id, list_id, created_at, filename, content_type, size, storage_key
+		FROM attachments
+		WHERE list_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+	for rows.Next() {
+		var attachment Attachment
+		err := rows.Scan(
+			&attachment.ID,
+			&attachment.ListID,
+			&attachment.CreatedAt,
+			&attachment.Filename,
+			&attachment.ContentType,
+			&attachment.Size,
+			&attachment.StorageKey,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// Delete() allows us to remove an attachment. a trigger queues its blob for deletion
+func (m AttachmentModel) Delete(listID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM attachments
+		WHERE id = $1
+		AND list_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, listID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// PendingBlobDeletions() returns up to limit storage keys whose blobs are waiting to be deleted
+func (m AttachmentModel) PendingBlobDeletions(limit int) ([]string, error) {
+	query := `
+		SELECT storage_key
+		FROM blob_deletions
+		ORDER BY created_at
+		LIMIT $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// BlobDeleted() marks a queued blob as gone from the store
+func (m AttachmentModel) BlobDeleted(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM blob_deletions WHERE storage_key = $1`, key)
+	return err
+}
@@ -0,0 +1,193 @@
+//Filename: internal/data/board.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/validator"
+)
+
+// a BoardColumn is the setting for one column of a workspace's board. WIPLimit is the most lists
+// the column may hold, nil means no limit
+type BoardColumn struct {
+	Status   string `json:"status"`
+	WIPLimit *int   `json:"wip_limit"`
+}
+
+// a Column is a board column with the lists in it, in position order
+type Column struct {
+	BoardColumn
+	Count int     `json:"count"`
+	Lists []*List `json:"lists"`
+}
+
+func ValidateBoardColumns(v *validator.Validator, columns []*BoardColumn) {
+	v.Check(len(columns) <= 50, "columns", "must not contain more than 50 columns")
+	statuses := make([]string, 0, len(columns))
+	for _, column := range columns {
+		v.Check(column.Status != "", "columns", "status must be provided for every column")
+		v.Check(len(column.Status) <= 300, "columns", "status must not be more than 300 bytes long")
+		v.Check(column.WIPLimit == nil || *column.WIPLimit > 0, "columns", "wip_limit must be greater than zero")
+		statuses = append(statuses, column.Status)
+	}
+	v.Check(validator.Unique(statuses), "columns", "must not contain the same status twice")
+}
+
+// define a BoardModel which wraps a sql.db connection pool
+type BoardModel struct {
+	DB *sql.DB
+}
+
+// GetColumns() returns the column settings of a workspace in board order
+func (m BoardModel) GetColumns(workspaceID int64) ([]*BoardColumn, error) {
+	query := `
+		SELECT status, wip_limit
+		FROM board_columns
+		WHERE workspace_id = $1
+		ORDER BY position
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []*BoardColumn{}
+	for rows.Next() {
+		var column BoardColumn
+		err := rows.Scan(&column.Status, &column.WIPLimit)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, &column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// SetColumns() replaces the column settings of a workspace. the columns are shown in the order given
+func (m BoardModel) SetColumns(workspaceID int64, columns []*BoardColumn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM board_columns WHERE workspace_id = $1`, workspaceID)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO board_columns (workspace_id, status, position, wip_limit)
+		VALUES ($1, $2, $3, $4)
+	`
+	for i, column := range columns {
+		_, err = tx.ExecContext(ctx, query, workspaceID, column.Status, i, column.WIPLimit)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBoard() returns the lists of a workspace grouped into columns by status. the configured columns come first,
+// even when empty, followed by a column for each other status in alphabetical order
+func (m BoardModel) GetBoard(workspaceID int64) ([]*Column, error) {
+	settings, err := m.GetColumns(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE workspace_id = $1
+		ORDER BY position, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []*Column{}
+	byStatus := make(map[string]*Column)
+	for _, setting := range settings {
+		column := &Column{BoardColumn: *setting, Lists: []*List{}}
+		columns = append(columns, column)
+		byStatus[setting.Status] = column
+	}
+	extra := []*Column{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		column, ok := byStatus[list.Status]
+		if !ok {
+			column = &Column{BoardColumn: BoardColumn{Status: list.Status}, Lists: []*List{}}
+			byStatus[list.Status] = column
+			extra = append(extra, column)
+		}
+		column.Lists = append(column.Lists, &list)
+		column.Count++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		return extra[i].Status < extra[j].Status
+	})
+	return append(columns, extra...), nil
+}
+
+// checkWIPLimit() makes sure a list can move into the column for its status, inside the caller's transaction.
+// the caller holds the workspace lock so two lists can't both take the last place in a column
+func checkWIPLimit(ctx context.Context, tx *sql.Tx, list *List) error {
+	return checkColumnRoom(ctx, tx, list.WorkspaceID, list.Status, []int64{list.ID})
+}
+
+// checkColumnRoom() makes sure every one of the lists can move into the column for status at once,
+// for lists finished together by a completion rule. lists already in the column aren't counted twice
+func checkColumnRoom(ctx context.Context, tx *sql.Tx, workspaceID int64, status string, ids []int64) error {
+	var limit sql.NullInt64
+	err := tx.QueryRowContext(ctx, `SELECT wip_limit FROM board_columns WHERE workspace_id = $1 AND status = $2`,
+		workspaceID, status).Scan(&limit)
+	if err != nil {
+		//a status without a column has no limit
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if !limit.Valid {
+		return nil
+	}
+	var count int64
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM lists WHERE workspace_id = $1 AND status = $2 AND id <> ALL($3)`,
+		workspaceID, status, pq.Array(ids)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count+int64(len(ids)) > limit.Int64 {
+		return ErrWIPLimitExceeded
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+//Filename: internal/data/board_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWIPLimits(t *testing.T) {
+	limit := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		limit    *int
+		rule     string
+		subtasks int
+		wantErr  error
+	}{
+		{"no limit", nil, CompletionCascade, 2, nil},
+		{"room for the list", limit(1), CompletionManual, 2, nil},
+		{"full column", limit(1), CompletionManual, 0, ErrWIPLimitExceeded},
+		{"room for the cascade", limit(3), CompletionCascade, 2, nil},
+		{"cascade overflows the column", limit(2), CompletionCascade, 2, ErrWIPLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestDB(t)
+			err := models.Board.SetColumns(DefaultWorkspaceID, []*BoardColumn{{Status: "todo"}, {Status: "done", WIPLimit: tt.limit}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			//"full column" starts with a list already done
+			if tt.subtasks == 0 {
+				done := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+				done.Status = "done"
+				if _, err := models.List.Update(done); err != nil {
+					t.Fatal(err)
+				}
+			}
+			parent := newTestList(t, models, DefaultWorkspaceID, 0, tt.rule)
+			var subtasks []*List
+			for i := 0; i < tt.subtasks; i++ {
+				subtasks = append(subtasks, newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual))
+			}
+
+			parent = reload(t, models, parent)
+			parent.Status = "done"
+			_, err = models.List.Update(parent)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v; want %v", err, tt.wantErr)
+			}
+			//a rejected cascade leaves the parent and every subtask as they were
+			wantStatus := "done"
+			if tt.wantErr != nil {
+				wantStatus = "todo"
+			}
+			if got := reload(t, models, parent).Status; got != wantStatus {
+				t.Errorf("got parent status %q; want %q", got, wantStatus)
+			}
+			if tt.rule == CompletionCascade {
+				for _, subtask := range subtasks {
+					if got := reload(t, models, subtask).Status; got != wantStatus {
+						t.Errorf("got subtask status %q; want %q", got, wantStatus)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+//Filename: internal/data/comments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/validator"
+)
+
+// a Comment is one message in the discussion on a list. the body is Markdown and is stored as written
+type Comment struct {
+	ID        int64     `json:"id"`
+	ListID    int64     `json:"list_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Author    string    `json:"author"`
+	AuthorID  *int64    `json:"author_id"`
+	Body      string    `json:"body"`
+	Mentions  []string  `json:"mentions"`
+	Version   int32     `json:"version"`
+}
+
+// mentionRX matches "@name". the character before the @ can't be part of a word
+// so email addresses aren't taken for mentions
+var mentionRX = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9_][A-Za-z0-9_.-]{0,49})`)
+
+// ParseMentions() returns the names mentioned in a comment body, in order and without repeats.
+// mentions inside `code` are ignored
+func ParseMentions(body string) []string {
+	mentions := []string{}
+	seen := make(map[string]bool)
+	for i, part := range strings.Split(body, "`") {
+		//every odd part is inside a code span or block
+		if i%2 == 1 {
+			continue
+		}
+		for _, match := range mentionRX.FindAllStringSubmatch(part, -1) {
+			name := strings.TrimRight(match[1], ".-")
+			if name != "" && !seen[name] {
+				seen[name] = true
+				mentions = append(mentions, name)
+			}
+		}
+	}
+	return mentions
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Author != "", "author", "must be provided")
+	v.Check(len(comment.Author) <= 100, "author", "must not be more than 100 bytes long")
+
+	v.Check(strings.TrimSpace(comment.Body) != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 10000, "body", "must not be more than 10000 bytes long")
+
+	v.Check(len(comment.Mentions) <= 20, "body", "must not mention more than 20 people")
+}
+
+// define a CommentModel which wraps a sql.db connection pool
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to add a comment to a list
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO comments (list_id, author, author_id, body, mentions)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{comment.ListID, comment.Author, comment.AuthorID, comment.Body, pq.Array(comment.Mentions)}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt, &comment.Version)
+}
+
+// Get() allows us to retrieve a specific comment on a list
+func (m CommentModel) Get(listID, id int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, list_id, created_at, updated_at, author, author_id, body, mentions, version
+		FROM comments
+		WHERE id = $1
+		AND list_id = $2
+	`
+	var comment Comment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, listID).Scan(
+		&comment.ID,
+		&comment.ListID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Author,
+		&comment.AuthorID,
+		&comment.Body,
+		pq.Array(&comment.Mentions),
+		&comment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &comment, nil
+}
+
+// GetPage() returns up to limit comments on a list with an id greater than afterID, oldest first.
+// the bool reports whether there are more comments after the page
+func (m CommentModel) GetPage(listID, afterID int64, limit int) ([]*Comment, bool, error) {
+	query := `
+		SELECT id, list_id, created_at, updated_at, author, author_id, body, mentions, version
+		FROM comments
+		WHERE list_id = $1
+		AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	//one extra row tells us whether there is another page
+	rows, err := m.DB.QueryContext(ctx, query, listID, afterID, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.ListID,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+			&comment.Author,
+			&comment.AuthorID,
+			&comment.Body,
+			pq.Array(&comment.Mentions),
+			&comment.Version,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		comments = append(comments, &comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(comments) > limit {
+		return comments[:limit], true, nil
+	}
+	return comments, false, nil
+}
+
+// Update() allows us to edit a comment, using the version for optimistic locking like List
+func (m CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE comments
+		SET body = $1,
+			mentions = $2,
+			updated_at = NOW(),
+			version = version + 1
+		WHERE id = $3
+		AND version = $4
+		RETURNING updated_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{comment.Body, pq.Array(comment.Mentions), comment.ID, comment.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.UpdatedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() allows us to remove a comment from a list
+func (m CommentModel) Delete(listID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM comments
+		WHERE id = $1
+		AND list_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, listID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+//Filename: internal/data/comments_test.go
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"todo.joelical.net/internal/validator"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"no one", []string{}},
+		{"@sam can you look", []string{"sam"}},
+		{"thanks @sam, @alex and @sam again", []string{"sam", "alex"}},
+		{"ask @kim.", []string{"kim"}},
+		{"@jo-ann.smith please", []string{"jo-ann.smith"}},
+		{"mail sam@example.com", []string{}},
+		{"@@sam", []string{}},
+		{"(@sam)", []string{"sam"}},
+		{"run `git blame @alex` then ask @kim", []string{"kim"}},
+		{"```\n@alex\n```\n@sam", []string{"sam"}},
+		{"@" + strings.Repeat("a", 60), []string{strings.Repeat("a", 50)}},
+	}
+	for _, tt := range tests {
+		if got := ParseMentions(tt.body); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: got %v; want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValidateComment(t *testing.T) {
+	many := make([]string, 21)
+	tests := []struct {
+		name    string
+		comment Comment
+		errors  []string
+	}{
+		{"valid", Comment{Author: "sam", Body: "looks good"}, nil},
+		{"no author", Comment{Body: "looks good"}, []string{"author"}},
+		{"long author", Comment{Author: strings.Repeat("a", 101), Body: "looks good"}, []string{"author"}},
+		{"blank body", Comment{Author: "sam", Body: " \n "}, []string{"body"}},
+		{"long body", Comment{Author: "sam", Body: strings.Repeat("a", 10001)}, []string{"body"}},
+		{"too many mentions", Comment{Author: "sam", Body: "hi", Mentions: many}, []string{"body"}},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateComment(v, &tt.comment)
+		if len(v.Errors) != len(tt.errors) {
+			t.Errorf("%s: got errors %v; want %v", tt.name, v.Errors, tt.errors)
+			continue
+		}
+		for _, key := range tt.errors {
+			if _, ok := v.Errors[key]; !ok {
+				t.Errorf("%s: got errors %v; want one for %s", tt.name, v.Errors, key)
+			}
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	models := newTestDB(t)
+	list := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	other := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	ids := []int64{}
+	for i := 0; i < 5; i++ {
+		comment := &Comment{ListID: list.ID, Author: "sam", Body: fmt.Sprint("comment ", i), Mentions: []string{}}
+		if err := models.Comments.Insert(comment); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, comment.ID)
+	}
+	if err := models.Comments.Insert(&Comment{ListID: other.ID, Author: "sam", Body: "elsewhere", Mentions: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//following the cursor visits every comment on the list once, oldest first
+	tests := []struct {
+		after int64
+		want  []int64
+		more  bool
+	}{
+		{0, ids[:2], true},
+		{ids[1], ids[2:4], true},
+		{ids[3], ids[4:], false},
+		{ids[4], []int64{}, false},
+	}
+	for _, tt := range tests {
+		comments, more, err := models.Comments.GetPage(list.ID, tt.after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int64{}
+		for _, comment := range comments {
+			got = append(got, comment.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || more != tt.more {
+			t.Errorf("after %d: got %v, more %t; want %v, %t", tt.after, got, more, tt.want, tt.more)
+		}
+	}
+
+	//a comment is only found under its own list
+	if _, err := models.Comments.Get(other.ID, ids[0]); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("getting a comment through another list returned %v; want ErrRecordNotFound", err)
+	}
+	comment, err := models.Comments.Get(list.ID, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := *comment
+	comment.Body = "edited @kim"
+	comment.Mentions = ParseMentions(comment.Body)
+	if err := models.Comments.Update(comment); err != nil {
+		t.Fatal(err)
+	}
+	//the timestamps are kept to the second so an edit straight away can share its created_at
+	if comment.Version != 2 || comment.UpdatedAt.Before(comment.CreatedAt) {
+		t.Errorf("got version %d updated at %v; want 2 no earlier than %v", comment.Version, comment.UpdatedAt, comment.CreatedAt)
+	}
+	stale.Body = "lost edit"
+	if err := models.Comments.Update(&stale); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("updating a stale comment returned %v; want ErrEditConflict", err)
+	}
+
+	if err := models.Comments.Delete(other.ID, ids[0]); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleting a comment through another list returned %v; want ErrRecordNotFound", err)
+	}
+	if err := models.Comments.Delete(list.ID, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	//a list's comments go with it
+	if _, err := models.List.Delete(DefaultWorkspaceID, list.ID); err != nil {
+		t.Fatal(err)
+	}
+	if comments, _, err := models.Comments.GetPage(list.ID, 0, 10); err != nil || len(comments) != 0 {
+		t.Errorf("got %d comments, %v on a deleted list; want none", len(comments), err)
+	}
+}
@@ -0,0 +1,241 @@
+//Filename: internal/data/dependencies.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// a Dependency says that a list is blocked by another list until that one is done
+type Dependency struct {
+	ListID      int64     `json:"list_id"`
+	BlockedByID int64     `json:"blocked_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// an Edge in the dependency graph points from the blocking list to the list it blocks
+type Edge struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// a Graph is the part of the dependency graph that a list belongs to:
+// every list it waits on and every list waiting on it, directly or not
+type Graph struct {
+	Nodes []*List `json:"nodes"`
+	Edges []Edge  `json:"edges"`
+}
+
+// define a DependencyModel which wraps a sql.db connection pool
+type DependencyModel struct {
+	DB *sql.DB
+}
+
+// Insert() records that dependency.ListID is blocked by dependency.BlockedByID. both lists must be in the workspace,
+// otherwise ErrRecordNotFound is returned. ErrCycle means the blocking list already waits on the list, directly or not.
+// adding a dependency that exists already is not an error
+func (m DependencyModel) Insert(workspaceID int64, dependency *Dependency) error {
+	//a list waiting on itself is the smallest cycle
+	if dependency.ListID == dependency.BlockedByID {
+		return ErrCycle
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//one change to the graph at a time per workspace, so two inserts can't close a cycle between them
+	err = lockWorkspace(ctx, tx, workspaceID)
+	if err != nil {
+		return err
+	}
+	var found int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM lists WHERE id IN ($1, $2) AND workspace_id = $3`,
+		dependency.ListID, dependency.BlockedByID, workspaceID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return ErrRecordNotFound
+	}
+	//walk from the blocking list to everything it waits on. finding the list there would close a loop
+	query := `
+		WITH RECURSIVE upstream AS (
+			SELECT $1::bigint AS id
+			UNION
+			SELECT list_dependencies.blocked_by_id
+			FROM list_dependencies
+			INNER JOIN upstream ON list_dependencies.list_id = upstream.id
+		)
+		SELECT EXISTS (SELECT 1 FROM upstream WHERE id = $2)
+	`
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, dependency.BlockedByID, dependency.ListID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCycle
+	}
+	//the no-op update lets RETURNING give back the existing row when the dependency is already there
+	query = `
+		INSERT INTO list_dependencies (list_id, blocked_by_id)
+		VALUES ($1, $2)
+		ON CONFLICT (list_id, blocked_by_id) DO UPDATE SET list_id = EXCLUDED.list_id
+		RETURNING created_at
+	`
+	err = tx.QueryRowContext(ctx, query, dependency.ListID, dependency.BlockedByID).Scan(&dependency.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete() removes a dependency
+func (m DependencyModel) Delete(listID, blockedByID int64) error {
+	query := `
+		DELETE FROM list_dependencies
+		WHERE list_id = $1
+		AND blocked_by_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listID, blockedByID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetBlockers() returns the lists that a list is directly blocked by
+func (m DependencyModel) GetBlockers(listID int64) ([]*List, error) {
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE id IN (SELECT blocked_by_id FROM list_dependencies WHERE list_id = $1)
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// graphQuery selects the ids of the list $1 and everything upstream and downstream of it
+const graphQuery = `
+	WITH RECURSIVE upstream AS (
+		SELECT $1::bigint AS id
+		UNION
+		SELECT list_dependencies.blocked_by_id
+		FROM list_dependencies
+		INNER JOIN upstream ON list_dependencies.list_id = upstream.id
+	), downstream AS (
+		SELECT $1::bigint AS id
+		UNION
+		SELECT list_dependencies.list_id
+		FROM list_dependencies
+		INNER JOIN downstream ON list_dependencies.blocked_by_id = downstream.id
+	), nodes AS (
+		SELECT id FROM upstream
+		UNION
+		SELECT id FROM downstream
+	)
+`
+
+// GetGraph() returns the dependency graph around a list
+func (m DependencyModel) GetGraph(workspaceID, listID int64) (*Graph, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	//the nodes and edges are read from the same snapshot so every edge has both its ends
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, graphQuery+`
+		SELECT `+listColumns+`
+		FROM lists
+		WHERE id IN (SELECT id FROM nodes)
+		AND workspace_id = $2
+		ORDER BY id
+	`, listID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graph := &Graph{Nodes: []*List{}, Edges: []Edge{}}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		graph.Nodes = append(graph.Nodes, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(graph.Nodes) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	rows, err = tx.QueryContext(ctx, graphQuery+`
+		SELECT blocked_by_id, list_id
+		FROM list_dependencies
+		WHERE list_id IN (SELECT id FROM nodes)
+		AND blocked_by_id IN (SELECT id FROM nodes)
+		ORDER BY blocked_by_id, list_id
+	`, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var edge Edge
+		err := rows.Scan(&edge.From, &edge.To)
+		if err != nil {
+			return nil, err
+		}
+		graph.Edges = append(graph.Edges, edge)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
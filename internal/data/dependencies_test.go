@@ -0,0 +1,87 @@
+//Filename: internal/data/dependencies_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDependencyCycles(t *testing.T) {
+	models := newTestDB(t)
+	a := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	b := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	c := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	d := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	other := &Workspace{Name: "Other", MaxLists: 10, EstimateUnit: EstimatePoints}
+	if err := models.Workspaces.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	elsewhere := newTestList(t, models, other.ID, 0, CompletionManual)
+
+	//each step runs against the graph left by the ones before it: c waits on b, b waits on a
+	tests := []struct {
+		name      string
+		list      *List
+		blockedBy *List
+		err       error
+	}{
+		{"b waits on a", b, a, nil},
+		{"c waits on b", c, b, nil},
+		{"adding it again", c, b, nil},
+		{"a waits on b", a, b, ErrCycle},
+		{"a waits on c", a, c, ErrCycle},
+		{"a waits on itself", a, a, ErrCycle},
+		{"c waits on a as well", c, a, nil},
+		{"d waits on c", d, c, nil},
+		{"a waits on d", a, d, ErrCycle},
+		{"a waits on another workspace", a, elsewhere, ErrRecordNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.Dependencies.Insert(DefaultWorkspaceID, &Dependency{ListID: tt.list.ID, BlockedByID: tt.blockedBy.ID})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v; want %v", err, tt.err)
+			}
+		})
+	}
+
+	graph, err := models.Dependencies.GetGraph(DefaultWorkspaceID, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 4 {
+		t.Errorf("got %d nodes; want 4", len(graph.Nodes))
+	}
+	want := []Edge{{a.ID, b.ID}, {a.ID, c.ID}, {b.ID, c.ID}, {c.ID, d.ID}}
+	if len(graph.Edges) != len(want) {
+		t.Fatalf("got edges %v; want %v", graph.Edges, want)
+	}
+	for i := range want {
+		if graph.Edges[i] != want[i] {
+			t.Errorf("got edges %v; want %v", graph.Edges, want)
+			break
+		}
+	}
+
+	//a list stays blocked until everything it waits on directly is done
+	if !reload(t, models, c).Blocked {
+		t.Error("c is not blocked")
+	}
+	finished := reload(t, models, b)
+	finished.Status = "done"
+	if _, err := models.List.Update(finished); err != nil {
+		t.Fatal(err)
+	}
+	if !reload(t, models, c).Blocked {
+		t.Error("c is not blocked while a is open")
+	}
+	finished = reload(t, models, a)
+	finished.Status = "done"
+	if _, err := models.List.Update(finished); err != nil {
+		t.Fatal(err)
+	}
+	if reload(t, models, c).Blocked {
+		t.Error("c is still blocked")
+	}
+}
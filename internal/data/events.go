@@ -0,0 +1,107 @@
+//Filename: internal/data/events.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ListEventsChannel is the postgres NOTIFY channel the lists trigger announces new events on.
+// the notification payload is the id of the list_events row
+const ListEventsChannel = "list_events"
+
+// a ListEvent records a single change to the lists table. deleted lists keep their last state
+type ListEvent struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Event       string    `json:"event"`
+	ListID      int64     `json:"list_id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	List        *List     `json:"list"`
+}
+
+// define a ListEventModel which wraps a sql.db connection pool
+type ListEventModel struct {
+	DB *sql.DB
+}
+
+// GetSince() returns up to limit events in a workspace with an id greater than afterID, oldest first.
+// ids only commit in order within a workspace, so afterID must come from the same workspace
+func (m ListEventModel) GetSince(workspaceID, afterID int64, limit int) ([]*ListEvent, error) {
+	query := `
+		SELECT id, created_at, event, list_id, workspace_id, list
+		FROM list_events
+		WHERE id > $1
+		AND workspace_id = $3
+		ORDER BY id
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*ListEvent{}
+	for rows.Next() {
+		var event ListEvent
+		err := event.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Get() returns a single event by its id
+func (m ListEventModel) Get(id int64) (*ListEvent, error) {
+	query := `
+		SELECT id, created_at, event, list_id, workspace_id, list
+		FROM list_events
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var event ListEvent
+	err := event.scan(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// scan() reads a row of list_events into the event
+func (event *ListEvent) scan(row interface{ Scan(...interface{}) error }) error {
+	var list []byte
+	err := row.Scan(
+		&event.ID,
+		&event.CreatedAt,
+		&event.Event,
+		&event.ListID,
+		&event.WorkspaceID,
+		&list,
+	)
+	if err != nil {
+		return err
+	}
+	//the list was stored by to_jsonb() so its keys match the json tags on List
+	event.List = &List{}
+	return json.Unmarshal(list, event.List)
+}
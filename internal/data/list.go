@@ -7,18 +7,137 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"todo.joelical.net/internal/validator"
 )
 
 type List struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Task      string    `json:"task"`
-	Status    string    `json:"status"`
-	Version   int32     `json:"version"`
+	ID             int64      `json:"id"`
+	WorkspaceID    int64      `json:"workspace_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Name           string     `json:"name"`
+	Task           string     `json:"task"`
+	Status         string     `json:"status"`
+	DueDate        *time.Time `json:"due_date"`
+	Labels         []string   `json:"labels"`
+	Recurrence     string     `json:"recurrence"`
+	AssigneeIDs    []int64    `json:"assignee_ids"`
+	ParentID       *int64     `json:"parent_id"`
+	CompletionRule string     `json:"completion_rule"`
+	Estimate       *int32     `json:"estimate"`
+	Priority       int16      `json:"priority"`
+	Position       string     `json:"position"`
+	Progress       Progress   `json:"progress"`
+	Blocked        bool       `json:"blocked"`
+	Version        int32      `json:"version"`
+}
+
+// Progress counts how many of a list's direct subtasks are done
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// the priorities a list can have. lists start with none
+const (
+	PriorityNone   = 0
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+)
+
+// completion rules decide what finishing a list does to the lists around it
+const (
+	// nothing else changes
+	CompletionManual = "manual"
+	// finishing the list finishes all of its subtasks
+	CompletionCascade = "cascade"
+	// the list finishes itself once every one of its subtasks is done
+	CompletionAuto = "auto"
+)
+
+var CompletionRules = []string{CompletionManual, CompletionCascade, CompletionAuto}
+
+// doneSQL() returns a condition on a status column that matches DoneStatuses, the same test as Done()
+func doneSQL(column string) string {
+	return `lower(` + column + `) = ANY(` + pq.QuoteLiteral("{"+strings.Join(DoneStatuses, ",")+"}") + `::text[])`
+}
+
+// listColumns are the columns read whenever a list is loaded, in the order scanFields() expects.
+// the progress of a list is counted from its subtasks, and it is blocked while any list it depends on isn't done
+var listColumns = `id, workspace_id, created_at, name, task, status, due_date, labels, recurrence, assignee_ids, parent_id, completion_rule, estimate, priority, position, version,
+	(SELECT COUNT(*) FROM lists AS child WHERE child.parent_id = lists.id),
+	(SELECT COUNT(*) FROM lists AS child WHERE child.parent_id = lists.id AND ` + doneSQL("child.status") + `),
+	EXISTS (
+		SELECT 1
+		FROM list_dependencies AS dependency
+		INNER JOIN lists AS blocker ON blocker.id = dependency.blocked_by_id
+		WHERE dependency.list_id = lists.id
+		AND NOT ` + doneSQL("blocker.status") + `
+	)`
+
+// scanFields() returns pointers to the list's fields in the order of listColumns
+func (l *List) scanFields() []interface{} {
+	return []interface{}{
+		&l.ID,
+		&l.WorkspaceID,
+		&l.CreatedAt,
+		&l.Name,
+		&l.Task,
+		&l.Status,
+		&l.DueDate,
+		pq.Array(&l.Labels),
+		&l.Recurrence,
+		pq.Array(&l.AssigneeIDs),
+		&l.ParentID,
+		&l.CompletionRule,
+		&l.Estimate,
+		&l.Priority,
+		&l.Position,
+		&l.Version,
+		&l.Progress.Total,
+		&l.Progress.Done,
+		&l.Blocked,
+	}
+}
+
+// writeArgs() returns the values of the columns a client can change:
+// name, task, status, due_date, labels, recurrence, assignee_ids, parent_id, completion_rule, estimate and priority
+func (l *List) writeArgs() []interface{} {
+	//the labels and assignee_ids columns do not allow NULL
+	if l.Labels == nil {
+		l.Labels = []string{}
+	}
+	if l.AssigneeIDs == nil {
+		l.AssigneeIDs = []int64{}
+	}
+	if l.CompletionRule == "" {
+		l.CompletionRule = CompletionManual
+	}
+	return []interface{}{
+		l.Name,
+		l.Task,
+		l.Status,
+		l.DueDate,
+		pq.Array(l.Labels),
+		l.Recurrence,
+		pq.Array(l.AssigneeIDs),
+		l.ParentID,
+		l.CompletionRule,
+		l.Estimate,
+		l.Priority,
+	}
+}
+
+// status is free text, these are the values that mean a task is finished
+var DoneStatuses = []string{"done", "complete", "completed"}
+
+// Done() reports whether the list's status marks it as finished
+func (l *List) Done() bool {
+	return validator.In(strings.ToLower(l.Status), DoneStatuses...)
 }
 
 func ValidateList(v *validator.Validator, list *List) {
@@ -32,6 +151,39 @@ func ValidateList(v *validator.Validator, list *List) {
 	v.Check(list.Status != "", "status", "must be provied")
 	v.Check(len(list.Status) <= 300, "status", "must not be more than 200 bytes long")
 
+	v.Check(len(list.Labels) <= 20, "labels", "must not contain more than 20 labels")
+	v.Check(validator.Unique(list.Labels), "labels", "must not contain duplicate values")
+	for _, label := range list.Labels {
+		v.Check(label != "", "labels", "must not contain empty values")
+		v.Check(len(label) <= 50, "labels", "must not contain values more than 50 bytes long")
+	}
+
+	if list.Recurrence != "" {
+		_, err := validator.ParseRRule(list.Recurrence)
+		v.Check(err == nil, "recurrence", fmt.Sprint(err))
+		v.Check(list.DueDate != nil, "due_date", "must be provided for a recurring task")
+	}
+
+	v.Check(len(list.AssigneeIDs) <= 20, "assignee_ids", "must not contain more than 20 members")
+	seen := make(map[int64]bool)
+	for _, id := range list.AssigneeIDs {
+		v.Check(id > 0, "assignee_ids", "must only contain member ids")
+		v.Check(!seen[id], "assignee_ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+
+	if list.ParentID != nil {
+		v.Check(*list.ParentID > 0, "parent_id", "must be a valid list id")
+		v.Check(*list.ParentID != list.ID, "parent_id", "must not be the list itself")
+	}
+	v.Check(list.CompletionRule == "" || validator.In(list.CompletionRule, CompletionRules...), "completion_rule", "must be one of manual, cascade or auto")
+
+	if list.Estimate != nil {
+		v.Check(*list.Estimate >= 0, "estimate", "must not be negative")
+		v.Check(*list.Estimate <= 100000, "estimate", "must not be more than 100000")
+	}
+	v.Check(list.Priority >= PriorityNone && list.Priority <= PriorityHigh, "priority", "must be between 0 and 3")
+
 }
 
 // define a ListModel which wraps a sql.db connection pool
@@ -39,37 +191,108 @@ type ListModel struct {
 	DB *sql.DB
 }
 
-// Insert() allows us to creat a new list
+// Insert() allows us to creat a new list. it returns ErrQuotaExceeded if the list's workspace is full
 func (m ListModel) Insert(list *List) error {
-	query := `
-		INSERT INTO lists (name, task, status)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at, version
-	`
 	//Create a context. time starts when context is created
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	//cleanup to prevent memory leaks
 	defer cancel()
-	//collect the data fields into a slice
-	args := []interface{}{
-		list.Name,
-		list.Task,
-		list.Status,
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	defer tx.Rollback()
+
+	err = reserveLists(ctx, tx, list.WorkspaceID, 1)
+	if err != nil {
+		return err
+	}
+	err = insertList(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Get() allows us to retrieve a specfic list
-func (m ListModel) Get(id int64) (*List, error) {
+// InsertAll() creates every list in a single transaction, either all of them are saved or none are.
+// it returns ErrQuotaExceeded if they don't all fit in their workspace
+func (m ListModel) InsertAll(lists []*List) error {
+	//a large import gets longer than a single insert
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	counts := make(map[int64]int)
+	for _, list := range lists {
+		counts[list.WorkspaceID]++
+	}
+	for workspaceID, n := range counts {
+		err = reserveLists(ctx, tx, workspaceID, n)
+		if err != nil {
+			return err
+		}
+	}
+	for _, list := range lists {
+		err = insertList(ctx, tx, list)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertList() runs the insert for Insert(), InsertAll() and UpdateWithNext().
+// it returns ErrInvalidAssignee if the list is assigned to someone who isn't a member of the workspace,
+// and a subtask's parent must be in the same workspace, otherwise ErrInvalidParent is returned
+func insertList(ctx context.Context, tx *sql.Tx, list *List) error {
+	if list.ParentID != nil {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM lists WHERE id = $1 AND workspace_id = $2)`,
+			*list.ParentID, list.WorkspaceID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrInvalidParent
+		}
+	}
+	err := checkAssignees(ctx, tx, list)
+	if err != nil {
+		return err
+	}
+	//new lists go to the end. the caller has locked the workspace so no other insert can take the same position
+	position, err := nextPosition(ctx, tx, list.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	list.Position = position
+	query := `
+		INSERT INTO lists (name, task, status, due_date, labels, recurrence, assignee_ids, parent_id, completion_rule, estimate, priority, workspace_id, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at, version
+	`
+	args := append(list.writeArgs(), list.WorkspaceID, list.Position)
+	return tx.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+}
+
+// Get() allows us to retrieve a specfic list from a workspace
+func (m ListModel) Get(workspaceID, id int64) (*List, error) {
 	//ensure that there is a valid id
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	//create the query
 	query := `
-		SELECT id, created_at, name, task, status,version
+		SELECT ` + listColumns + `
 		FROM lists
 		WHERE id = $1
+		AND workspace_id = $2
 	`
 	//declare a list variable to hold the returned data
 	var list List
@@ -78,14 +301,7 @@ func (m ListModel) Get(id int64) (*List, error) {
 	//cleanup to prevent memory leaks
 	defer cancel()
 	//execute the query using QueryRow(.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&list.ID,
-		&list.CreatedAt,
-		&list.Name,
-		&list.Task,
-		&list.Status,
-		&list.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id, workspaceID).Scan(list.scanFields()...)
 	//handle any errors
 	if err != nil {
 		//check the type of error
@@ -102,86 +318,608 @@ func (m ListModel) Get(id int64) (*List, error) {
 
 // Update() allows us edit a specific list
 // optimistic locking on the version # enssure version has not changed from when i first read it to when will write it back with new changes
-func (m ListModel) Update(list *List) error {
+// the version being replaced is saved to the list_revisions table in the same transaction.
+// it returns the other lists that were finished by completion rules
+func (m ListModel) Update(list *List) ([]*List, error) {
+	//Create a context. time starts when context is created
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//cleanup to prevent memory leaks
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	//rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	completed, err := updateList(ctx, tx, list)
+	if err != nil {
+		return nil, err
+	}
+	return completed, tx.Commit()
+}
+
+// UpdateWithNext() saves the changes to list and creates next in the same transaction.
+// it is used when finishing a recurring task creates its next occurrence, which counts towards the workspace quota
+func (m ListModel) UpdateWithNext(list *List, next *List) ([]*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	completed, err := updateList(ctx, tx, list)
+	if err != nil {
+		return nil, err
+	}
+	err = reserveLists(ctx, tx, next.WorkspaceID, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = insertList(ctx, tx, next)
+	if err != nil {
+		return nil, err
+	}
+	return completed, tx.Commit()
+}
+
+// updateList() takes a snapshot of the current version and then applies the update, inside the caller's transaction.
+// a new parent is checked for cycles, and then the completion rules of the list and its parents are applied
+func updateList(ctx context.Context, tx *sql.Tx, list *List) ([]*List, error) {
+	previousQuery := `
+		SELECT status, parent_id
+		FROM lists
+		WHERE id = $1
+		AND version = $2
+	`
+	//lock the row we are about to change and take a snapshot of it
+	snapshotQuery := `
+		SELECT to_jsonb(lists)
+		FROM lists
+		WHERE id = $1
+		AND version = $2
+		FOR UPDATE
+	`
 	//create a query using the newly updated data
 	query := `
 		UPDATE lists
 		SET name = $1,
 			task = $2,
 			status = $3,
+			due_date = $4,
+			labels = $5,
+			recurrence = $6,
+			assignee_ids = $7,
+			parent_id = $8,
+			completion_rule = $9,
+			estimate = $10,
+			priority = $11,
 			version = version + 1
-		WHERE id = $4
-		AND version = $5 
+		WHERE id = $12
+		AND version = $13
 		RETURNING version
 	`
-	//Create a context. time starts when context is created
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	//cleanup to prevent memory leaks
-	defer cancel()
-
-	args := []interface{}{
-		list.Name,
-		list.Task,
-		list.Status,
-		list.ID,
-		list.Version,
-	}
 	//check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	var previousStatus string
+	var previousParent *int64
+	err := tx.QueryRowContext(ctx, previousQuery, list.ID, list.Version).Scan(&previousStatus, &previousParent)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrEditConflict
+			return nil, ErrEditConflict
 		default:
-			return err
+			return nil, err
+		}
+	}
+	statusChanged := list.Status != previousStatus
+	moved := !sameID(previousParent, list.ParentID)
+	//changes that involve other lists lock the workspace first. it is always taken before any list row
+	//so this can't deadlock with Move() or an insert
+	if statusChanged || moved {
+		err = lockWorkspace(ctx, tx, list.WorkspaceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	//the version can't have changed without the status and parent being read again
+	var snapshot []byte
+	err = tx.QueryRowContext(ctx, snapshotQuery, list.ID, list.Version).Scan(&snapshot)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
 		}
 	}
+	//a list changing status moves to another column of the board
+	if statusChanged {
+		err = checkWIPLimit(ctx, tx, list)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if moved && list.ParentID != nil {
+		err = checkParent(ctx, tx, list)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = checkAssignees(ctx, tx, list)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, revisionQuery, list.ID, list.Version, string(snapshot))
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(list.writeArgs(), list.ID, list.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	finished := list.Done() && !(&List{Status: previousStatus}).Done()
+	var completed []int64
+	if finished && list.CompletionRule == CompletionCascade {
+		ids, err := completeSubtasks(ctx, tx, list.WorkspaceID, list.ID)
+		if err != nil {
+			return nil, err
+		}
+		completed = append(completed, ids...)
+	}
+	if list.Done() && (finished || moved) {
+		ids, err := completeParents(ctx, tx, list.WorkspaceID, list.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		completed = append(completed, ids...)
+	}
+	//the subtask that was moved away may have been the last one left to do
+	if moved {
+		ids, err := completeParents(ctx, tx, list.WorkspaceID, previousParent)
+		if err != nil {
+			return nil, err
+		}
+		completed = append(completed, ids...)
+	}
+	if len(completed) == 0 {
+		return nil, nil
+	}
+	//finishing subtasks changes the list's progress
+	lists, err := getLists(ctx, tx, append(completed, list.ID))
+	if err != nil {
+		return nil, err
+	}
+	others := []*List{}
+	for _, l := range lists {
+		if l.ID == list.ID {
+			list.Progress = l.Progress
+			continue
+		}
+		others = append(others, l)
+	}
+	return others, nil
+}
+
+// checkAssignees() makes sure everyone the list is assigned to is a member of its workspace.
+// the members are locked until the transaction ends, so one can't be removed before the list is saved
+func checkAssignees(ctx context.Context, tx *sql.Tx, list *List) error {
+	if len(list.AssigneeIDs) == 0 {
+		return nil
+	}
+	query := `
+		SELECT id
+		FROM workspace_members
+		WHERE workspace_id = $1 AND id = ANY($2)
+		FOR KEY SHARE
+	`
+	rows, err := tx.QueryContext(ctx, query, list.WorkspaceID, pq.Array(list.AssigneeIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found := 0
+	for rows.Next() {
+		found++
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	//ValidateList() has rejected duplicates, so every id must have matched a member
+	if found != len(list.AssigneeIDs) {
+		return ErrInvalidAssignee
+	}
 	return nil
+}
+
+// revisionQuery saves the snapshot of a list version that is about to be replaced
+const revisionQuery = `
+	INSERT INTO list_revisions (list_id, version, snapshot)
+	VALUES ($1, $2, $3)
+`
 
+// sameID() reports whether two optional ids are equal
+func sameID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// checkParent() makes sure list's new parent is in the same workspace and isn't the list or one of its subtasks.
+// the caller holds the workspace lock so two lists can't be moved under each other at the same time
+func checkParent(ctx context.Context, tx *sql.Tx, list *List) error {
+	//walk up from the new parent. reaching the list itself would make a cycle
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id
+			FROM lists
+			WHERE id = $1
+			AND workspace_id = $2
+			UNION
+			SELECT lists.id, lists.parent_id
+			FROM lists
+			INNER JOIN ancestors ON lists.id = ancestors.parent_id
+		)
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE id = $3)
+		FROM ancestors
+	`
+	var found, cycles int
+	err := tx.QueryRowContext(ctx, query, *list.ParentID, list.WorkspaceID, list.ID).Scan(&found, &cycles)
+	if err != nil {
+		return err
+	}
+	if found == 0 || cycles > 0 {
+		return ErrInvalidParent
+	}
+	return nil
 }
 
-// Delete() allows us to remove a specific list
-func (m ListModel) Delete(id int64) error {
+// subtreeQuery selects the ids of every subtask of $1, at any depth
+const subtreeQuery = `
+	WITH RECURSIVE subtree AS (
+		SELECT id
+		FROM lists
+		WHERE parent_id = $1
+		UNION
+		SELECT lists.id
+		FROM lists
+		INNER JOIN subtree ON lists.parent_id = subtree.id
+	)
+`
+
+// completeSubtasks() finishes every subtask of the list that isn't done yet, for the cascade rule
+func completeSubtasks(ctx context.Context, tx *sql.Tx, workspaceID, id int64) ([]int64, error) {
+	query := subtreeQuery + `
+		SELECT id
+		FROM lists
+		WHERE id IN (SELECT id FROM subtree)
+		AND NOT ` + doneSQL("status") + `
+		ORDER BY id
+		FOR UPDATE
+	`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, markDone(ctx, tx, workspaceID, ids)
+}
+
+// completeParents() walks up from parentID finishing each parent with the auto rule whose subtasks are now all done
+func completeParents(ctx context.Context, tx *sql.Tx, workspaceID int64, parentID *int64) ([]int64, error) {
+	ids := []int64{}
+	seen := make(map[int64]bool)
+	for parentID != nil && !seen[*parentID] {
+		id := *parentID
+		seen[id] = true
+		var rule string
+		var done bool
+		err := tx.QueryRowContext(ctx, `SELECT parent_id, completion_rule, `+doneSQL("status")+` FROM lists WHERE id = $1 FOR UPDATE`, id).Scan(&parentID, &rule, &done)
+		if err != nil {
+			return nil, err
+		}
+		if rule != CompletionAuto || done {
+			break
+		}
+		var total, open int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(*) FILTER (WHERE NOT `+doneSQL("status")+`) FROM lists WHERE parent_id = $1`, id).Scan(&total, &open)
+		if err != nil {
+			return nil, err
+		}
+		if total == 0 || open > 0 {
+			break
+		}
+		err = markDone(ctx, tx, workspaceID, []int64{id})
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// markDone() sets the lists' status to done, saving a revision of each first. like any other change
+// of status it returns ErrWIPLimitExceeded if they don't all fit in the done column
+func markDone(ctx context.Context, tx *sql.Tx, workspaceID int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := checkColumnRoom(ctx, tx, workspaceID, DoneStatuses[0], ids)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO list_revisions (list_id, version, snapshot)
+		SELECT id, version, to_jsonb(lists)
+		FROM lists
+		WHERE id = ANY($1)
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE lists
+		SET status = $1,
+			version = version + 1
+		WHERE id = ANY($2)
+	`, DoneStatuses[0], pq.Array(ids))
+	return err
+}
+
+// getLists() loads lists by id inside the caller's transaction
+func getLists(ctx context.Context, tx *sql.Tx, ids []int64) ([]*List, error) {
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE id = ANY($1)
+		ORDER BY id
+	`
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// Delete() allows us to remove a specific list from a workspace.
+// its subtasks are deleted with it and their ids are returned
+func (m ListModel) Delete(workspaceID, id int64) ([]int64, error) {
 	//check if the id exist
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
 	//create the delete query
 	query := `
 		DELETE FROM lists
 		WHERE id = $1
+		AND workspace_id = $2
 	`
 	//Create a context. time starts when context is created
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	//cleanup to prevent memory leaks
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	//deleting a subtree locks many rows, so like the other changes that span lists it takes the workspace first
+	err = lockWorkspace(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := subtaskIDs(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
 	//execute the query
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := tx.ExecContext(ctx, query, id, workspaceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	//check how many rows affected by the delte operation. we will use the RowsAffected() on the result variable
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	//check to see if zero rows were affected
 	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
-	return nil
+	return subtasks, tx.Commit()
 }
 
-// the GetAll() method returns a list of all the list sorted by id
-func (m ListModel) GetAll(name string, status string, filters Filters) ([]*List, Metadata, error) {
+// DeleteVersion() removes a list only if it is still at the given version. like Delete() it returns the ids of its subtasks
+func (m ListModel) DeleteVersion(workspaceID, id int64, version int32) ([]int64, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM lists
+		WHERE id = $1
+		AND version = $2
+		AND workspace_id = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockWorkspace(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	subtasks, err := subtaskIDs(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, query, id, version, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	//either someone changed the list or it is already gone
+	if rowsAffected == 0 {
+		return nil, ErrEditConflict
+	}
+	return subtasks, tx.Commit()
+}
+
+// subtaskIDs() locks and returns the ids of every subtask of a list, at any depth
+func subtaskIDs(ctx context.Context, tx *sql.Tx, id int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, subtreeQuery+`SELECT id FROM lists WHERE id IN (SELECT id FROM subtree) ORDER BY id FOR UPDATE`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// a Subtask is a list shown inside its parent, along with its own subtasks
+type Subtask struct {
+	*List
+	Subtasks []*Subtask `json:"subtasks"`
+}
+
+// GetSubtasks() returns the subtasks of a list as a tree, fetched with a recursive query so any depth is covered
+func (m ListModel) GetSubtasks(workspaceID, id int64) ([]*Subtask, error) {
+	query := subtreeQuery + `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE id IN (SELECT id FROM subtree)
+		AND workspace_id = $2
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	//every list in the subtree has its parent in the subtree or is a direct subtask of id
+	nodes := make(map[int64]*Subtask, len(lists))
+	for _, list := range lists {
+		nodes[list.ID] = &Subtask{List: list, Subtasks: []*Subtask{}}
+	}
+	subtasks := []*Subtask{}
+	for _, list := range lists {
+		if *list.ParentID == id {
+			subtasks = append(subtasks, nodes[list.ID])
+			continue
+		}
+		if parent, ok := nodes[*list.ParentID]; ok {
+			parent.Subtasks = append(parent.Subtasks, nodes[list.ID])
+		}
+	}
+	return subtasks, nil
+}
+
+// Assignee narrows GetAll() to the lists assigned to a member, or with Unassigned to lists nobody has.
+// the zero value matches every list
+type Assignee struct {
+	MemberID   int64
+	Unassigned bool
+}
+
+// Matches() reports whether the list is one GetAll() would return for the assignee
+func (a Assignee) Matches(list *List) bool {
+	switch {
+	case a.Unassigned:
+		return len(list.AssigneeIDs) == 0
+	case a.MemberID != 0:
+		for _, id := range list.AssigneeIDs {
+			if id == a.MemberID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// the GetAll() method returns a list of all the list in a workspace sorted by id
+func (m ListModel) GetAll(workspaceID int64, name string, status string, assignee Assignee, filters Filters) ([]*List, Metadata, error) {
 	//construct the query to return all schools
 	//make query into formated string to be able to sort by field and asc or dec dynaimicaly
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(),id, created_at, name, task, status, version
+		SELECT COUNT(*) OVER(), `+listColumns+`
 		FROM lists
 		WHERE (to_tsvector('simple',name) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (to_tsvector('simple',status) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND workspace_id = $5
+		AND (assignee_ids @> ARRAY[$6::bigint] OR $6 = 0)
+		AND (assignee_ids = '{}' OR NOT $7)
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortOrder())
 
@@ -189,7 +927,29 @@ func (m ListModel) GetAll(name string, status string, filters Filters) ([]*List,
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	//execute the query
-	args := []interface{}{name, status, filters.limit(), filters.offset()}
+	args := []interface{}{name, status, filters.limit(), filters.offset(), workspaceID, assignee.MemberID, assignee.Unassigned}
+	return m.getPage(ctx, query, args, filters)
+}
+
+// GetAssigned() returns the lists assigned to any of the members, from every workspace they are in.
+// the ones due soonest come first and those without a due date last, lists due at the same time go
+// from the highest priority down and then keep their order on the board
+func (m ListModel) GetAssigned(memberIDs []int64, filters Filters) ([]*List, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + listColumns + `
+		FROM lists
+		WHERE assignee_ids && $1::bigint[]
+		ORDER BY due_date ASC NULLS LAST, priority DESC, workspace_id, position, id
+		LIMIT $2 OFFSET $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{pq.Array(memberIDs), filters.limit(), filters.offset()}
+	return m.getPage(ctx, query, args, filters)
+}
+
+// getPage() runs a query that selects COUNT(*) OVER() followed by listColumns, and works out the page metadata
+func (m ListModel) getPage(ctx context.Context, query string, args []interface{}, filters Filters) ([]*List, Metadata, error) {
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -204,15 +964,7 @@ func (m ListModel) GetAll(name string, status string, filters Filters) ([]*List,
 	for rows.Next() {
 		var list List
 		//scan the values from the row into the List struct
-		err := rows.Scan(
-			&totalRecords,
-			&list.ID,
-			&list.CreatedAt,
-			&list.Name,
-			&list.Task,
-			&list.Status,
-			&list.Version,
-		)
+		err := rows.Scan(append([]interface{}{&totalRecords}, list.scanFields()...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -227,3 +979,94 @@ func (m ListModel) GetAll(name string, status string, filters Filters) ([]*List,
 	//return the result set. the slice of lists
 	return lists, metadata, nil
 }
+
+// Export() streams every list matching the filters and the assignee to fn, in the order given by filters.Sort.
+// the rows are read through a server-side cursor so the whole result is never held in memory
+func (m ListModel) Export(workspaceID int64, name string, status string, assignee Assignee, filters Filters, fn func(*List) error) error {
+	query := fmt.Sprintf(`
+		DECLARE list_export NO SCROLL CURSOR FOR
+		SELECT `+listColumns+`
+		FROM lists
+		WHERE (to_tsvector('simple',name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (to_tsvector('simple',status) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		AND workspace_id = $3
+		AND (assignee_ids @> ARRAY[$4::bigint] OR $4 = 0)
+		AND (assignee_ids = '{}' OR NOT $5)
+		ORDER BY %s %s, id ASC`, filters.sortColumn(), filters.sortOrder())
+
+	//an export can take a while so it gets as long as the server allows a response to take
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	//a cursor only lives as long as its transaction
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, name, status, workspaceID, assignee.MemberID, assignee.Unassigned)
+	if err != nil {
+		return err
+	}
+	for {
+		rows, err := tx.QueryContext(ctx, "FETCH 500 FROM list_export")
+		if err != nil {
+			return err
+		}
+		fetched := 0
+		for rows.Next() {
+			var list List
+			err := rows.Scan(list.scanFields()...)
+			if err == nil {
+				err = fn(&list)
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			fetched++
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		if fetched == 0 {
+			return nil
+		}
+	}
+}
+
+// GetAllDue() returns every list in a workspace that has a due date and matches the assignee, soonest first
+func (m ListModel) GetAllDue(workspaceID int64, assignee Assignee) ([]*List, error) {
+	query := `
+		SELECT ` + listColumns + `
+		FROM lists
+		WHERE due_date IS NOT NULL
+		AND workspace_id = $1
+		AND (assignee_ids @> ARRAY[$2::bigint] OR $2 = 0)
+		AND (assignee_ids = '{}' OR NOT $3)
+		ORDER BY due_date, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, assignee.MemberID, assignee.Unassigned)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(list.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
@@ -0,0 +1,369 @@
+//Filename: internal/data/list_test.go
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestListAssignees(t *testing.T) {
+	models := newTestDB(t)
+	other := &Workspace{Name: "Other", MaxLists: 10}
+	if err := models.Workspaces.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Role: RoleMember}
+	alex := &Member{WorkspaceID: DefaultWorkspaceID, Name: "alex", Role: RoleMember}
+	outsider := &Member{WorkspaceID: other.ID, Name: "kim", Role: RoleMember}
+	for _, member := range []*Member{sam, alex, outsider} {
+		if err := models.Members.Insert(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	later, sooner := time.Now().Add(48*time.Hour), time.Now().Add(time.Hour)
+	newList := func(due *time.Time, assignees ...int64) *List {
+		list := &List{WorkspaceID: DefaultWorkspaceID, Name: "n", Task: "t", Status: "todo", DueDate: due, AssigneeIDs: assignees}
+		if err := models.List.Insert(list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	undated := newList(nil, sam.ID)
+	dueLater := newList(&later, sam.ID, alex.ID)
+	dueSooner := newList(&sooner, sam.ID)
+	nobodys := newList(nil)
+
+	//only members of the list's workspace can be assigned
+	nobodys.AssigneeIDs = []int64{outsider.ID}
+	if _, err := models.List.Update(nobodys); !errors.Is(err, ErrInvalidAssignee) {
+		t.Errorf("assigning a member of another workspace returned %v; want ErrInvalidAssignee", err)
+	}
+	err := models.List.Insert(&List{WorkspaceID: DefaultWorkspaceID, Name: "n", Task: "t", Status: "todo", AssigneeIDs: []int64{outsider.ID}})
+	if !errors.Is(err, ErrInvalidAssignee) {
+		t.Errorf("creating a list for a member of another workspace returned %v; want ErrInvalidAssignee", err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "id", SortList: []string{"id"}}
+	ids := func(lists []*List) []int64 {
+		got := []int64{}
+		for _, list := range lists {
+			got = append(got, list.ID)
+		}
+		return got
+	}
+	tests := []struct {
+		name     string
+		assignee Assignee
+		want     []int64
+	}{
+		{"anyone", Assignee{}, []int64{undated.ID, dueLater.ID, dueSooner.ID, nobodys.ID}},
+		{"alex", Assignee{MemberID: alex.ID}, []int64{dueLater.ID}},
+		{"nobody", Assignee{Unassigned: true}, []int64{nobodys.ID}},
+	}
+	for _, tt := range tests {
+		lists, _, err := models.List.GetAll(DefaultWorkspaceID, "", "", tt.assignee, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(lists); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got lists %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	//sam's tasks come soonest first with the undated one last
+	lists, metadata, err := models.List.GetAssigned([]int64{sam.ID}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(lists), []int64{dueSooner.ID, dueLater.ID, undated.ID}; fmt.Sprint(got) != fmt.Sprint(want) || metadata.TotalRecords != 3 {
+		t.Errorf("got sam's lists %v of %d; want %v", got, metadata.TotalRecords, want)
+	}
+
+	//removing a member takes them off their lists as a new version
+	if err := models.Members.Delete(DefaultWorkspaceID, sam.ID); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := models.List.Get(DefaultWorkspaceID, dueLater.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(fresh.AssigneeIDs) != fmt.Sprint([]int64{alex.ID}) || fresh.Version != dueLater.Version+1 {
+		t.Errorf("got assignees %v at version %d; want [%d] at %d", fresh.AssigneeIDs, fresh.Version, alex.ID, dueLater.Version+1)
+	}
+	if _, err := models.Revisions.Get(dueLater.ID, dueLater.Version); err != nil {
+		t.Errorf("the version before sam was removed was not kept: %v", err)
+	}
+}
+
+func TestGetAssigned(t *testing.T) {
+	models := newTestDB(t)
+	other := &Workspace{Name: "Other", MaxLists: 10, EstimateUnit: EstimatePoints}
+	third := &Workspace{Name: "Third", MaxLists: 10, EstimateUnit: EstimatePoints}
+	for _, workspace := range []*Workspace{other, third} {
+		if err := models.Workspaces.Insert(workspace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Email: "sam@example.com", Role: RoleMember}
+	samElsewhere := &Member{WorkspaceID: other.ID, Name: "sam", Email: "sam@example.com", Role: RoleMember}
+	//an admin of another workspace can use anyone's email, only the sso account ties members together
+	impostor := &Member{WorkspaceID: third.ID, Name: "not sam", Email: "SAM@example.com", Role: RoleMember}
+	for _, member := range []*Member{sam, samElsewhere, impostor} {
+		if err := models.Members.Insert(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, member := range []*Member{sam, samElsewhere} {
+		if _, err := models.Members.LinkSubject(member.WorkspaceID, member.Email, "sub-sam"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due := time.Now().Add(24 * time.Hour)
+	newList := func(workspaceID int64, due *time.Time, priority int16, assignee int64) *List {
+		list := &List{WorkspaceID: workspaceID, Name: "n", Task: "t", Status: "todo", DueDate: due, Priority: priority, AssigneeIDs: []int64{assignee}}
+		if err := models.List.Insert(list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	low := newList(DefaultWorkspaceID, &due, PriorityLow, sam.ID)
+	high := newList(DefaultWorkspaceID, &due, PriorityHigh, sam.ID)
+	undated := newList(DefaultWorkspaceID, nil, PriorityHigh, sam.ID)
+	medium := newList(other.ID, &due, PriorityMedium, samElsewhere.ID)
+	newList(third.ID, &due, PriorityHigh, impostor.ID)
+
+	tests := []struct {
+		name   string
+		member *Member
+		want   []int64
+	}{
+		{"sam", sam, []int64{high.ID, medium.ID, low.ID, undated.ID}},
+		{"sam in the other workspace", samElsewhere, []int64{high.ID, medium.ID, low.ID, undated.ID}},
+	}
+	filters := Filters{Page: 1, PageSize: 20, Sort: "due_date", SortList: []string{"due_date"}}
+	for _, tt := range tests {
+		memberIDs, err := models.Members.GetLinkedIDs(tt.member.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lists, _, err := models.List.GetAssigned(memberIDs, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int64{}
+		for _, list := range lists {
+			got = append(got, list.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got lists %v; want %v", tt.name, got, tt.want)
+		}
+	}
+
+	//a member who has never signed in with sso only has their own
+	memberIDs, err := models.Members.GetLinkedIDs(impostor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(memberIDs) != fmt.Sprint([]int64{impostor.ID}) {
+		t.Errorf("got linked members %v; want [%d]", memberIDs, impostor.ID)
+	}
+}
+
+func TestSameID(t *testing.T) {
+	one, alsoOne, two := int64(1), int64(1), int64(2)
+	tests := []struct {
+		a, b *int64
+		want bool
+	}{
+		{nil, nil, true},
+		{&one, nil, false},
+		{nil, &one, false},
+		{&one, &alsoOne, true},
+		{&one, &two, false},
+	}
+	for _, tt := range tests {
+		if got := sameID(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameID(%v, %v) = %t; want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateListParentCycles(t *testing.T) {
+	models := newTestDB(t)
+	//a -> b -> c
+	a := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	b := newTestList(t, models, DefaultWorkspaceID, a.ID, CompletionManual)
+	c := newTestList(t, models, DefaultWorkspaceID, b.ID, CompletionManual)
+	other := &Workspace{Name: "Other", MaxLists: 10, EstimateUnit: EstimatePoints}
+	if err := models.Workspaces.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	elsewhere := newTestList(t, models, other.ID, 0, CompletionManual)
+
+	tests := []struct {
+		name   string
+		list   *List
+		parent int64
+		err    error
+	}{
+		{"under itself", a, a.ID, ErrInvalidParent},
+		{"under its child", a, b.ID, ErrInvalidParent},
+		{"under its grandchild", a, c.ID, ErrInvalidParent},
+		{"under another workspace", c, elsewhere.ID, ErrInvalidParent},
+		{"under a missing list", c, c.ID + 1000, ErrInvalidParent},
+		{"up a level", c, a.ID, nil},
+		{"under its old sibling", b, c.ID, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := reload(t, models, tt.list)
+			list.ParentID = &tt.parent
+			_, err := models.List.Update(list)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v; want %v", err, tt.err)
+			}
+			if err == nil && *reload(t, models, list).ParentID != tt.parent {
+				t.Errorf("the parent was not saved")
+			}
+		})
+	}
+}
+
+func TestUpdateListCompletionRules(t *testing.T) {
+	models := newTestDB(t)
+	ids := func(lists []*List) []int64 {
+		ids := []int64{}
+		for _, list := range lists {
+			ids = append(ids, list.ID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+	finish := func(list *List) []*List {
+		t.Helper()
+		list = reload(t, models, list)
+		list.Status = "done"
+		completed, err := models.List.Update(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return completed
+	}
+
+	t.Run("cascade", func(t *testing.T) {
+		parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionCascade)
+		open := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		nested := newTestList(t, models, DefaultWorkspaceID, open.ID, CompletionManual)
+		already := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		finish(already)
+
+		completed := finish(parent)
+		if got := ids(completed); len(got) != 2 || got[0] != open.ID || got[1] != nested.ID {
+			t.Errorf("completed %v; want [%d %d]", got, open.ID, nested.ID)
+		}
+		for _, list := range []*List{open, nested} {
+			if !reload(t, models, list).Done() {
+				t.Errorf("list %d is not done", list.ID)
+			}
+		}
+	})
+
+	t.Run("manual", func(t *testing.T) {
+		parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+		child := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		if completed := finish(parent); len(completed) != 0 {
+			t.Errorf("completed %v; want nothing", ids(completed))
+		}
+		if reload(t, models, child).Done() {
+			t.Error("the subtask of a manual list was finished")
+		}
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		//grandparent and parent both finish themselves
+		grandparent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionAuto)
+		parent := newTestList(t, models, DefaultWorkspaceID, grandparent.ID, CompletionAuto)
+		first := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		second := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+
+		if completed := finish(first); len(completed) != 0 {
+			t.Errorf("completed %v with a subtask still open", ids(completed))
+		}
+		completed := finish(second)
+		if got := ids(completed); len(got) != 2 || got[0] != grandparent.ID || got[1] != parent.ID {
+			t.Errorf("completed %v; want [%d %d]", got, grandparent.ID, parent.ID)
+		}
+	})
+
+	t.Run("auto after moving the last open subtask away", func(t *testing.T) {
+		parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionAuto)
+		done := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		open := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		finish(done)
+
+		moved := reload(t, models, open)
+		moved.ParentID = nil
+		completed, err := models.List.Update(moved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(completed); len(got) != 1 || got[0] != parent.ID {
+			t.Errorf("completed %v; want [%d]", got, parent.ID)
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+		child := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+		finish(child)
+		if got := reload(t, models, parent).Progress; got != (Progress{Done: 1, Total: 2}) {
+			t.Errorf("got progress %+v; want 1 of 2", got)
+		}
+	})
+}
+
+func TestDeleteListWithSubtasks(t *testing.T) {
+	models := newTestDB(t)
+	parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	child := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+	grandchild := newTestList(t, models, DefaultWorkspaceID, child.ID, CompletionManual)
+
+	deleted, err := models.List.Delete(DefaultWorkspaceID, parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 || deleted[0] != child.ID || deleted[1] != grandchild.ID {
+		t.Errorf("got subtasks %v; want [%d %d]", deleted, child.ID, grandchild.ID)
+	}
+	_, err = models.List.Get(DefaultWorkspaceID, grandchild.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v for a deleted subtask; want ErrRecordNotFound", err)
+	}
+}
+
+func TestAssigneeMatches(t *testing.T) {
+	tests := []struct {
+		assignee  Assignee
+		assignees []int64
+		want      bool
+	}{
+		{Assignee{}, nil, true},
+		{Assignee{}, []int64{3}, true},
+		{Assignee{MemberID: 3}, []int64{4, 3}, true},
+		{Assignee{MemberID: 3}, []int64{4}, false},
+		{Assignee{MemberID: 3}, nil, false},
+		{Assignee{Unassigned: true}, nil, true},
+		{Assignee{Unassigned: true}, []int64{3}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.assignee.Matches(&List{AssigneeIDs: tt.assignees}); got != tt.want {
+			t.Errorf("%+v.Matches(%v) = %t; want %t", tt.assignee, tt.assignees, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+//Filename: internal/data/members.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+	"todo.joelical.net/internal/validator"
+)
+
+// a Member is someone who works in a workspace. Name is how they appear to others, Email is where password
+// resets go and what they sign in with, and Role decides what they are allowed to change
+type Member struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Password    password  `json:"-"`
+	Version     int32     `json:"version"`
+}
+
+// the roles a member can have, from the most to the least trusted.
+// owners and admins manage the workspace, members change lists and viewers only read them
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+var Roles = []string{RoleOwner, RoleAdmin, RoleMember, RoleViewer}
+
+// RoleAtLeast() reports whether role is as trusted as min or more
+func RoleAtLeast(role, min string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+		if r == min {
+			return false
+		}
+	}
+	return false
+}
+
+// a password is only ever kept as its bcrypt hash
+type password struct {
+	hash []byte
+}
+
+// Set() hashes the plaintext with bcrypt
+func (p *password) Set(plaintext string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), 12)
+	if err != nil {
+		return err
+	}
+	p.hash = hash
+	return nil
+}
+
+// Matches() reports whether the plaintext is the password. a member without a password matches nothing
+func (p *password) Matches(plaintext string) (bool, error) {
+	if len(p.hash) == 0 {
+		return false, nil
+	}
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// memberNameRX keeps names to letters, digits and a few marks, so a name can be written in text without quoting it
+var memberNameRX = regexp.MustCompile(`^[A-Za-z0-9_](?:[A-Za-z0-9_.-]{0,48}[A-Za-z0-9_])?$`)
+
+func ValidateMember(v *validator.Validator, member *Member) {
+	v.Check(member.Name != "", "name", "must be provided")
+	v.Check(len(member.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(member.Name == "" || validator.Matches(member.Name, memberNameRX), "name", "must only contain letters, digits, _, . and - and not end in . or -")
+
+	v.Check(len(member.Email) <= 254, "email", "must not be more than 254 bytes long")
+	v.Check(member.Email == "" || validator.Matches(member.Email, validator.EmailRX), "email", "must be a valid email address")
+
+	v.Check(validator.In(member.Role, Roles...), "role", "must be owner, admin, member or viewer")
+}
+
+// ValidatePasswordPlaintext() checks a new password is strong enough for the member
+func ValidatePasswordPlaintext(v *validator.Validator, plaintext string, member *Member) {
+	v.Check(plaintext != "", "password", "must be provided")
+	if weakness := validator.PasswordWeakness(plaintext, member.Name, member.Email); plaintext != "" && weakness != "" {
+		v.AddError("password", weakness)
+	}
+}
+
+// TokensRevokedChannel is the postgres NOTIFY channel "<member id> <unix time>" is sent on when a member's signed tokens
+// are revoked. they are checked without the database, so every server keeps the times in memory
+const TokensRevokedChannel = "tokens_revoked"
+
+// define a MemberModel which wraps a sql.db connection pool
+type MemberModel struct {
+	DB *sql.DB
+}
+
+const memberColumns = `id, workspace_id, created_at, name, email, role, password_hash, version`
+
+// scanFields() returns pointers to the member's fields in the order of memberColumns
+func (member *Member) scanFields() []interface{} {
+	return []interface{}{&member.ID, &member.WorkspaceID, &member.CreatedAt, &member.Name, &member.Email, &member.Role, &member.Password.hash, &member.Version}
+}
+
+// duplicateMember() turns a unique violation on a member's name or email into ErrDuplicateName or ErrDuplicateEmail
+func duplicateMember(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "workspace_members_workspace_id_name_key":
+			return ErrDuplicateName
+		case "workspace_members_email_idx":
+			return ErrDuplicateEmail
+		}
+	}
+	return err
+}
+
+// Insert() adds a member to member.WorkspaceID without a password, they set one with a password reset.
+// ErrDuplicateName or ErrDuplicateEmail mean someone in the workspace already has the name or email
+func (m MemberModel) Insert(member *Member) error {
+	query := `
+		INSERT INTO workspace_members (workspace_id, name, email, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{member.WorkspaceID, member.Name, member.Email, member.Role}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&member.ID, &member.CreatedAt, &member.Version)
+	return duplicateMember(err)
+}
+
+// Get() returns a member of the workspace
+func (m MemberModel) Get(workspaceID, id int64) (*Member, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	return m.getBy(`workspace_id = $1 AND id = $2`, workspaceID, id)
+}
+
+// GetByName() returns the member of the workspace with the given name
+func (m MemberModel) GetByName(workspaceID int64, name string) (*Member, error) {
+	return m.getBy(`workspace_id = $1 AND name = $2`, workspaceID, name)
+}
+
+// GetByEmail() returns the member of the workspace with the email, ignoring case
+func (m MemberModel) GetByEmail(workspaceID int64, email string) (*Member, error) {
+	if email == "" {
+		return nil, ErrRecordNotFound
+	}
+	return m.getBy(`workspace_id = $1 AND lower(email) = lower($2)`, workspaceID, email)
+}
+
+// GetForToken() returns the member a token that is still valid for purpose belongs to
+func (m MemberModel) GetForToken(purpose, plaintext string) (*Member, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	return m.getBy(`id = (SELECT member_id FROM tokens WHERE hash = $1 AND purpose = $2 AND expiry > NOW())`, hash[:], purpose)
+}
+
+// GetBySubject() returns the member of the workspace who signed in with sso as subject before
+func (m MemberModel) GetBySubject(workspaceID int64, subject string) (*Member, error) {
+	return m.getBy(`workspace_id = $1 AND oidc_subject = $2`, workspaceID, subject)
+}
+
+// LinkSubject() ties the sso subject to the member of the workspace with the email, on their first sign in.
+// a member already tied to another subject is left alone
+func (m MemberModel) LinkSubject(workspaceID int64, email, subject string) (*Member, error) {
+	if email == "" {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		UPDATE workspace_members
+		SET oidc_subject = $3
+		WHERE workspace_id = $1 AND lower(email) = lower($2) AND oidc_subject IS NULL
+		RETURNING ` + memberColumns
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var member Member
+	err := m.DB.QueryRowContext(ctx, query, workspaceID, email, subject).Scan(member.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &member, nil
+}
+
+// getBy() returns the member matching where, which compares columns to $1 and on
+func (m MemberModel) getBy(where string, args ...interface{}) (*Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		WHERE ` + where
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var member Member
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(member.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &member, nil
+}
+
+// GetAll() returns the members of a workspace sorted by name
+func (m MemberModel) GetAll(workspaceID int64) ([]*Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		WHERE workspace_id = $1
+		ORDER BY name, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(member.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetLinkedIDs() returns the id of the member and of every member of another workspace who signs in
+// with the same sso account, so the same person can be found across workspaces. emails aren't used for
+// this because any admin can give a member of their own workspace someone else's email
+func (m MemberModel) GetLinkedIDs(id int64) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM workspace_members
+		WHERE id = $1
+		OR oidc_subject = (SELECT oidc_subject FROM workspace_members WHERE id = $1)
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var linked int64
+		if err := rows.Scan(&linked); err != nil {
+			return nil, err
+		}
+		ids = append(ids, linked)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Update() renames a member or changes their email or role. the password is changed with ResetPassword()
+func (m MemberModel) Update(member *Member) error {
+	query := `
+		UPDATE workspace_members
+		SET name = $1,
+			email = $2,
+			role = $3,
+			version = version + 1
+		WHERE id = $4
+		AND workspace_id = $5
+		AND version = $6
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{member.Name, member.Email, member.Role, member.ID, member.WorkspaceID, member.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&member.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return duplicateMember(err)
+		}
+	}
+	return nil
+}
+
+// ResetPassword() saves the member's new password and uses up the reset token, so it only works once.
+// every other token the member has is revoked with it, signed ones too. ErrRecordNotFound means the token was already used
+func (m MemberModel) ResetPassword(member *Member, plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH used AS (
+			DELETE FROM tokens
+			WHERE hash = $1 AND purpose = $2 AND member_id = $3 AND expiry > NOW()
+			RETURNING member_id
+		)
+		UPDATE workspace_members
+		SET password_hash = $4, tokens_revoked_at = NOW(), version = version + 1
+		WHERE id = (SELECT member_id FROM used)
+		RETURNING version
+	`
+	err = tx.QueryRowContext(ctx, query, hash[:], PurposePasswordReset, member.ID, member.Password.hash).Scan(&member.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE member_id = $1`, member.ID)
+	if err != nil {
+		return err
+	}
+	err = notifyTokensRevoked(ctx, tx, member.ID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notifyTokensRevoked() tells every server the member's signed tokens issued until now are revoked.
+// the notification is only sent if tx commits
+func notifyTokensRevoked(ctx context.Context, tx *sql.Tx, memberID int64) error {
+	query := `SELECT pg_notify($1, $2::bigint || ' ' || floor(extract(epoch FROM NOW()))::bigint)`
+	_, err := tx.ExecContext(ctx, query, TokensRevokedChannel, memberID)
+	return err
+}
+
+// GetTokenRevocations() returns when each member's signed tokens were last revoked
+func (m MemberModel) GetTokenRevocations() (map[int64]time.Time, error) {
+	query := `
+		SELECT id, tokens_revoked_at
+		FROM workspace_members
+		WHERE tokens_revoked_at IS NOT NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[int64]time.Time)
+	for rows.Next() {
+		var id int64
+		var at time.Time
+		err := rows.Scan(&id, &at)
+		if err != nil {
+			return nil, err
+		}
+		revoked[id] = at
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// Delete() removes a member from a workspace along with their tokens, their signed tokens are revoked
+func (m MemberModel) Delete(workspaceID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM workspace_members
+		WHERE id = $1 AND workspace_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	err = notifyTokensRevoked(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
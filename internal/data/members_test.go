@@ -0,0 +1,178 @@
+//Filename: internal/data/members_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"todo.joelical.net/internal/validator"
+)
+
+func TestValidateMember(t *testing.T) {
+	tests := []struct {
+		name, email, role string
+		valid             bool
+	}{
+		{"sam", "", RoleMember, true},
+		{"sam.b", "sam@example.com", RoleOwner, true},
+		{"", "", RoleMember, false},
+		{"sam", "not an email", RoleMember, false},
+		{"sam smith", "", RoleMember, false},
+		{"sam.", "", RoleMember, false},
+		{"sam", "", "superuser", false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateMember(v, &Member{Name: tt.name, Email: tt.email, Role: tt.role})
+		if v.Valid() != tt.valid {
+			t.Errorf("ValidateMember(%q, %q, %q) valid = %t; want %t (%v)", tt.name, tt.email, tt.role, v.Valid(), tt.valid, v.Errors)
+		}
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role, min string
+		want      bool
+	}{
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleAdmin, true},
+		{RoleMember, RoleAdmin, false},
+		{RoleViewer, RoleMember, false},
+		{RoleViewer, RoleViewer, true},
+		{"", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := RoleAtLeast(tt.role, tt.min); got != tt.want {
+			t.Errorf("RoleAtLeast(%q, %q) = %t; want %t", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	var p password
+	if match, err := p.Matches(""); err != nil || match {
+		t.Errorf("a member without a password matched %q: %t, %v", "", match, err)
+	}
+	if err := p.Set("correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		plaintext string
+		want      bool
+	}{
+		{"correct horse battery", true},
+		{"correct horse batter", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if match, err := p.Matches(tt.plaintext); err != nil || match != tt.want {
+			t.Errorf("Matches(%q) = %t, %v; want %t", tt.plaintext, match, err, tt.want)
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Email: "Sam@Example.com", Role: RoleMember}
+	if err := models.Members.Insert(sam); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Members.Insert(&Member{WorkspaceID: DefaultWorkspaceID, Name: "sam2", Email: "sam@example.com", Role: RoleMember}); !errors.Is(err, ErrDuplicateEmail) {
+		t.Errorf("reusing sam's email returned %v; want ErrDuplicateEmail", err)
+	}
+	//names and emails only need to be unique within a workspace
+	other := &Workspace{Name: "Other", MaxLists: 10}
+	if err := models.Workspaces.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Members.Insert(&Member{WorkspaceID: other.ID, Name: "sam", Email: "sam@example.com", Role: RoleOwner}); err != nil {
+		t.Errorf("adding sam to another workspace returned %v", err)
+	}
+	signedIn, err := models.Tokens.New(sam.ID, time.Hour, PurposeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := models.Tokens.New(sam.ID, time.Hour, PurposePasswordReset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//a reset token doesn't sign anyone in
+	if _, err := models.Members.GetForToken(PurposeAuthentication, reset.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("signing in with a reset token returned %v; want ErrRecordNotFound", err)
+	}
+	member, err := models.Members.GetForToken(PurposePasswordReset, reset.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := member.Password.Set("correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Members.ResetPassword(member, reset.Plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	//the token only works once and the member is signed out everywhere
+	if err := models.Members.ResetPassword(member, reset.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("reusing the reset token returned %v; want ErrRecordNotFound", err)
+	}
+	if _, err := models.Members.GetForToken(PurposeAuthentication, signedIn.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("signing in with a token from before the reset returned %v; want ErrRecordNotFound", err)
+	}
+	revoked, err := models.Members.GetTokenRevocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := revoked[sam.ID]; !ok || len(revoked) != 1 {
+		t.Errorf("got revocations %v; want one for sam", revoked)
+	}
+	found, err := models.Members.GetByEmail(DefaultWorkspaceID, "sam@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, err := found.Password.Matches("correct horse battery"); err != nil || !match {
+		t.Errorf("the new password matched: %t, %v; want true", match, err)
+	}
+
+	//an expired token can't be used
+	expired, err := models.Tokens.New(sam.ID, -time.Minute, PurposePasswordReset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Members.GetForToken(PurposePasswordReset, expired.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("using an expired reset token returned %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestLinkSubject(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Email: "Sam@Example.com", Role: RoleMember}
+	if err := models.Members.Insert(sam); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Members.GetBySubject(DefaultWorkspaceID, "sub-1"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("getting an unlinked subject returned %v; want ErrRecordNotFound", err)
+	}
+	linked, err := models.Members.LinkSubject(DefaultWorkspaceID, "sam@example.com", "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.ID != sam.ID {
+		t.Errorf("linked member %d; want %d", linked.ID, sam.ID)
+	}
+	//once linked the email can't be used to take the member over with another subject
+	if _, err := models.Members.LinkSubject(DefaultWorkspaceID, "sam@example.com", "sub-2"); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("linking a second subject returned %v; want ErrRecordNotFound", err)
+	}
+	sam.Email = "sam@elsewhere.com"
+	if err := models.Members.Update(sam); err != nil {
+		t.Fatal(err)
+	}
+	found, err := models.Members.GetBySubject(DefaultWorkspaceID, "sub-1")
+	if err != nil || found.ID != sam.ID {
+		t.Errorf("got member %+v, %v after the email changed; want sam", found, err)
+	}
+}
@@ -8,18 +8,57 @@ import (
 )
 
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordNotFound   = errors.New("record not found")
+	ErrEditConflict     = errors.New("edit conflict")
+	ErrDuplicateName    = errors.New("duplicate name")
+	ErrDuplicateEmail   = errors.New("duplicate email")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrInvalidAssignee  = errors.New("invalid assignee")
+	ErrInvalidParent    = errors.New("invalid parent")
+	ErrCycle            = errors.New("dependency cycle")
+	ErrInvalidMove      = errors.New("invalid move")
+	ErrWIPLimitExceeded = errors.New("wip limit exceeded")
+	ErrTimerRunning     = errors.New("timer already running")
 )
 
 // create a wrapper for our data models
 type Models struct {
-	List ListModel
+	List         ListModel
+	Revisions    RevisionModel
+	Webhooks     WebhookModel
+	Events       ListEventModel
+	Calendar     CalendarTokenModel
+	Reminders    ReminderModel
+	Members      MemberModel
+	Tokens       TokenModel
+	APIKeys      APIKeyModel
+	Workspaces   WorkspaceModel
+	Comments     CommentModel
+	Attachments  AttachmentModel
+	Dependencies DependencyModel
+	Board        BoardModel
+	TimeEntries  TimeEntryModel
+	Stats        StatsModel
 }
 
 // NewModels() allows us to create a new models
 func NewModels(db *sql.DB) Models {
 	return Models{
-		List: ListModel{DB: db},
+		List:         ListModel{DB: db},
+		Revisions:    RevisionModel{DB: db},
+		Webhooks:     WebhookModel{DB: db},
+		Events:       ListEventModel{DB: db},
+		Calendar:     CalendarTokenModel{DB: db},
+		Reminders:    ReminderModel{DB: db},
+		Members:      MemberModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		APIKeys:      APIKeyModel{DB: db},
+		Workspaces:   WorkspaceModel{DB: db},
+		Comments:     CommentModel{DB: db},
+		Attachments:  AttachmentModel{DB: db},
+		Dependencies: DependencyModel{DB: db},
+		Board:        BoardModel{DB: db},
+		TimeEntries:  TimeEntryModel{DB: db},
+		Stats:        StatsModel{DB: db},
 	}
 }
@@ -0,0 +1,377 @@
+//Filename: internal/data/position.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// positions are strings that sort in byte order. a list can always be given a position between two others
+// by making a longer string, so moving a list usually changes only that one list.
+// every key starts with a 10 digit number, which lets lists added at the start or end just count down or up
+const (
+	positionDigits    = "0123456789abcdefghijklmnopqrstuvwxyz"
+	positionPrefixLen = 10
+	// keys longer than this are a sign of many moves into the same gap, and the lists around it are renumbered
+	positionMaxLen = 64
+	// how many lists on each side of a full gap are renumbered at first. the window grows until the new keys are short
+	positionWindow = 32
+)
+
+// errInvalidPosition means a key can't have come from positionBetween()
+var errInvalidPosition = errors.New("invalid position")
+
+// positionKey() returns the key with the given number and nothing after it
+func positionKey(n int64) string {
+	return fmt.Sprintf("%0*di", positionPrefixLen, n)
+}
+
+// positionPrefix() reads the number at the start of a key
+func positionPrefix(key string) (int64, bool) {
+	if len(key) < positionPrefixLen {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(key[:positionPrefixLen], 10, 64)
+	return n, err == nil
+}
+
+// positionBetween() returns a key that sorts after before and ahead of after.
+// an empty before means the start of the list and an empty after means the end
+func positionBetween(before, after string) (string, error) {
+	if (before != "" && !validPosition(before)) || (after != "" && !validPosition(after)) {
+		return "", errInvalidPosition
+	}
+	if after != "" && before >= after {
+		return "", fmt.Errorf("position %q is not before %q", before, after)
+	}
+	switch {
+	case before == "" && after == "":
+		return positionKey(1), nil
+	//at the end or start a different number is enough, so the key stays short
+	case after == "":
+		if n, ok := positionPrefix(before); ok && n < 9999999999 {
+			return positionKey(n + 1), nil
+		}
+	case before == "":
+		if n, ok := positionPrefix(after); ok && n > 0 {
+			return positionKey(n - 1), nil
+		}
+	}
+	return positionMidpoint(before, after, after != ""), nil
+}
+
+// validPosition() checks a key only uses the position digits and doesn't end in a zero.
+// positionMidpoint() relies on that, an all zero key has nothing below it
+func validPosition(key string) bool {
+	if key == "" || key[len(key)-1] == '0' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(positionDigits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// positionSpread() returns n keys in order between lo and hi, which can be empty like in positionBetween().
+// it returns false if a key would be longer than half of positionMaxLen, then the caller needs a wider gap
+func positionSpread(lo, hi string, n int) ([]string, bool) {
+	keys := make([]string, 0, n)
+	if lo == "" && hi == "" {
+		for i := 1; i <= n; i++ {
+			keys = append(keys, positionKey(int64(i)))
+		}
+		return keys, true
+	}
+	//halving the gap each time keeps the keys about as long as the log of n
+	var spread func(lo, hi string, n int) bool
+	spread = func(lo, hi string, n int) bool {
+		if n == 0 {
+			return true
+		}
+		mid, err := positionBetween(lo, hi)
+		if err != nil || len(mid) > positionMaxLen/2 {
+			return false
+		}
+		left := (n - 1) / 2
+		if !spread(lo, mid, left) {
+			return false
+		}
+		keys = append(keys, mid)
+		return spread(mid, hi, n-1-left)
+	}
+	if !spread(lo, hi, n) {
+		return nil, false
+	}
+	return keys, true
+}
+
+// positionMidpoint() finds a key between a and b digit by digit. a missing digit counts as zero, so keys
+// never end in a zero and there is always room for another key below them. with hasB false there is no upper bound
+func positionMidpoint(a, b string, hasB bool) string {
+	if hasB {
+		//keep the prefix the two share
+		n := 0
+		for n < len(b) && positionDigit(a, n) == strings.IndexByte(positionDigits, b[n]) {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + positionMidpoint(rest, b[n:], true)
+		}
+	}
+	digitA := positionDigit(a, 0)
+	digitB := len(positionDigits)
+	if hasB {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+	//the first digits are next to each other
+	if hasB && len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + positionMidpoint(rest, "", false)
+}
+
+// positionDigit() returns the value of the digit at i, or zero past the end of the key
+func positionDigit(key string, i int) int {
+	if i >= len(key) {
+		return 0
+	}
+	return strings.IndexByte(positionDigits, key[i])
+}
+
+// nextPosition() returns the position for a list added to the end of a workspace, inside the caller's transaction
+func nextPosition(ctx context.Context, tx *sql.Tx, workspaceID int64) (string, error) {
+	var last sql.NullString
+	err := tx.QueryRowContext(ctx, `SELECT MAX(position) FROM lists WHERE workspace_id = $1`, workspaceID).Scan(&last)
+	if err != nil {
+		return "", err
+	}
+	return positionBetween(last.String, "")
+}
+
+// Move() places a list directly after the list prevID and ahead of the list nextID. either can be 0,
+// then the list goes straight after prevID or straight before nextID, but not both. it returns ErrInvalidMove if a neighbour isn't
+// in the workspace or the two are the wrong way round. only the moved list's position changes, and the version is
+// left alone so a move never conflicts with an edit. if the gap is used up, the lists around it are renumbered
+// first. their order doesn't change, but they are returned too since each one has a new position and a list event
+func (m ListModel) Move(workspaceID, id, prevID, nextID int64) (*List, []*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	//moves and new lists in a workspace take turns, so two lists can't be given the same position
+	err = lockWorkspace(ctx, tx, workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM lists WHERE id = $1 AND workspace_id = $2)`, id, workspaceID).Scan(&exists)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	var renumbered []int64
+	position, err := movePosition(ctx, tx, workspaceID, id, prevID, nextID)
+	if errors.Is(err, errPositionTooLong) {
+		//the gap has been split too many times, renumber the lists around it and try again
+		anchorID := prevID
+		if anchorID == 0 {
+			anchorID = nextID
+		}
+		renumbered, err = renumberAround(ctx, tx, workspaceID, id, anchorID)
+		if err != nil {
+			return nil, nil, err
+		}
+		position, err = movePosition(ctx, tx, workspaceID, id, prevID, nextID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE lists SET position = $1 WHERE id = $2`, position, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	lists, err := getLists(ctx, tx, []int64{id})
+	if err != nil {
+		return nil, nil, err
+	}
+	others := []*List{}
+	if len(renumbered) > 0 {
+		others, err = getLists(ctx, tx, renumbered)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return lists[0], others, tx.Commit()
+}
+
+// errPositionTooLong tells Move() to renumber the lists around the gap
+var errPositionTooLong = errors.New("position too long")
+
+// renumberAround() gives new, short keys to the lists either side of anchorID, leaving out the list being moved,
+// and returns their ids in order. it starts with positionWindow lists a side and widens until the keys fit,
+// at most the whole workspace. every renumbered list records a list event like any other update
+func renumberAround(ctx context.Context, tx *sql.Tx, workspaceID, movedID, anchorID int64) ([]int64, error) {
+	var anchor string
+	err := tx.QueryRowContext(ctx, `SELECT position FROM lists WHERE id = $1`, anchorID).Scan(&anchor)
+	if err != nil {
+		return nil, err
+	}
+	type row struct {
+		id       int64
+		position string
+	}
+	side := func(query string, limit int) ([]row, error) {
+		rows, err := tx.QueryContext(ctx, query, workspaceID, movedID, anchor, anchorID, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var result []row
+		for rows.Next() {
+			var r row
+			err = rows.Scan(&r.id, &r.position)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, r)
+		}
+		return result, rows.Err()
+	}
+	for size := positionWindow; ; size *= 4 {
+		//one extra row on each side is the bound the new keys have to fit inside
+		below, err := side(`
+			SELECT id, position FROM lists
+			WHERE workspace_id = $1 AND id <> $2 AND (position, id) <= ($3, $4)
+			ORDER BY position DESC, id DESC
+			LIMIT $5`, size+1)
+		if err != nil {
+			return nil, err
+		}
+		above, err := side(`
+			SELECT id, position FROM lists
+			WHERE workspace_id = $1 AND id <> $2 AND (position, id) > ($3, $4)
+			ORDER BY position, id
+			LIMIT $5`, size+1)
+		if err != nil {
+			return nil, err
+		}
+		lo, hi := "", ""
+		if len(below) > size {
+			lo = below[size].position
+			below = below[:size]
+		}
+		if len(above) > size {
+			hi = above[size].position
+			above = above[:size]
+		}
+		ids := make([]int64, 0, len(below)+len(above))
+		for i := len(below) - 1; i >= 0; i-- {
+			ids = append(ids, below[i].id)
+		}
+		for _, r := range above {
+			ids = append(ids, r.id)
+		}
+		keys, ok := positionSpread(lo, hi, len(ids))
+		if !ok {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE lists
+			SET position = renumbered.position
+			FROM unnest($1::bigint[], $2::text[]) AS renumbered(id, position)
+			WHERE lists.id = renumbered.id`, pq.Array(ids), pq.Array(keys))
+		if err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+}
+
+// movePosition() works out the new position for Move()
+func movePosition(ctx context.Context, tx *sql.Tx, workspaceID, id, prevID, nextID int64) (string, error) {
+	if prevID == 0 && nextID == 0 {
+		return "", ErrInvalidMove
+	}
+	neighbour := func(neighbourID int64) (string, error) {
+		var position string
+		err := tx.QueryRowContext(ctx, `SELECT position FROM lists WHERE id = $1 AND workspace_id = $2`, neighbourID, workspaceID).Scan(&position)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrInvalidMove
+		}
+		return position, err
+	}
+	var lower, upper sql.NullString
+	var err error
+	if prevID != 0 {
+		lower.String, err = neighbour(prevID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if nextID != 0 {
+		upper.String, err = neighbour(nextID)
+		if err != nil {
+			return "", err
+		}
+	}
+	//with one neighbour given, the other is whichever list sits next to it now
+	switch {
+	case nextID == 0:
+		err = tx.QueryRowContext(ctx, `SELECT MIN(position) FROM lists WHERE workspace_id = $1 AND position > $2 AND id <> $3`,
+			workspaceID, lower.String, id).Scan(&upper)
+	case prevID == 0:
+		err = tx.QueryRowContext(ctx, `SELECT MAX(position) FROM lists WHERE workspace_id = $1 AND position < $2 AND id <> $3`,
+			workspaceID, upper.String, id).Scan(&lower)
+	}
+	if err != nil {
+		return "", err
+	}
+	if upper.String != "" && lower.String > upper.String {
+		return "", ErrInvalidMove
+	}
+	//two lists can only share a position if something went wrong, renumbering fixes it
+	if upper.String != "" && lower.String == upper.String {
+		return "", errPositionTooLong
+	}
+	position, err := positionBetween(lower.String, upper.String)
+	if errors.Is(err, errInvalidPosition) {
+		//a key that was written by hand, renumbering replaces it
+		return "", errPositionTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(position) > positionMaxLen {
+		return "", errPositionTooLong
+	}
+	return position, nil
+}
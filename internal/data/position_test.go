@@ -0,0 +1,217 @@
+//Filename: internal/data/position_test.go
+
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		before, after string
+		want          string
+	}{
+		{"", "", positionKey(1)},
+		{positionKey(5), "", positionKey(6)},
+		{"", positionKey(5), positionKey(4)},
+		{"1", "2", "1i"},
+		{"1", "3", "2"},
+		{"", "1", "0i"},
+		{"a", "a1", "a0i"},
+		{"az", "b", "azi"},
+	}
+	for _, tt := range tests {
+		got, err := positionBetween(tt.before, tt.after)
+		if err != nil {
+			t.Errorf("positionBetween(%q, %q) returned %v", tt.before, tt.after, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("positionBetween(%q, %q) = %q; want %q", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestPositionBetweenErrors(t *testing.T) {
+	tests := []struct {
+		before, after string
+	}{
+		{"b", "a"},
+		{"a", "a"},
+		//all zero keys used to send positionMidpoint past the end of the upper key
+		{"", "0"},
+		{"", "00000000000"},
+		{"0", ""},
+		{"a!", ""},
+		{"", "A"},
+	}
+	for _, tt := range tests {
+		_, err := positionBetween(tt.before, tt.after)
+		if err == nil {
+			t.Errorf("positionBetween(%q, %q) returned no error", tt.before, tt.after)
+		}
+	}
+	_, err := positionBetween("", "0")
+	if !errors.Is(err, errInvalidPosition) {
+		t.Errorf("positionBetween(\"\", \"0\") returned %v; want errInvalidPosition", err)
+	}
+}
+
+func TestPositionBetweenRepeated(t *testing.T) {
+	//keep splitting the same gap from both sides, every key has to land strictly inside it
+	lower, upper := positionKey(1), positionKey(2)
+	for i := 0; i < 500; i++ {
+		key, err := positionBetween(lower, upper)
+		if err != nil {
+			t.Fatalf("move %d: %v", i, err)
+		}
+		if key <= lower || key >= upper {
+			t.Fatalf("move %d: %q is not between %q and %q", i, key, lower, upper)
+		}
+		if !validPosition(key) {
+			t.Fatalf("move %d: %q is not a valid key", i, key)
+		}
+		if i%2 == 0 {
+			upper = key
+		} else {
+			lower = key
+		}
+	}
+}
+
+func TestPositionMidpoint(t *testing.T) {
+	tests := []struct {
+		a, b string
+		hasB bool
+		want string
+	}{
+		{"", "", false, "i"},
+		{"y", "", false, "z"},
+		{"z", "", false, "zi"},
+		{"1", "2", true, "1i"},
+		{"11", "12", true, "11i"},
+		{"", "01", true, "00i"},
+	}
+	for _, tt := range tests {
+		if got := positionMidpoint(tt.a, tt.b, tt.hasB); got != tt.want {
+			t.Errorf("positionMidpoint(%q, %q, %t) = %q; want %q", tt.a, tt.b, tt.hasB, got, tt.want)
+		}
+	}
+}
+
+func TestPositionSpread(t *testing.T) {
+	tests := []struct {
+		lo, hi string
+		n      int
+	}{
+		{"", "", 5},
+		{"", positionKey(3), 100},
+		{positionKey(3), "", 100},
+		{positionKey(3), positionKey(4), 1000},
+		{strings.Repeat("a", 20) + "1", strings.Repeat("a", 20) + "2", 64},
+	}
+	for _, tt := range tests {
+		keys, ok := positionSpread(tt.lo, tt.hi, tt.n)
+		if !ok {
+			t.Errorf("positionSpread(%q, %q, %d) found no room", tt.lo, tt.hi, tt.n)
+			continue
+		}
+		if len(keys) != tt.n {
+			t.Errorf("positionSpread(%q, %q, %d) returned %d keys", tt.lo, tt.hi, tt.n, len(keys))
+			continue
+		}
+		prev := tt.lo
+		for _, key := range keys {
+			if key <= prev || (tt.hi != "" && key >= tt.hi) || len(key) > positionMaxLen/2 {
+				t.Errorf("positionSpread(%q, %q, %d) returned %q after %q", tt.lo, tt.hi, tt.n, key, prev)
+				break
+			}
+			prev = key
+		}
+	}
+
+	//a gap that is already nearly full can't take more keys
+	lo, hi := strings.Repeat("a", 31)+"1", strings.Repeat("a", 31)+"2"
+	if _, ok := positionSpread(lo, hi, 3); ok {
+		t.Errorf("positionSpread(%q, %q, 3) found room", lo, hi)
+	}
+}
+
+func TestMoveRenumbers(t *testing.T) {
+	models := newTestDB(t)
+	var lists []*List
+	for i := 0; i < 6; i++ {
+		lists = append(lists, newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual))
+	}
+	first, a, b := lists[0], lists[1], lists[2]
+	countUpdates := func(id int64) int {
+		var n int
+		err := models.List.DB.QueryRow(`SELECT count(*) FROM list_events WHERE list_id = $1 AND event = 'list.updated'`, id).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	//moving two lists in turn straight after the first one halves the same gap every time
+	renumbers := make(map[int64]int)
+	for i := 0; i < 400; i++ {
+		moved, other := a, b
+		if i%2 == 1 {
+			moved, other = b, a
+		}
+		list, others, err := models.List.Move(DefaultWorkspaceID, moved.ID, first.ID, other.ID)
+		if err != nil {
+			t.Fatalf("move %d: %v", i, err)
+		}
+		for _, renumbered := range others {
+			if renumbered.ID == moved.ID {
+				t.Fatalf("move %d: the moved list was renumbered", i)
+			}
+			renumbers[renumbered.ID]++
+		}
+		if len(list.Position) > positionMaxLen {
+			t.Fatalf("move %d: position %q is too long", i, list.Position)
+		}
+	}
+
+	fresh := reload(t, models, first)
+	if fresh.Position == first.Position {
+		t.Fatal("the lists around the gap were never renumbered")
+	}
+	//a and b end up after first, then the rest keep their order
+	want := []int64{first.ID, b.ID, a.ID, lists[3].ID, lists[4].ID, lists[5].ID}
+	rows, err := models.List.DB.Query(`SELECT id FROM lists WHERE workspace_id = $1 ORDER BY position, id`, DefaultWorkspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got lists %v; want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got lists in order %v; want %v", got, want)
+		}
+	}
+
+	//every renumbered list records an update so clients learn its new position
+	for _, list := range []*List{first, lists[3], lists[4], lists[5]} {
+		if n := countUpdates(list.ID); n == 0 || n != renumbers[list.ID] {
+			t.Errorf("list %d was renumbered %d times but has %d update events", list.ID, renumbers[list.ID], n)
+		}
+	}
+	if n := countUpdates(a.ID) + countUpdates(b.ID); n != 400+renumbers[a.ID]+renumbers[b.ID] {
+		t.Errorf("got %d update events for the moved lists; want 400 and one per renumber", n)
+	}
+}
@@ -0,0 +1,240 @@
+//Filename: internal/data/reminders.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"todo.joelical.net/internal/validator"
+)
+
+// the ways a reminder can be sent
+const (
+	ReminderEmail   = "email"
+	ReminderWebhook = "webhook"
+)
+
+var ReminderChannels = []string{ReminderEmail, ReminderWebhook}
+
+// reminder states
+const (
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderFailed  = "failed"
+	// the list was finished before the reminder was due
+	ReminderSkipped = "skipped"
+)
+
+// a Reminder is one notification about a list, sent at RemindAt to an email address or a url
+type Reminder struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ListID        int64      `json:"list_id"`
+	WorkspaceID   int64      `json:"-"`
+	RemindAt      time.Time  `json:"remind_at"`
+	Channel       string     `json:"channel"`
+	Target        string     `json:"target"`
+	Status        string     `json:"status"`
+	Attempts      int32      `json:"attempts"`
+	NextAttemptAt time.Time  `json:"-"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+func ValidateReminder(v *validator.Validator, reminder *Reminder) {
+	v.Check(!reminder.RemindAt.IsZero(), "remind_at", "must be provided")
+	v.Check(reminder.RemindAt.Year() <= 9999, "remind_at", "must be a valid date")
+
+	v.Check(validator.In(reminder.Channel, ReminderChannels...), "channel", "must be email or webhook")
+
+	v.Check(reminder.Target != "", "target", "must be provided")
+	v.Check(len(reminder.Target) <= 500, "target", "must not be more than 500 bytes long")
+	switch reminder.Channel {
+	case ReminderEmail:
+		v.Check(validator.Matches(reminder.Target, validator.EmailRX), "target", "must be a valid email address")
+	case ReminderWebhook:
+		v.Check(validator.HTTPURL(reminder.Target), "target", "must be an absolute http or https url")
+	}
+}
+
+// define a ReminderModel which wraps a sql.db connection pool
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to add a reminder to a list
+func (m ReminderModel) Insert(reminder *Reminder) error {
+	query := `
+		INSERT INTO reminders (list_id, remind_at, channel, target, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $2)
+		RETURNING id, created_at, status
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{reminder.ListID, reminder.RemindAt, reminder.Channel, reminder.Target}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&reminder.ID, &reminder.CreatedAt, &reminder.Status)
+}
+
+// GetAll() returns every reminder for a list in the order they are due
+func (m ReminderModel) GetAll(listID int64) ([]*Reminder, error) {
+	query := `
+		SELECT id, created_at, list_id, remind_at, channel, target, status, attempts, next_attempt_at, sent_at, last_error
+		FROM reminders
+		WHERE list_id = $1
+		ORDER BY remind_at, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*Reminder{}
+	for rows.Next() {
+		var reminder Reminder
+		err := rows.Scan(
+			&reminder.ID,
+			&reminder.CreatedAt,
+			&reminder.ListID,
+			&reminder.RemindAt,
+			&reminder.Channel,
+			&reminder.Target,
+			&reminder.Status,
+			&reminder.Attempts,
+			&reminder.NextAttemptAt,
+			&reminder.SentAt,
+			&reminder.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// Delete() allows us to remove a reminder from a list
+func (m ReminderModel) Delete(listID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM reminders
+		WHERE id = $1
+		AND list_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, listID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// ClaimDue() picks up to limit pending reminders that are due and leases them for the given duration.
+// SKIP LOCKED plus the lease stop two schedulers from sending the same reminder
+func (m ReminderModel) ClaimDue(limit int, lease time.Duration) ([]*Reminder, error) {
+	query := `
+		WITH due AS (
+			SELECT id
+			FROM reminders
+			WHERE status = 'pending'
+			AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE reminders r
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, lists l
+		WHERE r.id = due.id
+		AND l.id = r.list_id
+		RETURNING r.id, r.created_at, r.list_id, l.workspace_id, r.remind_at, r.channel, r.target, r.attempts
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*Reminder{}
+	for rows.Next() {
+		reminder := Reminder{Status: ReminderPending}
+		err := rows.Scan(
+			&reminder.ID,
+			&reminder.CreatedAt,
+			&reminder.ListID,
+			&reminder.WorkspaceID,
+			&reminder.RemindAt,
+			&reminder.Channel,
+			&reminder.Target,
+			&reminder.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// RecordAttempt() saves the outcome of an attempt. the caller decides the new status and when to retry
+func (m ReminderModel) RecordAttempt(reminder *Reminder) error {
+	query := `
+		UPDATE reminders
+		SET status = $1,
+			attempts = $2,
+			next_attempt_at = $3,
+			sent_at = $4,
+			last_error = $5
+		WHERE id = $6
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{
+		reminder.Status,
+		reminder.Attempts,
+		reminder.NextAttemptAt,
+		reminder.SentAt,
+		reminder.LastError,
+		reminder.ID,
+	}
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	//the reminder or its list was deleted while it was being sent
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
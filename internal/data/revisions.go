@@ -0,0 +1,118 @@
+//Filename: internal/data/revisions.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// a Revision is a snapshot of a list as it was before an update replaced it
+type Revision struct {
+	ListID    int64     `json:"list_id"`
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	List      *List     `json:"list"`
+}
+
+// Restore() copies the editable fields of the snapshot onto the current list.
+// the id, created_at and version of the current list are left alone so the update can detect edit conflicts
+func (r *Revision) Restore(list *List) {
+	list.Name = r.List.Name
+	list.Task = r.List.Task
+	list.Status = r.List.Status
+	list.DueDate = r.List.DueDate
+	list.Labels = r.List.Labels
+	list.Recurrence = r.List.Recurrence
+	list.Estimate = r.List.Estimate
+	list.Priority = r.List.Priority
+}
+
+// define a RevisionModel which wraps a sql.db connection pool
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAll() returns every stored revision of a list, newest first
+func (m RevisionModel) GetAll(listID int64) ([]*Revision, error) {
+	query := `
+		SELECT list_id, version, created_at, snapshot
+		FROM list_revisions
+		WHERE list_id = $1
+		ORDER BY version DESC
+	`
+	//create a 3 second timeout context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Get() returns the revision of a list that was saved for a specific version
+func (m RevisionModel) Get(listID int64, version int32) (*Revision, error) {
+	if listID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT list_id, version, created_at, snapshot
+		FROM list_revisions
+		WHERE list_id = $1
+		AND version = $2
+	`
+	//create a 3 second timeout context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	revision, err := scanRevision(m.DB.QueryRowContext(ctx, query, listID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+// scanRevision() reads a revision row and decodes its snapshot
+func scanRevision(row interface{ Scan(...interface{}) error }) (*Revision, error) {
+	var revision Revision
+	var snapshot []byte
+	err := row.Scan(
+		&revision.ListID,
+		&revision.Version,
+		&revision.CreatedAt,
+		&snapshot,
+	)
+	if err != nil {
+		return nil, err
+	}
+	//the snapshot was produced by to_jsonb() so its keys match the json tags on List
+	revision.List = &List{}
+	err = json.Unmarshal(snapshot, revision.List)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
@@ -0,0 +1,146 @@
+//Filename: internal/data/revisions_test.go
+
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// snapshotRow stands in for the row scanRevision() reads
+type snapshotRow struct {
+	snapshot string
+}
+
+func (r snapshotRow) Scan(dest ...interface{}) error {
+	*dest[0].(*int64) = 4
+	*dest[1].(*int32) = 2
+	*dest[2].(*time.Time) = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	*dest[3].(*[]byte) = []byte(r.snapshot)
+	return nil
+}
+
+func TestScanRevision(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		want     string
+		wantErr  bool
+	}{
+		//the keys and timestamps are the way to_jsonb() writes them
+		{"current", `{"id":4,"name":"home","task":"milk","status":"todo","due_date":"2030-01-02T09:30:00+00:00","labels":["a"],"estimate":3,"priority":2,"version":2}`,
+			"home milk todo 2030-01-02 09:30:00 +0000 UTC [a] 3 2", false},
+		//snapshots saved before a column existed leave it at its zero value
+		{"older", `{"id":4,"name":"home","task":"milk","status":"todo","due_date":null,"labels":[],"version":2}`,
+			"home milk todo <nil> [] <nil> 0", false},
+		{"broken", `{"name":`, "", true},
+	}
+	for _, tt := range tests {
+		revision, err := scanRevision(snapshotRow{tt.snapshot})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v; want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		list := revision.List
+		var due, estimate interface{} = nil, nil
+		if list.DueDate != nil {
+			due = list.DueDate.UTC()
+		}
+		if list.Estimate != nil {
+			estimate = *list.Estimate
+		}
+		got := fmt.Sprint(list.Name, " ", list.Task, " ", list.Status, " ", due, " ", list.Labels, " ", estimate, " ", list.Priority)
+		if got != tt.want || revision.ListID != 4 || revision.Version != 2 {
+			t.Errorf("%s: got %q for list %d version %d; want %q for list 4 version 2", tt.name, got, revision.ListID, revision.Version, tt.want)
+		}
+	}
+}
+
+func TestRevisionRestore(t *testing.T) {
+	due := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	estimate := int32(5)
+	created := time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := &List{ID: 4, WorkspaceID: 2, CreatedAt: created, Name: "now", Task: "now", Status: "done", Labels: []string{"x"}, Priority: PriorityHigh, Version: 7}
+	revision := &Revision{ListID: 4, Version: 3, List: &List{ID: 4, WorkspaceID: 9, Name: "then", Task: "milk", Status: "todo", DueDate: &due, Labels: []string{"a"}, Recurrence: "FREQ=DAILY", Estimate: &estimate, Version: 3}}
+
+	revision.Restore(current)
+	tests := []struct {
+		field string
+		got   interface{}
+		want  interface{}
+	}{
+		{"name", current.Name, "then"},
+		{"task", current.Task, "milk"},
+		{"status", current.Status, "todo"},
+		{"due_date", current.DueDate, &due},
+		{"labels", fmt.Sprint(current.Labels), "[a]"},
+		{"recurrence", current.Recurrence, "FREQ=DAILY"},
+		{"estimate", current.Estimate, &estimate},
+		{"priority", current.Priority, int16(PriorityNone)},
+		//the restore is saved as a new version of the list as it is now
+		{"id", current.ID, int64(4)},
+		{"workspace_id", current.WorkspaceID, int64(2)},
+		{"created_at", current.CreatedAt, created},
+		{"version", current.Version, int32(7)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v; want %v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestListRevisions(t *testing.T) {
+	models := newTestDB(t)
+	list := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	for _, name := range []string{"second", "third"} {
+		list.Name = name
+		if _, err := models.List.Update(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revisions, err := models.Revisions.GetAll(list.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, revision := range revisions {
+		got = append(got, fmt.Sprintf("%d:%s", revision.Version, revision.List.Name))
+	}
+	if want := "[2:second 1:Test]"; fmt.Sprint(got) != want {
+		t.Errorf("got revisions %v; want %s", got, want)
+	}
+	if _, err := models.Revisions.Get(list.ID, list.Version); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("getting the current version returned %v; want ErrRecordNotFound", err)
+	}
+
+	//a revert works like any other update, so a stale copy of the list conflicts
+	first, err := models.Revisions.Get(list.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := reload(t, models, list)
+	stale.Version--
+	first.Restore(stale)
+	if _, err := models.List.Update(stale); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("reverting a stale list returned %v; want ErrEditConflict", err)
+	}
+	current := reload(t, models, list)
+	first.Restore(current)
+	if _, err := models.List.Update(current); err != nil {
+		t.Fatal(err)
+	}
+	if fresh := reload(t, models, list); fresh.Name != "Test" || fresh.Version != 4 {
+		t.Errorf("got %q at version %d after the revert; want Test at 4", fresh.Name, fresh.Version)
+	}
+	//the version the revert replaced is kept too
+	if third, err := models.Revisions.Get(list.ID, 3); err != nil || third.List.Name != "third" {
+		t.Errorf("got revision 3 %+v, %v; want third", third, err)
+	}
+}
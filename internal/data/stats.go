@@ -0,0 +1,202 @@
+//Filename: internal/data/stats.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Stats summarises a workspace over a range of days. the daily series have one entry for every day
+// in the range, oldest first. a list's state on a day is its state at the end of that day (UTC)
+type Stats struct {
+	Completed      []*CompletedDay `json:"completed"`
+	CumulativeFlow []*FlowDay      `json:"cumulative_flow"`
+	Burndown       []*BurndownDay  `json:"burndown"`
+	CycleTime      CycleTime       `json:"cycle_time"`
+	// the lists that are past their due date and not done right now
+	Overdue int `json:"overdue"`
+}
+
+// a CompletedDay counts the lists marked done during a day, and the estimate they carried
+type CompletedDay struct {
+	Date     string `json:"date"`
+	Count    int    `json:"count"`
+	Estimate int64  `json:"estimate"`
+}
+
+// a FlowDay counts the lists in each status at the end of a day
+type FlowDay struct {
+	Date     string         `json:"date"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+// a BurndownDay is the work left at the end of a day. IdealEstimate falls in a straight
+// line from the first day's remaining estimate to zero on the last day
+type BurndownDay struct {
+	Date              string  `json:"date"`
+	Remaining         int     `json:"remaining"`
+	RemainingEstimate int64   `json:"remaining_estimate"`
+	IdealEstimate     float64 `json:"ideal_estimate"`
+	Overdue           int     `json:"overdue"`
+}
+
+// CycleTime is the average time from a list being created to it being marked done,
+// over the lists completed in the range
+type CycleTime struct {
+	Count          int   `json:"count"`
+	AverageSeconds int64 `json:"average_seconds"`
+}
+
+// statsHistory replays a workspace's list_events up to $3. each event is one state of a list,
+// which lasts until the next event for the same list replaces it
+var statsHistory = `
+	WITH history AS (
+		SELECT event, created_at,
+			LEAD(created_at) OVER (PARTITION BY list_id ORDER BY id) AS replaced_at,
+			` + doneSQL("list->>'status'") + ` AS done,
+			LAG(` + doneSQL("list->>'status'") + `) OVER (PARTITION BY list_id ORDER BY id) AS was_done,
+			list->>'status' AS status,
+			(list->>'estimate')::integer AS estimate,
+			(list->>'due_date')::timestamptz AS due_date,
+			(list->>'created_at')::timestamptz AS list_created_at
+		FROM list_events
+		WHERE workspace_id = $1
+		AND created_at < $3
+	)`
+
+// define a StatsModel which wraps a sql.db connection pool
+type StatsModel struct {
+	DB *sql.DB
+}
+
+// Get() works out the stats for the days from the date of from to the date of to, both included.
+// both are expected to be midnight UTC
+func (m StatsModel) Get(workspaceID int64, from, to time.Time) (*Stats, error) {
+	//replaying the history takes longer than a single lookup
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	//every query sees the same events so the series agree with each other
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stats := &Stats{
+		Completed:      []*CompletedDay{},
+		CumulativeFlow: []*FlowDay{},
+		Burndown:       []*BurndownDay{},
+	}
+	days := make(map[string]int)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		days[date] = len(stats.Completed)
+		stats.Completed = append(stats.Completed, &CompletedDay{Date: date})
+		stats.CumulativeFlow = append(stats.CumulativeFlow, &FlowDay{Date: date, Statuses: map[string]int{}})
+		stats.Burndown = append(stats.Burndown, &BurndownDay{Date: date})
+	}
+	end := to.AddDate(0, 0, 1)
+
+	//a list is completed when an event moves it into a done status, or creates it already done
+	rows, err := tx.QueryContext(ctx, statsHistory+`
+		SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), COUNT(*), COALESCE(SUM(estimate), 0),
+			COALESCE(SUM(EXTRACT(EPOCH FROM created_at - list_created_at)), 0)::bigint
+		FROM history
+		WHERE event <> $4
+		AND done AND NOT COALESCE(was_done, false)
+		AND created_at >= $2
+		GROUP BY 1
+	`, workspaceID, from, end, EventListDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cycleSeconds int64
+	for rows.Next() {
+		var date string
+		var count int
+		var estimate, seconds int64
+		err := rows.Scan(&date, &count, &estimate, &seconds)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := days[date]; ok {
+			stats.Completed[i].Count = count
+			stats.Completed[i].Estimate = estimate
+		}
+		stats.CycleTime.Count += count
+		cycleSeconds += seconds
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if stats.CycleTime.Count > 0 {
+		stats.CycleTime.AverageSeconds = cycleSeconds / int64(stats.CycleTime.Count)
+	}
+
+	//the state each list was in at the end of each day, counted by status
+	rows, err = tx.QueryContext(ctx, statsHistory+`,
+		days AS (
+			SELECT day_end
+			FROM generate_series($2::timestamptz + interval '24 hours', $3::timestamptz, interval '24 hours') AS day_end
+		)
+		SELECT to_char((days.day_end - interval '24 hours') AT TIME ZONE 'UTC', 'YYYY-MM-DD'),
+			history.status, history.done, COUNT(*), COALESCE(SUM(history.estimate), 0),
+			COUNT(*) FILTER (WHERE history.due_date < days.day_end)
+		FROM days
+		INNER JOIN history ON history.created_at < days.day_end
+			AND (history.replaced_at IS NULL OR history.replaced_at >= days.day_end)
+		WHERE history.event <> $4
+		GROUP BY 1, 2, 3
+	`, workspaceID, from, end, EventListDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date, status string
+		var done bool
+		var count, overdue int
+		var estimate int64
+		err := rows.Scan(&date, &status, &done, &count, &estimate, &overdue)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := days[date]
+		if !ok {
+			continue
+		}
+		stats.CumulativeFlow[i].Statuses[status] += count
+		if !done {
+			stats.Burndown[i].Remaining += count
+			stats.Burndown[i].RemainingEstimate += estimate
+			stats.Burndown[i].Overdue += overdue
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if n := len(stats.Burndown); n > 1 {
+		start := float64(stats.Burndown[0].RemainingEstimate)
+		for i, day := range stats.Burndown {
+			day.IdealEstimate = start * float64(n-1-i) / float64(n-1)
+		}
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM lists
+		WHERE workspace_id = $1
+		AND due_date < NOW()
+		AND NOT ` + doneSQL("status")
+	err = tx.QueryRowContext(ctx, query, workspaceID).Scan(&stats.Overdue)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,133 @@
+//Filename: internal/data/stats_test.go
+
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// statsDay returns the time on a day of March 2024, UTC
+func statsDay(day, hour int) time.Time {
+	return time.Date(2024, 3, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestStatsWindows(t *testing.T) {
+	models := newTestDB(t)
+	three, five := int32(3), int32(5)
+	due := statsDay(3, 0)
+	a := &List{WorkspaceID: DefaultWorkspaceID, Name: "a", Task: "t", Status: "todo", Estimate: &three}
+	b := &List{WorkspaceID: DefaultWorkspaceID, Name: "b", Task: "t", Status: "todo", Estimate: &five, DueDate: &due}
+	c := &List{WorkspaceID: DefaultWorkspaceID, Name: "c", Task: "t", Status: "todo"}
+	for _, list := range []*List{a, b, c} {
+		if err := models.List.Insert(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Status = "done"
+	if _, err := models.List.Update(a); err != nil {
+		t.Fatal(err)
+	}
+	b.Status = "doing"
+	if _, err := models.List.Update(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.List.Delete(DefaultWorkspaceID, c.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	//the events all happened just now, move them back to the days the test is about
+	events, err := models.Events.GetSince(DefaultWorkspaceID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := map[int64]time.Time{a.ID: statsDay(1, 10), b.ID: statsDay(2, 10), c.ID: statsDay(2, 12)}
+	at := []time.Time{statsDay(1, 10), statsDay(2, 10), statsDay(2, 12), statsDay(3, 10), statsDay(4, 10), statsDay(4, 12)}
+	if len(events) != len(at) {
+		t.Fatalf("got %d events; want %d", len(events), len(at))
+	}
+	for i, event := range events {
+		_, err := models.Stats.DB.Exec(`
+			UPDATE list_events
+			SET created_at = $2, list = jsonb_set(list, '{created_at}', to_jsonb($3::timestamptz))
+			WHERE id = $1`, event.ID, at[i], created[event.ListID])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		completed string
+		flow      string
+		remaining string
+		overdue   string
+		ideal     string
+		cycle     CycleTime
+	}{
+		{"whole history", statsDay(1, 0), statsDay(5, 0),
+			"[0/0 0/0 1/3 0/0 0/0]",
+			"[map[todo:1] map[todo:3] map[done:1 todo:2] map[doing:1 done:1] map[doing:1 done:1]]",
+			"[1/3 3/8 2/5 1/5 1/5]",
+			"[0 0 1 1 1]",
+			"[3 2.25 1.5 0.75 0]",
+			CycleTime{Count: 1, AverageSeconds: 2 * 24 * 60 * 60}},
+		//later events don't leak into the days before them
+		{"before anything was done", statsDay(1, 0), statsDay(2, 0),
+			"[0/0 0/0]",
+			"[map[todo:1] map[todo:3]]",
+			"[1/3 3/8]",
+			"[0 0]",
+			"[3 0]",
+			CycleTime{}},
+		{"one day", statsDay(3, 0), statsDay(3, 0),
+			"[1/3]",
+			"[map[done:1 todo:2]]",
+			"[2/5]",
+			"[1]",
+			"[0]",
+			CycleTime{Count: 1, AverageSeconds: 2 * 24 * 60 * 60}},
+		//lists made before the range are still counted on its days
+		{"after the changes", statsDay(5, 0), statsDay(6, 0),
+			"[0/0 0/0]",
+			"[map[doing:1 done:1] map[doing:1 done:1]]",
+			"[1/5 1/5]",
+			"[1 1]",
+			"[5 0]",
+			CycleTime{}},
+	}
+	for _, tt := range tests {
+		stats, err := models.Stats.Get(DefaultWorkspaceID, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var completed, flow, remaining, overdue, ideal []string
+		for _, day := range stats.Completed {
+			completed = append(completed, fmt.Sprintf("%d/%d", day.Count, day.Estimate))
+		}
+		for _, day := range stats.CumulativeFlow {
+			flow = append(flow, fmt.Sprint(day.Statuses))
+		}
+		for _, day := range stats.Burndown {
+			remaining = append(remaining, fmt.Sprintf("%d/%d", day.Remaining, day.RemainingEstimate))
+			overdue = append(overdue, fmt.Sprint(day.Overdue))
+			ideal = append(ideal, fmt.Sprint(day.IdealEstimate))
+		}
+		got := []string{fmt.Sprint(completed), fmt.Sprint(flow), fmt.Sprint(remaining), fmt.Sprint(overdue), fmt.Sprint(ideal)}
+		want := []string{tt.completed, tt.flow, tt.remaining, tt.overdue, tt.ideal}
+		for i, series := range []string{"completed", "cumulative flow", "burndown", "overdue", "ideal"} {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %s %s; want %s", tt.name, series, got[i], want[i])
+			}
+		}
+		if stats.CycleTime != tt.cycle {
+			t.Errorf("%s: got cycle time %+v; want %+v", tt.name, stats.CycleTime, tt.cycle)
+		}
+		//b is still past its due date
+		if stats.Overdue != 1 {
+			t.Errorf("%s: got %d overdue now; want 1", tt.name, stats.Overdue)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+//Filename: internal/data/timeentries.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/validator"
+)
+
+// a TimeEntry is a stretch of time someone spent on a list. EndedAt is nil while the timer is running.
+// User is the member's name, or the name the person gave when they booked it without credentials,
+// the same as a comment's author. MemberID is only set for members
+type TimeEntry struct {
+	ID        int64      `json:"id"`
+	ListID    int64      `json:"list_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      string     `json:"user"`
+	MemberID  *int64     `json:"member_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Seconds   int64      `json:"seconds"`
+	Note      string     `json:"note"`
+}
+
+// the longest a manual entry can be
+const maxTimeEntry = 24 * time.Hour
+
+// the ways a time report can be grouped, mapped to the sql that does the grouping
+var timeReportGroups = map[string]struct{ key, listID string }{
+	"day":  {key: `to_char(entry.started_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`, listID: `NULL::bigint`},
+	"task": {key: `COALESCE(list.task, entry.list_task)`, listID: `entry.list_id`},
+	"user": {key: `entry.user_name`, listID: `NULL::bigint`},
+}
+
+var TimeReportGroups = []string{"day", "task", "user"}
+
+// a TimeReportRow is the time booked to one day, task or user
+type TimeReportRow struct {
+	Group   string `json:"group"`
+	ListID  *int64 `json:"list_id,omitempty"`
+	Seconds int64  `json:"seconds"`
+	Entries int    `json:"entries"`
+}
+
+// the seconds are worked out by the database so a running timer shows the time so far
+const timeEntryColumns = `
+	id, list_id, created_at, user_name, member_id, started_at, ended_at,
+	EXTRACT(EPOCH FROM COALESCE(ended_at, NOW()) - started_at)::bigint, note`
+
+// scanFields() returns pointers to the entry's fields in the order of timeEntryColumns
+func (e *TimeEntry) scanFields() []interface{} {
+	return []interface{}{&e.ID, &e.ListID, &e.CreatedAt, &e.User, &e.MemberID, &e.StartedAt, &e.EndedAt, &e.Seconds, &e.Note}
+}
+
+// ValidateTimer() checks the fields used to start or stop a timer
+func ValidateTimer(v *validator.Validator, entry *TimeEntry) {
+	v.Check(entry.User != "", "user", "must be provided")
+	v.Check(len(entry.User) <= 100, "user", "must not be more than 100 bytes long")
+
+	v.Check(len(entry.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// ValidateTimeEntry() checks an entry added by hand, which must have already ended
+func ValidateTimeEntry(v *validator.Validator, entry *TimeEntry) {
+	ValidateTimer(v, entry)
+
+	v.Check(!entry.StartedAt.IsZero(), "started_at", "must be provided")
+	v.Check(entry.StartedAt.Year() <= 9999, "started_at", "must be a valid date")
+
+	v.Check(entry.EndedAt != nil, "ended_at", "must be provided")
+	if entry.EndedAt != nil {
+		v.Check(!entry.EndedAt.Before(entry.StartedAt), "ended_at", "must not be before started_at")
+		v.Check(entry.EndedAt.Sub(entry.StartedAt) <= maxTimeEntry, "ended_at", "must be within 24 hours of started_at")
+		v.Check(!entry.EndedAt.After(time.Now().Add(time.Minute)), "ended_at", "must not be in the future")
+	}
+}
+
+// define a TimeEntryModel which wraps a sql.db connection pool
+type TimeEntryModel struct {
+	DB *sql.DB
+}
+
+// Start() starts a timer for entry.User on a list. ErrTimerRunning means they already
+// have a timer running somewhere in the workspace
+func (m TimeEntryModel) Start(workspaceID int64, entry *TimeEntry) error {
+	query := `
+		INSERT INTO time_entries (list_id, workspace_id, user_name, member_id, started_at, note)
+		VALUES ($1, $2, $3, $4, NOW(), $5)
+		RETURNING ` + timeEntryColumns
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{entry.ListID, workspaceID, entry.User, entry.MemberID, entry.Note}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(entry.scanFields()...)
+	if err != nil {
+		//the partial unique index allows one running entry per user
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "time_entries_running_idx" {
+			return ErrTimerRunning
+		}
+		return err
+	}
+	return nil
+}
+
+// Stop() ends the timer user has running on a list. a timer started by a member is only stopped by
+// the same memberID, and one started without credentials by a nil memberID. ErrRecordNotFound means there isn't one
+func (m TimeEntryModel) Stop(listID int64, user string, memberID *int64) (*TimeEntry, error) {
+	query := `
+		UPDATE time_entries
+		SET ended_at = GREATEST(NOW(), started_at)
+		WHERE list_id = $1 AND user_name = $2 AND member_id IS NOT DISTINCT FROM $3 AND ended_at IS NULL
+		RETURNING ` + timeEntryColumns
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entry TimeEntry
+	err := m.DB.QueryRowContext(ctx, query, listID, user, memberID).Scan(entry.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Insert() adds an entry that has already ended, for time that wasn't tracked with a timer
+func (m TimeEntryModel) Insert(workspaceID int64, entry *TimeEntry) error {
+	query := `
+		INSERT INTO time_entries (list_id, workspace_id, user_name, member_id, started_at, ended_at, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + timeEntryColumns
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{entry.ListID, workspaceID, entry.User, entry.MemberID, entry.StartedAt, entry.EndedAt, entry.Note}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(entry.scanFields()...)
+}
+
+// GetAll() returns every entry for a list, oldest first
+func (m TimeEntryModel) GetAll(listID int64) ([]*TimeEntry, error) {
+	query := `
+		SELECT ` + timeEntryColumns + `
+		FROM time_entries
+		WHERE list_id = $1
+		ORDER BY started_at, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*TimeEntry{}
+	for rows.Next() {
+		var entry TimeEntry
+		err := rows.Scan(entry.scanFields()...)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Get() returns one entry of a list
+func (m TimeEntryModel) Get(listID, id int64) (*TimeEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + timeEntryColumns + `
+		FROM time_entries
+		WHERE id = $1 AND list_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entry TimeEntry
+	err := m.DB.QueryRowContext(ctx, query, id, listID).Scan(entry.scanFields()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Delete() removes an entry from a list, running or not
+func (m TimeEntryModel) Delete(listID, id int64) error {
+	query := `
+		DELETE FROM time_entries
+		WHERE id = $1 AND list_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, listID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Report() totals the finished entries in a workspace that started in [from, to), grouped by
+// day, task or user. days are UTC dates. running timers are left out until they are stopped.
+// entries of deleted lists are still counted, under the task the list had and no list id
+func (m TimeEntryModel) Report(workspaceID int64, from, to time.Time, groupBy string) ([]*TimeReportRow, error) {
+	group, ok := timeReportGroups[groupBy]
+	if !ok {
+		panic("unsafe group_by parameter:" + groupBy)
+	}
+	query := `
+		SELECT ` + group.key + `, ` + group.listID + `,
+			SUM(EXTRACT(EPOCH FROM entry.ended_at - entry.started_at))::bigint, COUNT(*)
+		FROM time_entries AS entry
+		LEFT JOIN lists AS list ON list.id = entry.list_id
+		WHERE entry.workspace_id = $1 AND entry.ended_at IS NOT NULL
+		AND entry.started_at >= $2 AND entry.started_at < $3
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []*TimeReportRow{}
+	for rows.Next() {
+		var row TimeReportRow
+		err := rows.Scan(&row.Group, &row.ListID, &row.Seconds, &row.Entries)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, &row)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,83 @@
+//Filename: internal/data/timeentries_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeEntriesOutliveTheirList(t *testing.T) {
+	models := newTestDB(t)
+	parent := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	child := newTestList(t, models, DefaultWorkspaceID, parent.ID, CompletionManual)
+
+	ended := time.Now().Add(-time.Hour).Truncate(time.Second)
+	booked := &TimeEntry{ListID: child.ID, User: "sam", StartedAt: ended.Add(-30 * time.Minute), EndedAt: &ended}
+	if err := models.TimeEntries.Insert(DefaultWorkspaceID, booked); err != nil {
+		t.Fatal(err)
+	}
+	running := &TimeEntry{ListID: parent.ID, User: "sam"}
+	if err := models.TimeEntries.Start(DefaultWorkspaceID, running); err != nil {
+		t.Fatal(err)
+	}
+
+	//deleting the parent takes the subtask with it, but neither list's time
+	if _, err := models.List.Delete(DefaultWorkspaceID, parent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := models.TimeEntries.Report(DefaultWorkspaceID, ended.Add(-24*time.Hour), time.Now().Add(time.Hour), "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries int
+	for _, row := range report {
+		if row.ListID != nil {
+			t.Errorf("row %q still has list id %d", row.Group, *row.ListID)
+		}
+		if row.Group != child.Task {
+			t.Errorf("got group %q; want the task %q", row.Group, child.Task)
+		}
+		entries += row.Entries
+	}
+	if entries != 2 {
+		t.Errorf("got %d entries in the report; want 2", entries)
+	}
+
+	//the timer on the deleted list was stopped, so another one can start
+	other := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	if err := models.TimeEntries.Start(DefaultWorkspaceID, &TimeEntry{ListID: other.ID, User: "sam"}); err != nil {
+		t.Errorf("starting a new timer: %v", err)
+	}
+}
+
+func TestStopTimerOfMember(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Role: RoleMember}
+	if err := models.Members.Insert(sam); err != nil {
+		t.Fatal(err)
+	}
+	list := newTestList(t, models, DefaultWorkspaceID, 0, CompletionManual)
+	running := &TimeEntry{ListID: list.ID, User: "sam", MemberID: &sam.ID}
+	if err := models.TimeEntries.Start(DefaultWorkspaceID, running); err != nil {
+		t.Fatal(err)
+	}
+
+	//someone without credentials calling themselves sam can't stop it
+	if _, err := models.TimeEntries.Stop(list.ID, "sam", nil); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("stopping sam's timer anonymously returned %v; want ErrRecordNotFound", err)
+	}
+	stopped, err := models.TimeEntries.Stop(list.ID, "sam", &sam.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.ID != running.ID || stopped.EndedAt == nil || stopped.MemberID == nil || *stopped.MemberID != sam.ID {
+		t.Errorf("got entry %+v; want sam's timer stopped", stopped)
+	}
+	got, err := models.TimeEntries.Get(list.ID, running.ID)
+	if err != nil || got.MemberID == nil || *got.MemberID != sam.ID {
+		t.Errorf("got entry %+v, %v; want sam's", got, err)
+	}
+}
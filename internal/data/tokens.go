@@ -0,0 +1,220 @@
+//Filename: internal/data/tokens.go
+
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"todo.joelical.net/internal/validator"
+)
+
+// a CalendarToken lets a calendar app read the iCalendar feed of one workspace. calendar apps can't send
+// headers so the token goes in the feed url. only a hash of it is stored.
+// MemberID is the member who made it, nil when it was made without credentials
+type CalendarToken struct {
+	ID          int64      `json:"id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	MemberID    *int64     `json:"member_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Name        string     `json:"name"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Plaintext   string     `json:"token,omitempty"`
+	Hash        []byte     `json:"-"`
+}
+
+// generateToken() returns a random 26 character token and its sha-256 hash
+func generateToken() (string, []byte, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+	return plaintext, hash[:], nil
+}
+
+func ValidateCalendarToken(v *validator.Validator, token *CalendarToken) {
+	v.Check(token.Name != "", "name", "must be provided")
+	v.Check(len(token.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+// ValidateTokenPlaintext() checks a token has the shape generateToken() produces
+func ValidateTokenPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(plaintext != "", "token", "must be provided")
+	v.Check(len(plaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// define a CalendarTokenModel which wraps a sql.db connection pool
+type CalendarTokenModel struct {
+	DB *sql.DB
+}
+
+// New() generates a token and saves it. the plaintext is only available on the returned value
+func (m CalendarTokenModel) New(workspaceID int64, memberID *int64, name string) (*CalendarToken, error) {
+	plaintext, hash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	token := &CalendarToken{WorkspaceID: workspaceID, MemberID: memberID, Name: name, Plaintext: plaintext, Hash: hash}
+	query := `
+		INSERT INTO calendar_tokens (hash, name, workspace_id, member_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, token.Hash, token.Name, token.WorkspaceID, token.MemberID).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetAll() returns the calendar tokens of a workspace, without the plaintext.
+// a memberID other than 0 only returns that member's tokens
+func (m CalendarTokenModel) GetAll(workspaceID, memberID int64) ([]*CalendarToken, error) {
+	query := `
+		SELECT id, workspace_id, member_id, created_at, name, last_used_at
+		FROM calendar_tokens
+		WHERE workspace_id = $1
+		AND (member_id = $2 OR $2 = 0)
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*CalendarToken{}
+	for rows.Next() {
+		var token CalendarToken
+		err := rows.Scan(&token.ID, &token.WorkspaceID, &token.MemberID, &token.CreatedAt, &token.Name, &token.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Use() looks a token up by its plaintext and records that it was used
+func (m CalendarTokenModel) Use(plaintext string) (*CalendarToken, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+		UPDATE calendar_tokens
+		SET last_used_at = NOW()
+		WHERE hash = $1
+		RETURNING id, workspace_id, member_id, created_at, name, last_used_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var token CalendarToken
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(&token.ID, &token.WorkspaceID, &token.MemberID, &token.CreatedAt, &token.Name, &token.LastUsedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &token, nil
+}
+
+// Delete() revokes one of a workspace's calendar tokens. a memberID other than 0 only lets that member's tokens be deleted
+func (m CalendarTokenModel) Delete(workspaceID, memberID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM calendar_tokens
+		WHERE id = $1
+		AND workspace_id = $2
+		AND (member_id = $3 OR $3 = 0)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, workspaceID, memberID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// what a Token is for. a sign in token can't be used to reset a password or the other way around
+const (
+	PurposeAuthentication = "authentication"
+	PurposePasswordReset  = "password-reset"
+)
+
+// a Token signs a member in or lets them reset their password. only a hash of it is stored
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	MemberID  int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Purpose   string    `json:"-"`
+}
+
+// define a TokenModel which wraps a sql.db connection pool
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// New() generates a token for the member that runs out after ttl and saves it
+func (m TokenModel) New(memberID int64, ttl time.Duration, purpose string) (*Token, error) {
+	plaintext, hash, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{Plaintext: plaintext, Hash: hash, MemberID: memberID, Expiry: time.Now().Add(ttl), Purpose: purpose}
+	query := `
+		INSERT INTO tokens (hash, member_id, expiry, purpose)
+		VALUES ($1, $2, $3, $4)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, token.MemberID, token.Expiry, token.Purpose)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// DeleteAllForMember() revokes every token of the member made for purpose
+func (m TokenModel) DeleteAllForMember(purpose string, memberID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE purpose = $1 AND member_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, purpose, memberID)
+	return err
+}
@@ -0,0 +1,109 @@
+//Filename: internal/data/tokens_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalendarTokens(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Role: RoleMember}
+	alex := &Member{WorkspaceID: DefaultWorkspaceID, Name: "alex", Role: RoleMember}
+	for _, member := range []*Member{sam, alex} {
+		if err := models.Members.Insert(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := models.Calendar.New(DefaultWorkspaceID, &sam.ID, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Calendar.New(DefaultWorkspaceID, nil, "kitchen"); err != nil {
+		t.Fatal(err)
+	}
+
+	used, err := models.Calendar.Use(token.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.MemberID == nil || *used.MemberID != sam.ID || used.LastUsedAt == nil {
+		t.Errorf("got token %+v; want sam's, used", used)
+	}
+
+	//a member only sees and revokes their own tokens
+	tests := []struct {
+		memberID int64
+		want     int
+	}{
+		{0, 2},
+		{sam.ID, 1},
+		{alex.ID, 0},
+	}
+	for _, tt := range tests {
+		tokens, err := models.Calendar.GetAll(DefaultWorkspaceID, tt.memberID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != tt.want {
+			t.Errorf("member %d: got %d tokens; want %d", tt.memberID, len(tokens), tt.want)
+		}
+	}
+	if err := models.Calendar.Delete(DefaultWorkspaceID, alex.ID, token.ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("alex deleting sam's token returned %v; want ErrRecordNotFound", err)
+	}
+
+	//the token goes with the member who made it
+	if err := models.Members.Delete(DefaultWorkspaceID, sam.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Calendar.Use(token.Plaintext); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("using the token of a removed member returned %v; want ErrRecordNotFound", err)
+	}
+}
+
+func TestGetAllDueAssignee(t *testing.T) {
+	models := newTestDB(t)
+	sam := &Member{WorkspaceID: DefaultWorkspaceID, Name: "sam", Role: RoleMember}
+	if err := models.Members.Insert(sam); err != nil {
+		t.Fatal(err)
+	}
+	due := time.Now().Add(24 * time.Hour)
+	mine := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	nobodys := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	undated := newTestList(t, models, DefaultWorkspaceID, 0, "")
+	for _, list := range []*List{mine, nobodys} {
+		list.DueDate = &due
+	}
+	mine.AssigneeIDs = []int64{sam.ID}
+	for _, list := range []*List{mine, nobodys, undated} {
+		if _, err := models.List.Update(list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		assignee Assignee
+		want     []int64
+	}{
+		{"everyone", Assignee{}, []int64{mine.ID, nobodys.ID}},
+		{"sam", Assignee{MemberID: sam.ID}, []int64{mine.ID}},
+		{"nobody", Assignee{Unassigned: true}, []int64{nobodys.ID}},
+	}
+	for _, tt := range tests {
+		lists, err := models.List.GetAllDue(DefaultWorkspaceID, tt.assignee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int64{}
+		for _, list := range lists {
+			got = append(got, list.ID)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("%s: got lists %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+//Filename: internal/data/webhooks.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"todo.joelical.net/internal/validator"
+)
+
+// the events a webhook can subscribe to
+const (
+	EventListCreated    = "list.created"
+	EventListUpdated    = "list.updated"
+	EventListDeleted    = "list.deleted"
+	EventCommentCreated = "comment.created"
+	EventCommentUpdated = "comment.updated"
+)
+
+// ListEvents are the changes to lists recorded in list_events
+var ListEvents = []string{EventListCreated, EventListUpdated, EventListDeleted}
+
+var WebhookEvents = []string{EventListCreated, EventListUpdated, EventListDeleted, EventCommentCreated, EventCommentUpdated}
+
+// delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// a Webhook receives the events of one workspace
+type Webhook struct {
+	ID           int64     `json:"id"`
+	WorkspaceID  int64     `json:"workspace_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	URL          string    `json:"url"`
+	Secret       string    `json:"-"`
+	Events       []string  `json:"events"`
+	Active       bool      `json:"active"`
+	FailureCount int32     `json:"failure_count"`
+	Version      int32     `json:"version"`
+}
+
+// a Delivery is one event queued for one webhook, along with the outcome of the attempts made so far.
+// NextAttemptAt is only set while the delivery is waiting for another attempt
+type Delivery struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int32           `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	// filled in when a delivery is claimed by the dispatcher
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(validator.HTTPURL(webhook.URL), "url", "must be an absolute http or https url")
+
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 200, "secret", "must not be more than 200 bytes long")
+
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "contains an unknown event")
+	}
+}
+
+// define a WebhookModel which wraps a sql.db connection pool
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new webhook in webhook.WorkspaceID
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (workspace_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, active, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{webhook.WorkspaceID, webhook.URL, webhook.Secret, pq.Array(webhook.Events)}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Active, &webhook.Version)
+}
+
+// Get() allows us to retrieve a specific webhook of a workspace
+func (m WebhookModel) Get(workspaceID, id int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, workspace_id, created_at, url, secret, events, active, failure_count, version
+		FROM webhooks
+		WHERE id = $1 AND workspace_id = $2
+	`
+	var webhook Webhook
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, workspaceID).Scan(
+		&webhook.ID,
+		&webhook.WorkspaceID,
+		&webhook.CreatedAt,
+		&webhook.URL,
+		&webhook.Secret,
+		pq.Array(&webhook.Events),
+		&webhook.Active,
+		&webhook.FailureCount,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+// GetAll() returns every webhook of a workspace sorted by id
+func (m WebhookModel) GetAll(workspaceID int64) ([]*Webhook, error) {
+	query := `
+		SELECT id, workspace_id, created_at, url, secret, events, active, failure_count, version
+		FROM webhooks
+		WHERE workspace_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.WorkspaceID,
+			&webhook.CreatedAt,
+			&webhook.URL,
+			&webhook.Secret,
+			pq.Array(&webhook.Events),
+			&webhook.Active,
+			&webhook.FailureCount,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Update() allows us to edit a webhook. re-activating a webhook clears its failure count
+func (m WebhookModel) Update(webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1,
+			secret = $2,
+			events = $3,
+			active = $4,
+			failure_count = CASE WHEN $4 AND NOT active THEN 0 ELSE failure_count END,
+			version = version + 1
+		WHERE id = $5
+		AND workspace_id = $6
+		AND version = $7
+		RETURNING failure_count, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.Events),
+		webhook.Active,
+		webhook.ID,
+		webhook.WorkspaceID,
+		webhook.Version,
+	}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.FailureCount, &webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() allows us to remove a webhook of a workspace along with its deliveries
+func (m WebhookModel) Delete(workspaceID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND workspace_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enqueue() queues a delivery of the event for every active webhook in the workspace subscribed to it
+func (m WebhookModel) Enqueue(workspaceID int64, event string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1::text, $2::jsonb
+		FROM webhooks
+		WHERE active
+		AND workspace_id = $3
+		AND $1::text = ANY(events)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	//jsonb parameters are sent as strings, lib/pq would encode a []byte as bytea
+	_, err := m.DB.ExecContext(ctx, query, event, string(payload), workspaceID)
+	return err
+}
+
+// GetDeliveries() returns the most recent deliveries for a webhook. the caller checks the webhook is in its workspace
+func (m WebhookModel) GetDeliveries(webhookID int64, limit int) ([]*Delivery, error) {
+	query := `
+		SELECT id, created_at, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		var delivery Delivery
+		var payload []byte
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimDeliveries() picks up to limit pending deliveries that are due and leases them for the given duration.
+// SKIP LOCKED plus the lease stop two dispatchers from sending the same delivery
+func (m WebhookModel) ClaimDeliveries(limit int, lease time.Duration) ([]*Delivery, error) {
+	query := `
+		WITH due AS (
+			SELECT d.id
+			FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending'
+			AND d.next_attempt_at <= NOW()
+			AND w.active
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM due, webhooks w
+		WHERE d.id = due.id
+		AND w.id = d.webhook_id
+		RETURNING d.id, d.created_at, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		delivery := Delivery{Status: DeliveryPending}
+		var payload []byte
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt() saves the outcome of an attempt. the caller decides the new status and when to retry.
+// a succeeded delivery resets the webhook failure count, a failed one adds to it and
+// disables the webhook once maxFailures is reached
+func (m WebhookModel) RecordAttempt(delivery *Delivery, maxFailures int) error {
+	deliveryQuery := `
+		UPDATE webhook_deliveries
+		SET status = $1,
+			attempts = $2,
+			next_attempt_at = $3,
+			last_status_code = $4,
+			last_error = $5
+		WHERE id = $6
+	`
+	webhookQuery := `
+		UPDATE webhooks
+		SET failure_count = CASE WHEN $1 THEN 0 ELSE failure_count + 1 END,
+			active = CASE WHEN $1 THEN active ELSE failure_count + 1 < $2 END
+		WHERE id = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.ID,
+	}
+	_, err = tx.ExecContext(ctx, deliveryQuery, args...)
+	if err != nil {
+		return err
+	}
+	//only finished deliveries count towards disabling the webhook, not every retry
+	if delivery.Status != DeliveryPending {
+		_, err = tx.ExecContext(ctx, webhookQuery, delivery.Status == DeliverySucceeded, maxFailures, delivery.WebhookID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,70 @@
+//Filename: internal/data/webhooks_test.go
+
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhooksOnlyHearTheirWorkspace(t *testing.T) {
+	models := newTestDB(t)
+	other := &Workspace{Name: "Other", MaxLists: 10}
+	if err := models.Workspaces.Insert(other); err != nil {
+		t.Fatal(err)
+	}
+	hooks := map[int64]*Webhook{}
+	for _, workspaceID := range []int64{DefaultWorkspaceID, other.ID} {
+		hook := &Webhook{
+			WorkspaceID: workspaceID,
+			URL:         "https://example.com/hook",
+			Secret:      "0123456789abcdef",
+			Events:      []string{EventListCreated},
+		}
+		if err := models.Webhooks.Insert(hook); err != nil {
+			t.Fatal(err)
+		}
+		hooks[workspaceID] = hook
+	}
+
+	err := models.Webhooks.Enqueue(other.ID, EventListCreated, []byte(`{"event":"list.created"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for workspaceID, hook := range hooks {
+		deliveries, err := models.Webhooks.GetDeliveries(hook.ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 0
+		if workspaceID == other.ID {
+			want = 1
+		}
+		if len(deliveries) != want {
+			t.Errorf("the webhook in workspace %d got %d deliveries; want %d", workspaceID, len(deliveries), want)
+		}
+	}
+	claimed, err := models.Webhooks.ClaimDeliveries(10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].WebhookID != hooks[other.ID].ID {
+		t.Errorf("claimed %d deliveries; want the one for webhook %d", len(claimed), hooks[other.ID].ID)
+	}
+
+	//a webhook can't be read or removed through another workspace
+	if _, err := models.Webhooks.Get(DefaultWorkspaceID, hooks[other.ID].ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("getting the other workspace's webhook returned %v; want ErrRecordNotFound", err)
+	}
+	if err := models.Webhooks.Delete(DefaultWorkspaceID, hooks[other.ID].ID); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("deleting the other workspace's webhook returned %v; want ErrRecordNotFound", err)
+	}
+	got, err := models.Webhooks.GetAll(DefaultWorkspaceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != hooks[DefaultWorkspaceID].ID {
+		t.Errorf("got %d webhooks in the default workspace; want only webhook %d", len(got), hooks[DefaultWorkspaceID].ID)
+	}
+}
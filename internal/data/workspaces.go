@@ -0,0 +1,227 @@
+//Filename: internal/data/workspaces.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"todo.joelical.net/internal/validator"
+)
+
+// DefaultWorkspaceID is the workspace used by the /v1/list routes that don't name one.
+// lists created before workspaces existed were moved into it
+const DefaultWorkspaceID = 1
+
+// a Workspace holds the lists of one team. MaxLists is the most lists it may contain
+// and MaxStorage the most bytes of attachments. EstimateUnit says what the estimates on its lists count
+type Workspace struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	MaxLists     int32     `json:"max_lists"`
+	MaxStorage   int64     `json:"max_storage"`
+	EstimateUnit string    `json:"estimate_unit"`
+	Version      int32     `json:"version"`
+}
+
+// the units a workspace can estimate in
+const (
+	EstimatePoints  = "points"
+	EstimateMinutes = "minutes"
+)
+
+var EstimateUnits = []string{EstimatePoints, EstimateMinutes}
+
+func ValidateWorkspace(v *validator.Validator, workspace *Workspace) {
+	v.Check(workspace.Name != "", "name", "must be provided")
+	v.Check(len(workspace.Name) <= 200, "name", "must not be more than 200 bytes long")
+
+	v.Check(workspace.MaxLists > 0, "max_lists", "must be greater than zero")
+	v.Check(workspace.MaxLists <= 100000, "max_lists", "must not be more than 100000")
+
+	v.Check(workspace.MaxStorage >= 0, "max_storage", "must not be negative")
+	v.Check(workspace.MaxStorage <= 1<<40, "max_storage", "must not be more than 1TB")
+
+	v.Check(validator.In(workspace.EstimateUnit, EstimateUnits...), "estimate_unit", "must be points or minutes")
+}
+
+// define a WorkspaceModel which wraps a sql.db connection pool
+type WorkspaceModel struct {
+	DB *sql.DB
+}
+
+// Insert() allows us to create a new workspace
+func (m WorkspaceModel) Insert(workspace *Workspace) error {
+	query := `
+		INSERT INTO workspaces (name, max_lists, max_storage, estimate_unit)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{workspace.Name, workspace.MaxLists, workspace.MaxStorage, workspace.EstimateUnit}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&workspace.ID, &workspace.CreatedAt, &workspace.Version)
+}
+
+// Get() allows us to retrieve a specific workspace
+func (m WorkspaceModel) Get(id int64) (*Workspace, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, max_lists, max_storage, estimate_unit, version
+		FROM workspaces
+		WHERE id = $1
+	`
+	var workspace Workspace
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&workspace.ID,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.MaxLists,
+		&workspace.MaxStorage,
+		&workspace.EstimateUnit,
+		&workspace.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &workspace, nil
+}
+
+// GetAll() returns every workspace sorted by id
+func (m WorkspaceModel) GetAll() ([]*Workspace, error) {
+	query := `
+		SELECT id, created_at, name, max_lists, max_storage, estimate_unit, version
+		FROM workspaces
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(
+			&workspace.ID,
+			&workspace.CreatedAt,
+			&workspace.Name,
+			&workspace.MaxLists,
+			&workspace.MaxStorage,
+			&workspace.EstimateUnit,
+			&workspace.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// Update() allows us to rename a workspace or change its quotas. lowering a quota
+// below what is already used only stops new lists or attachments from being added
+func (m WorkspaceModel) Update(workspace *Workspace) error {
+	query := `
+		UPDATE workspaces
+		SET name = $1,
+			max_lists = $2,
+			max_storage = $3,
+			estimate_unit = $4,
+			version = version + 1
+		WHERE id = $5
+		AND version = $6
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{workspace.Name, workspace.MaxLists, workspace.MaxStorage, workspace.EstimateUnit, workspace.ID, workspace.Version}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&workspace.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() allows us to remove a workspace along with all of its lists
+func (m WorkspaceModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM workspaces
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// reserveLists() checks the workspace has room for n more lists, inside the caller's transaction.
+// the workspace row stays locked until the transaction ends so two inserts can't both take the last place
+func reserveLists(ctx context.Context, tx *sql.Tx, workspaceID int64, n int) error {
+	var maxLists, count int
+	err := tx.QueryRowContext(ctx, `SELECT max_lists FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceID).Scan(&maxLists)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM lists WHERE workspace_id = $1`, workspaceID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count+n > maxLists {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// lockWorkspace() locks the workspace row until the caller's transaction ends. changes that have to look at
+// other lists in the workspace, such as quotas, positions and cycle checks, take it so they happen one at a time
+func lockWorkspace(ctx context.Context, tx *sql.Tx, workspaceID int64) error {
+	_, err := tx.ExecContext(ctx, `SELECT 1 FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceID)
+	return err
+}
@@ -0,0 +1,185 @@
+//Filename: internal/jwt/jwt.go
+
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// the signing algorithms a key can use
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+)
+
+// ErrInvalidToken covers every way a token can fail to verify, the caller only needs to know it can't be trusted
+var ErrInvalidToken = errors.New("invalid token")
+
+// Claims are what a token says about the member it was issued to.
+// Scope holds the scopes separated by spaces, as in OAuth
+type Claims struct {
+	Subject   string `json:"sub"`
+	Workspace int64  `json:"ws"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Scope     string `json:"scope"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// a key signs and verifies tokens with one algorithm. ID goes in the token header as the kid
+type key struct {
+	id      string
+	alg     string
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// a KeySet signs new tokens with its first key and accepts tokens signed by any of its keys,
+// so a new key can be put first while tokens signed by the old one run out
+type KeySet struct {
+	keys []*key
+}
+
+// ParseKeys() reads a comma separated list of "kid:alg:key" entries, where key is base64url encoded.
+// HS256 keys are a secret of at least 32 bytes and EdDSA keys the 32 byte ed25519 seed
+func ParseKeys(spec string) (*KeySet, error) {
+	ks := &KeySet{}
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("jwt key %q must look like kid:alg:key", entry)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("jwt key id %q is used twice", parts[0])
+		}
+		seen[parts[0]] = true
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q is not base64url: %w", parts[0], err)
+		}
+		k := &key{id: parts[0], alg: parts[1]}
+		switch parts[1] {
+		case HS256:
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("jwt key %q must be at least 32 bytes", parts[0])
+			}
+			k.secret = raw
+		case EdDSA:
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("jwt key %q must be a %d byte ed25519 seed", parts[0], ed25519.SeedSize)
+			}
+			k.private = ed25519.NewKeyFromSeed(raw)
+			k.public = k.private.Public().(ed25519.PublicKey)
+		default:
+			return nil, fmt.Errorf("jwt key %q has unknown algorithm %q, use HS256 or EdDSA", parts[0], parts[1])
+		}
+		ks.keys = append(ks.keys, k)
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("no jwt keys given")
+	}
+	return ks, nil
+}
+
+// the header of every token
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// sign() returns the signature of the signing input
+func (k *key) sign(input string) []byte {
+	if k.alg == EdDSA {
+		return ed25519.Sign(k.private, []byte(input))
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// verify() checks a signature of the signing input in constant time
+func (k *key) verify(input string, signature []byte) bool {
+	if k.alg == EdDSA {
+		return ed25519.Verify(k.public, []byte(input), signature)
+	}
+	return hmac.Equal(k.sign(input), signature)
+}
+
+// Sign() returns a token holding the claims, signed with the first key
+func (ks *KeySet) Sign(claims Claims) (string, error) {
+	k := ks.keys[0]
+	h, err := json.Marshal(header{Alg: k.alg, Typ: "JWT", Kid: k.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return input + "." + base64.RawURLEncoding.EncodeToString(k.sign(input)), nil
+}
+
+// Verify() checks the token was signed by one of the keys with the algorithm of that key and hasn't expired at now.
+// a token without a kid is checked against the first key
+func (ks *KeySet) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	if !decodeSegment(parts[0], &h) {
+		return nil, ErrInvalidToken
+	}
+	k := ks.keys[0]
+	if h.Kid != "" {
+		k = nil
+		for _, candidate := range ks.keys {
+			if candidate.id == h.Kid {
+				k = candidate
+				break
+			}
+		}
+	}
+	//the algorithm comes from the key, never from the token, so "none" or an HS256 token signed with a public key can't get through
+	if k == nil || h.Alg != k.alg {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !k.verify(parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if !decodeSegment(parts[1], &claims) {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt == 0 || now.Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// decodeSegment() decodes a base64url json segment of a token into v
+func decodeSegment(segment string, v interface{}) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
@@ -0,0 +1,157 @@
+//Filename: internal/jwt/jwt_test.go
+
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the HMAC example in RFC 7515 appendix A.1
+func TestVerifyRFC7515(t *testing.T) {
+	ks, err := ParseKeys("example:HS256:AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9" +
+		".eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ" +
+		".dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	claims, err := ks.Verify(token, time.Unix(1300819000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ExpiresAt != 1300819380 {
+		t.Errorf("got exp %d; want 1300819380", claims.ExpiresAt)
+	}
+	if _, err := ks.Verify(token, time.Unix(1300819380, 0)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("an expired token returned %v; want ErrInvalidToken", err)
+	}
+}
+
+// the Ed25519 example in RFC 8037 appendix A.4
+func TestSignRFC8037(t *testing.T) {
+	ks, err := ParseKeys("example:EdDSA:nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := "eyJhbGciOiJFZERTQSJ9.RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc"
+	want := "hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg"
+	k := ks.keys[0]
+	if got := base64.RawURLEncoding.EncodeToString(k.sign(input)); got != want {
+		t.Errorf("got signature %s; want %s", got, want)
+	}
+	if x := base64.RawURLEncoding.EncodeToString(k.public); x != "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo" {
+		t.Errorf("got public key %s", x)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	claims := Claims{Subject: "7", Workspace: 2, Name: "sam", Role: "member", Scope: "read write", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+	secret := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))
+	seed := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("e", 32)))
+
+	for _, spec := range []string{"a:HS256:" + secret, "b:EdDSA:" + seed} {
+		ks, err := ParseKeys(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := ks.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ks.Verify(token, now)
+		if err != nil {
+			t.Fatalf("%s: %v", spec[:1], err)
+		}
+		if *got != claims {
+			t.Errorf("%s: got claims %+v; want %+v", spec[:1], *got, claims)
+		}
+
+		//changing any part of the token breaks it
+		parts := strings.Split(token, ".")
+		tampered := claims
+		tampered.Role = "owner"
+		other, _ := ks.Sign(tampered)
+		forged := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+		if _, err := ks.Verify(forged, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: a token with changed claims returned %v", spec[:1], err)
+		}
+		if _, err := ks.Verify(parts[0]+"."+parts[1]+".", now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: a token without a signature returned %v", spec[:1], err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	oldKey := "old:HS256:" + base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("o", 32)))
+	newKey := "new:EdDSA:" + base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("n", 32)))
+	before, err := ParseKeys(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ParseKeys(newKey + "," + oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := Claims{Subject: "1", ExpiresAt: now.Add(time.Minute).Unix()}
+	token, err := before.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//tokens signed with the old key still work while it is listed
+	if _, err := after.Verify(token, now); err != nil {
+		t.Errorf("a token signed with the old key returned %v", err)
+	}
+	fresh, err := after.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Verify(fresh, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("a token signed with an unknown kid returned %v", err)
+	}
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ks, err := ParseKeys("a:HS256:" + base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("s", 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","exp":1700000060}`))
+	for _, h := range []string{`{"alg":"none","kid":"a"}`, `{"alg":"EdDSA","kid":"a"}`, `{"alg":"HS256","kid":"b"}`} {
+		token := base64.RawURLEncoding.EncodeToString([]byte(h)) + "." + payload + "."
+		if _, err := ks.Verify(token, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("header %s returned %v; want ErrInvalidToken", h, err)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	secret := base64.RawURLEncoding.EncodeToString([]byte(strings.Repeat("s", 32)))
+	tests := []struct {
+		spec  string
+		valid bool
+	}{
+		{"a:HS256:" + secret, true},
+		{" a:HS256:" + secret + " , b:HS256:" + secret, true},
+		{"", false},
+		{"a:HS256", false},
+		{":HS256:" + secret, false},
+		{"a:HS256:" + base64.RawURLEncoding.EncodeToString([]byte("short")), false},
+		{"a:EdDSA:" + base64.RawURLEncoding.EncodeToString([]byte("short")), false},
+		{"a:RS256:" + secret, false},
+		{"a:HS256:not base64!", false},
+		{"a:HS256:" + secret + ",a:HS256:" + secret, false},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeys(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseKeys(%q) returned %v; want valid %t", tt.spec, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+//Filename: internal/mailer/mailer.go
+
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// the templates are built into the binary. each file defines "subject", "plainBody" and "htmlBody"
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// settings for retrying a send
+const (
+	maxAttempts = 3
+	retryDelay  = 500 * time.Millisecond
+	sendTimeout = 10 * time.Second
+)
+
+// Mailer sends templated email over SMTP
+type Mailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	sender   string
+}
+
+// New() returns a Mailer for the given SMTP server. credentials are optional
+func New(host string, port int, username, password, sender string) Mailer {
+	return Mailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		sender:   sender,
+	}
+}
+
+// Send() renders the template with the data and emails it to the recipient.
+// transient failures such as a dropped connection or a 4xx reply are retried
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	msg, err := m.render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = m.send(recipient, msg)
+		if err == nil || attempt == maxAttempts || !transient(err) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+// render() builds a multipart/alternative message with a plain text and an html part
+func (m Mailer) render(recipient, templateFile string, data interface{}) ([]byte, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+	//the html part goes through html/template so user text is escaped
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	parts := multipart.NewWriter(&msg)
+	headers := []string{
+		"From: " + m.sender,
+		"To: " + recipient,
+		"Subject: " + mime.QEncoding.Encode("utf-8", oneLine(subject.String())),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + m.messageID(),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + parts.Boundary(),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=UTF-8", plainBody.Bytes()},
+		{"text/html; charset=UTF-8", htmlBody.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.body); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// send() makes one attempt at handing the message to the SMTP server. it does what smtp.SendMail()
+// does but with a deadline, so a server that stops responding can't hang the send forever
+func (m Mailer) send(recipient string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.host, fmt.Sprint(m.port)), sendTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(m.address()); err != nil {
+		return err
+	}
+	if err = c.Rcpt(recipient); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// address() pulls the bare address out of a sender like "Todo <no-reply@example.com>"
+func (m Mailer) address() string {
+	if start := strings.LastIndex(m.sender, "<"); start >= 0 {
+		return strings.TrimSuffix(m.sender[start+1:], ">")
+	}
+	return m.sender
+}
+
+// messageID() returns a unique Message-ID on the sender's domain
+func (m Mailer) messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "localhost"
+	if at := strings.LastIndex(m.address(), "@"); at >= 0 {
+		domain = m.address()[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// transient() reports whether a failed send is worth trying again. network errors and
+// 4xx replies are temporary, 5xx replies such as an unknown mailbox are not
+func transient(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// oneLine() stops the subject from adding extra mail headers
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
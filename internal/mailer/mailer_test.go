@@ -0,0 +1,259 @@
+//Filename: internal/mailer/mailer_test.go
+
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// the fields the templates read
+type testMember struct{ Name string }
+type testList struct {
+	Name, Task, Status string
+	DueDate            *time.Time
+}
+type testComment struct{ Author, Body string }
+
+// parseMessage() reads a rendered message back into its headers and its decoded plain and html parts
+func parseMessage(t *testing.T, msg []byte) (mail.Header, string, string) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("got content type %q, %v; want multipart/alternative", mediaType, err)
+	}
+	//the reader undoes the quoted-printable encoding of each part
+	parts := multipart.NewReader(m.Body, params["boundary"])
+	bodies := map[string]string{}
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[strings.SplitN(part.Header.Get("Content-Type"), ";", 2)[0]] = string(body)
+	}
+	return m.Header, bodies["text/plain"], bodies["text/html"]
+}
+
+func TestRender(t *testing.T) {
+	m := New("localhost", 25, "", "", "Todo <no-reply@todo.example.com>")
+	due := time.Date(2030, 1, 2, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		subject  string
+		plain    []string
+		html     []string
+	}{
+		{"password reset", "password_reset.tmpl", map[string]interface{}{"Member": testMember{"sam"}, "Token": "ABCDEFGH", "Minutes": 45},
+			"Reset your Todo password",
+			[]string{"Hi sam,", `{"token": "ABCDEFGH"`, "expires in 45 minutes"},
+			[]string{"<p>Hi sam,</p>", "ABCDEFGH", "expires in 45 minutes"}},
+		{"reminder", "reminder.tmpl", map[string]interface{}{"List": testList{"home", "buy café au lait", "todo", &due}},
+			"Reminder: buy café au lait",
+			[]string{"Task: buy café au lait", "Due: Wed, 02 Jan 2030 09:30 UTC"},
+			[]string{"<td>buy café au lait</td>", "<td>Wed, 02 Jan 2030 09:30 UTC</td>"}},
+		//a name can't add headers through the subject, and the html part escapes what members write
+		{"mention", "mention.tmpl", map[string]interface{}{"Member": testMember{"alex"}, "List": testList{Name: "work", Task: "report"},
+			"Comment": testComment{"sam\r\nBcc: everyone@example.com", "<b>look</b> @alex"}},
+			"sam Bcc: everyone@example.com mentioned you on report",
+			[]string{"Hi alex,", "<b>look</b> @alex"},
+			[]string{"&lt;b&gt;look&lt;/b&gt; @alex"}},
+	}
+	for _, tt := range tests {
+		msg, err := m.render("sam@example.com", tt.template, tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		header, plain, html := parseMessage(t, msg)
+		subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+		if err != nil || subject != tt.subject {
+			t.Errorf("%s: got subject %q, %v; want %q", tt.name, subject, err, tt.subject)
+		}
+		if header.Get("Bcc") != "" || header.Get("To") != "sam@example.com" || header.Get("From") != "Todo <no-reply@todo.example.com>" {
+			t.Errorf("%s: got headers %v", tt.name, header)
+		}
+		if id := header.Get("Message-ID"); !strings.HasSuffix(id, "@todo.example.com>") {
+			t.Errorf("%s: got Message-ID %q; want one on the sender's domain", tt.name, id)
+		}
+		for _, want := range tt.plain {
+			if !strings.Contains(plain, want) {
+				t.Errorf("%s: got plain part %q; want it to contain %q", tt.name, plain, want)
+			}
+		}
+		for _, want := range tt.html {
+			if !strings.Contains(html, want) {
+				t.Errorf("%s: got html part %q; want it to contain %q", tt.name, html, want)
+			}
+		}
+	}
+
+	if _, err := m.render("sam@example.com", "welcome.tmpl", nil); err == nil {
+		t.Error("rendering a missing template returned no error")
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		sender string
+		want   string
+	}{
+		{"no-reply@example.com", "no-reply@example.com"},
+		{"Todo <no-reply@example.com>", "no-reply@example.com"},
+		{`"Todo <team>" <no-reply@example.com>`, "no-reply@example.com"},
+	}
+	for _, tt := range tests {
+		if got := New("localhost", 25, "", "", tt.sender).address(); got != tt.want {
+			t.Errorf("%q: got %q; want %q", tt.sender, got, tt.want)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"busy", &textproto.Error{Code: 451, Msg: "try again later"}, true},
+		{"unknown mailbox", &textproto.Error{Code: 550, Msg: "no such user"}, false},
+		{"refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"dropped", fmt.Errorf("reading reply: %w", io.ErrUnexpectedEOF), true},
+		{"closed", io.EOF, true},
+		{"bad template", errors.New(`template: no template "subject"`), false},
+	}
+	for _, tt := range tests {
+		if got := transient(tt.err); got != tt.want {
+			t.Errorf("%s: got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+// smtpServer is just enough of an SMTP server for Send(). each connection answers RCPT with
+// the next of the replies, and the last reply is used once they run out
+type smtpServer struct {
+	replies  []string
+	mu       sync.Mutex
+	attempts int
+	messages [][]byte
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	reply := s.replies[len(s.replies)-1]
+	if s.attempts < len(s.replies) {
+		reply = s.replies[s.attempts]
+	}
+	s.attempts++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(strings.SplitN(line, " ", 2)[0]) {
+		case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			tp.PrintfLine("%s", reply)
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			msg, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []string
+		wantErr  bool
+		attempts int
+	}{
+		{"delivered", []string{"250 ok"}, false, 1},
+		{"busy then delivered", []string{"451 try again later", "250 ok"}, false, 2},
+		{"unknown mailbox", []string{"550 no such user"}, true, 1},
+		{"busy every time", []string{"451 try again later"}, true, maxAttempts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			server := &smtpServer{replies: tt.replies}
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					go server.serve(conn)
+				}
+			}()
+
+			port := ln.Addr().(*net.TCPAddr).Port
+			m := New("127.0.0.1", port, "", "", "Todo <no-reply@todo.example.com>")
+			err = m.Send("sam@example.com", "password_reset.tmpl", map[string]interface{}{"Member": testMember{"sam"}, "Token": "ABCDEFGH", "Minutes": 45})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if server.attempts != tt.attempts {
+				t.Errorf("got %d attempts; want %d", server.attempts, tt.attempts)
+			}
+			if delivered := len(server.messages) == 1; delivered == tt.wantErr {
+				t.Errorf("got %d messages delivered; want delivered %t", len(server.messages), !tt.wantErr)
+			}
+			if len(server.messages) == 1 {
+				_, plain, _ := parseMessage(t, server.messages[0])
+				if !strings.Contains(plain, "ABCDEFGH") {
+					t.Errorf("got plain part %q; want the token", plain)
+				}
+			}
+		})
+	}
+}
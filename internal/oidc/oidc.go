@@ -0,0 +1,365 @@
+//Filename: internal/oidc/oidc.go
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken means an id token failed to verify, the login can't be trusted
+	ErrInvalidToken = errors.New("invalid id token")
+	// ErrCodeRejected means the provider would not exchange the code, it was wrong, used or doesn't match the verifier
+	ErrCodeRejected = errors.New("authorization code rejected")
+)
+
+// how far the provider's clock may be from ours when checking exp and iat
+const clockSkew = time.Minute
+
+// the provider's keys are fetched again for an unknown kid, but no more often than this
+const jwksRefetch = time.Minute
+
+// a Provider is an OpenID Connect identity provider set up for one client of it
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	client       *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*publicKey
+	fetched time.Time
+}
+
+// Discover() reads the provider's metadata from issuer/.well-known/openid-configuration.
+// redirectURL is where the provider sends the browser back with the code
+func Discover(ctx context.Context, issuer, clientID, clientSecret, redirectURL string) (*Provider, error) {
+	p := &Provider{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	err := p.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", p)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	//the metadata must be about the issuer we asked for, or its tokens would be checked against the wrong iss
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("oidc discovery: got issuer %q; want %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: the provider does not list its endpoints")
+	}
+	return p, nil
+}
+
+// getJSON() decodes the json body of a GET request into v
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// a Login is what one sign in needs to remember between sending the browser to the provider and the callback.
+// State ties the callback to the login, Nonce ties the id token to it and Verifier is the PKCE secret
+type Login struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewLogin() returns a Login with fresh random values
+func NewLogin() (*Login, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return &Login{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// Challenge() is the S256 PKCE challenge of the verifier
+func (l *Login) Challenge() string {
+	sum := sha256.Sum256([]byte(l.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthURL() is where to send the browser to sign in
+func (p *Provider) AuthURL(l *Login) string {
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {l.State},
+		"nonce":                 {l.Nonce},
+		"code_challenge":        {l.Challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange() trades the code from the callback for the raw id token
+func (p *Provider) Exchange(ctx context.Context, code string, l *Login) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {l.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	//public clients using only PKCE have no secret
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body)
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("%w: %s %s", ErrCodeRejected, body.Error, body.ErrorDescription)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("oidc token endpoint returned %s", resp.Status)
+	case err != nil:
+		return "", fmt.Errorf("oidc token endpoint: %w", err)
+	case body.IDToken == "":
+		return "", errors.New("oidc token endpoint returned no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// IDToken holds the claims of a verified id token
+type IDToken struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// audience is the aud claim, which can be one string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if json.Unmarshal(b, &one) == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	err := json.Unmarshal(b, &many)
+	*a = many
+	return err
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify() checks the id token was signed by the provider for this client and this login and hasn't expired
+func (p *Provider) Verify(ctx context.Context, raw string, l *Login, now time.Time) (*IDToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if !decodeSegment(parts[0], &h) {
+		return nil, ErrInvalidToken
+	}
+	key, err := p.key(ctx, h.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	//as with our own tokens the algorithm comes from the key, never from the token
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if key == nil || h.Alg != key.alg || err != nil || !key.verify(parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+	var token IDToken
+	if !decodeSegment(parts[1], &token) {
+		return nil, ErrInvalidToken
+	}
+	switch {
+	case token.Issuer != p.Issuer, token.Subject == "":
+		return nil, ErrInvalidToken
+	case !token.Audience.contains(p.clientID):
+		return nil, ErrInvalidToken
+	case len(token.Audience) > 1 && token.AuthorizedParty != p.clientID:
+		return nil, ErrInvalidToken
+	case token.ExpiresAt == 0 || now.Add(-clockSkew).Unix() >= token.ExpiresAt:
+		return nil, ErrInvalidToken
+	case token.IssuedAt > now.Add(clockSkew).Unix():
+		return nil, ErrInvalidToken
+	case token.Nonce != l.Nonce:
+		return nil, ErrInvalidToken
+	}
+	return &token, nil
+}
+
+// decodeSegment() decodes a base64url json segment of a token into v
+func decodeSegment(segment string, v interface{}) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// a publicKey from the provider's JWKS, RS256 or EdDSA
+type publicKey struct {
+	alg string
+	rsa *rsa.PublicKey
+	ed  ed25519.PublicKey
+}
+
+func (k *publicKey) verify(input string, signature []byte) bool {
+	if k.alg == "EdDSA" {
+		return ed25519.Verify(k.ed, []byte(input), signature)
+	}
+	sum := sha256.Sum256([]byte(input))
+	return rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, sum[:], signature) == nil
+}
+
+// key() returns the provider's key with the kid, or its only key when the token has no kid.
+// the keys are fetched again when the kid is unknown, the provider has probably rotated them
+func (p *Provider) key(ctx context.Context, kid string, now time.Time) (*publicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k := p.lookup(kid)
+	if k != nil || now.Sub(p.fetched) < jwksRefetch {
+		return k, nil
+	}
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.fetched = now
+	return p.lookup(kid), nil
+}
+
+// lookup() finds a cached key. the caller must hold the lock
+func (p *Provider) lookup(kid string) *publicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+// fetchKeys() reads the signing keys from the JWKS endpoint, skipping any it can't use
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]*publicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	err := p.getJSON(ctx, p.JWKSURI, &set)
+	if err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]*publicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var k *publicKey
+		switch {
+		case jwk.Kty == "RSA" && (jwk.Alg == "" || jwk.Alg == "RS256"):
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			modulus := new(big.Int).SetBytes(n)
+			exponent := new(big.Int).SetBytes(e)
+			if errN != nil || errE != nil || modulus.BitLen() < 2048 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+				continue
+			}
+			k = &publicKey{alg: "RS256", rsa: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}
+		case jwk.Kty == "OKP" && jwk.Crv == "Ed25519" && (jwk.Alg == "" || jwk.Alg == "EdDSA"):
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			k = &publicKey{alg: "EdDSA", ed: ed25519.PublicKey(x)}
+		default:
+			continue
+		}
+		keys[jwk.Kid] = k
+	}
+	return keys, nil
+}
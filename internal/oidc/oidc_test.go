@@ -0,0 +1,262 @@
+//Filename: internal/oidc/oidc_test.go
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP is a small identity provider. authorize() stands in for the user signing in on its login page
+type mockIdP struct {
+	*httptest.Server
+	t       *testing.T
+	rsaKey  *rsa.PrivateKey
+	edKey   ed25519.PrivateKey
+	signKid string
+
+	mu         sync.Mutex
+	codes      map[string]url.Values
+	claims     map[string]interface{}
+	jwksServed int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{t: t, rsaKey: rsaKey, edKey: edKey, signKid: "rsa1", codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		idp.jwksServed++
+		idp.mu.Unlock()
+		//the rsa key is listed under the kid it currently signs with, so changing signKid rotates it
+		rsaKid := idp.signKid
+		if rsaKid == "ed1" {
+			rsaKid = "rsa1"
+		}
+		keys := []map[string]string{
+			{"kty": "OKP", "crv": "Ed25519", "kid": "ed1", "x": b64(idp.edKey.Public().(ed25519.PublicKey))},
+			{"kty": "RSA", "kid": rsaKid, "use": "sig", "n": b64(idp.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(idp.rsaKey.E)).Bytes())},
+			{"kty": "RSA", "kid": "enc1", "use": "enc", "n": b64(idp.rsaKey.N.Bytes()), "e": "AQAB"},
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		idp.mu.Lock()
+		auth, ok := idp.codes[r.PostFormValue("code")]
+		delete(idp.codes, r.PostFormValue("code"))
+		idp.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || id != "todo" || secret != "s3cret" || r.PostFormValue("grant_type") != "authorization_code" ||
+			r.PostFormValue("redirect_uri") != auth.Get("redirect_uri") || b64(sum[:]) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "x", "token_type": "Bearer", "id_token": idp.sign(auth.Get("nonce"))})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// authorize() checks the login url the way the provider would and returns a code for it
+func (idp *mockIdP) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != "todo" || q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		idp.t.Fatalf("unexpected login url %s", authURL)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code = "code" + q.Get("state")[:8]
+	idp.codes[code] = q
+	return code, q.Get("state")
+}
+
+// sign() returns an id token for the current claims, overridden by idp.claims
+func (idp *mockIdP) sign(nonce string) string {
+	now := time.Now().Unix()
+	claims := map[string]interface{}{
+		"iss": idp.URL, "sub": "248289761001", "aud": "todo", "exp": now + 300, "iat": now,
+		"nonce": nonce, "email": "sam@example.com", "email_verified": true, "name": "Sam",
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	alg := "RS256"
+	if idp.signKid == "ed1" {
+		alg = "EdDSA"
+	}
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": idp.signKid, "typ": "JWT"})
+	p, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(p)
+	var sig []byte
+	if alg == "EdDSA" {
+		sig = ed25519.Sign(idp.edKey, []byte(input))
+	} else {
+		sum := sha256.Sum256([]byte(input))
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, sum[:])
+	}
+	return input + "." + b64(sig)
+}
+
+// login() goes through a whole sign in and returns the verified id token
+func (idp *mockIdP) login(p *Provider) (*IDToken, error) {
+	l, err := NewLogin()
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	code, state := idp.authorize(p.AuthURL(l))
+	if state != l.State {
+		idp.t.Fatalf("got state %q; want %q", state, l.State)
+	}
+	raw, err := p.Exchange(context.Background(), code, l)
+	if err != nil {
+		return nil, err
+	}
+	return p.Verify(context.Background(), raw, l, time.Now())
+}
+
+func TestLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	p, err := Discover(context.Background(), idp.URL, "todo", "s3cret", "http://localhost:4000/v1/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{"rsa1", "ed1"} {
+		idp.signKid = kid
+		token, err := idp.login(p)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		if token.Subject != "248289761001" || token.Email != "sam@example.com" || !token.EmailVerified {
+			t.Errorf("%s: got claims %+v", kid, token)
+		}
+	}
+	if idp.jwksServed != 1 {
+		t.Errorf("the keys were fetched %d times; want once", idp.jwksServed)
+	}
+}
+
+func TestLoginFails(t *testing.T) {
+	idp := newMockIdP(t)
+	p, err := Discover(context.Background(), idp.URL, "todo", "s3cret", "http://localhost:4000/v1/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+	}{
+		{"other audience", map[string]interface{}{"aud": "someone-else"}},
+		{"other party", map[string]interface{}{"aud": []string{"todo", "other"}, "azp": "other"}},
+		{"other issuer", map[string]interface{}{"iss": "https://evil.example.com"}},
+		{"expired", map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"replayed", map[string]interface{}{"nonce": "from another login"}},
+		{"no subject", map[string]interface{}{"sub": ""}},
+	}
+	for _, tt := range tests {
+		idp.claims = tt.claims
+		if _, err := idp.login(p); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v; want ErrInvalidToken", tt.name, err)
+		}
+	}
+	idp.claims = map[string]interface{}{"aud": []string{"todo", "other"}, "azp": "todo"}
+	if _, err := idp.login(p); err != nil {
+		t.Errorf("a token for several audiences returned %v", err)
+	}
+	idp.claims = nil
+
+	//the code is bound to the verifier, someone who steals it can't use it
+	l, _ := NewLogin()
+	code, _ := idp.authorize(p.AuthURL(l))
+	other, _ := NewLogin()
+	if _, err := p.Exchange(context.Background(), code, other); !errors.Is(err, ErrCodeRejected) {
+		t.Errorf("exchanging with the wrong verifier returned %v; want ErrCodeRejected", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, l); !errors.Is(err, ErrCodeRejected) {
+		t.Errorf("exchanging a used code returned %v; want ErrCodeRejected", err)
+	}
+
+	//a token signed with the right key but claiming another algorithm is refused
+	l, _ = NewLogin()
+	raw := idp.sign(l.Nonce)
+	parts := strings.Split(raw, ".")
+	h := b64([]byte(`{"alg":"EdDSA","kid":"rsa1"}`))
+	for _, forged := range []string{h + "." + parts[1] + "." + parts[2], b64([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."} {
+		if _, err := p.Verify(context.Background(), forged, l, time.Now()); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("a forged header returned %v; want ErrInvalidToken", err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	idp := newMockIdP(t)
+	p, err := Discover(context.Background(), idp.URL, "todo", "s3cret", "http://localhost:4000/v1/auth/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idp.login(p); err != nil {
+		t.Fatal(err)
+	}
+	//the provider starts signing with a new kid, it is fetched once the cache is old enough
+	idp.signKid = "rsa2"
+	l, _ := NewLogin()
+	raw := idp.sign(l.Nonce)
+	if _, err := p.Verify(context.Background(), raw, l, time.Now()); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("an unknown kid right after a fetch returned %v; want ErrInvalidToken", err)
+	}
+	if _, err := p.Verify(context.Background(), raw, l, time.Now().Add(2*jwksRefetch)); err != nil {
+		t.Errorf("a rotated key returned %v", err)
+	}
+	if idp.jwksServed != 2 {
+		t.Errorf("the keys were fetched %d times; want twice", idp.jwksServed)
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	idp := newMockIdP(t)
+	if _, err := Discover(context.Background(), idp.URL+"/", "todo", "", ""); err == nil {
+		t.Error("discovery for another issuer succeeded")
+	}
+}
@@ -0,0 +1,136 @@
+//Filename: internal/storage/local_test.go
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader returns some data and then an error, like an upload that is cut off
+type failingReader struct {
+	sent bool
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.sent {
+		return 0, errors.New("connection reset")
+	}
+	f.sent = true
+	return copy(p, "partial"), nil
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewLocal(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+
+	//a failed upload leaves nothing behind, not even the temporary file
+	_, err = store.Put(ctx, "ws/2/broken", &failingReader{})
+	if err == nil {
+		t.Fatal("expected the put to fail")
+	}
+	_, err = store.Open(ctx, "ws/2/broken", 0)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v; want ErrNotFound", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs", "ws", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d files left over; want none", len(entries))
+	}
+
+	for _, key := range []string{"", "../escape", "ws/../../escape", "/abs", "a//b", "a/b/", "a.b"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) was accepted", key)
+		}
+		if _, err := store.Open(ctx, key, 0); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Open(%q) returned %v; want an invalid key error", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); err == nil {
+		t.Error("a key wrote outside the store's directory")
+	}
+}
+
+// testBlobStore() checks the behaviour every BlobStore shares
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	content := "the quick brown fox jumps over the lazy dog"
+
+	n, err := store.Put(ctx, "ws/1/abc", strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) {
+		t.Errorf("put %d bytes; want %d", n, len(content))
+	}
+	read := func(offset int64) string {
+		t.Helper()
+		body, err := store.Open(ctx, "ws/1/abc", offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if got := read(0); got != content {
+		t.Errorf("got %q; want %q", got, content)
+	}
+	if got := read(40); got != "dog" {
+		t.Errorf("from offset 40 got %q; want %q", got, "dog")
+	}
+
+	//NewReader seeks the way http.ServeContent does for a range request
+	reader := NewReader(ctx, store, "ws/1/abc", int64(len(content)))
+	if _, err := reader.Seek(-8, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(reader, b); err != nil || string(b) != "lazy" {
+		t.Errorf("got %q, %v; want %q", b, err, "lazy")
+	}
+	if _, err := reader.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(reader, b[:3]); err != nil || string(b[:3]) != "qui" {
+		t.Errorf("got %q, %v; want %q", b[:3], err, "qui")
+	}
+	if _, err := reader.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start was allowed")
+	}
+	reader.Close()
+
+	//replacing a blob
+	if _, err := store.Put(ctx, "ws/1/abc", strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(0); got != "new" {
+		t.Errorf("got %q; want %q", got, "new")
+	}
+
+	if err := store.Delete(ctx, "ws/1/abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, "ws/1/abc", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after delete; want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "ws/1/abc"); err != nil {
+		t.Errorf("deleting a missing blob returned %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+//Filename: internal/storage/storage.go
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when a key is not in the store
+var ErrNotFound = errors.New("blob not found")
+
+// a BlobStore keeps the bytes of uploaded files under a key. the metadata lives in postgres
+type BlobStore interface {
+	// Put() streams r into the store under key and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open() returns the blob from offset to the end
+	Open(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
+	// Delete() removes a blob. deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// blobReader lets a blob of a known size be read with seeks, as http.ServeContent needs for range requests.
+// a seek only moves the offset, the blob is reopened at the offset on the next read
+type blobReader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewReader() returns an io.ReadSeekCloser over a blob that is size bytes long
+func NewReader(ctx context.Context, store BlobStore, key string, size int64) io.ReadSeekCloser {
+	return &blobReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		body, err := b.store.Open(b.ctx, b.key, b.offset)
+		if err != nil {
+			return 0, err
+		}
+		b.body = body
+	}
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	return n, err
+}
+
+func (b *blobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	if offset != b.offset && b.body != nil {
+		b.body.Close()
+		b.body = nil
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+func (b *blobReader) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	err := b.body.Close()
+	b.body = nil
+	return err
+}
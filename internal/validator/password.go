@@ -0,0 +1,61 @@
+// Filename: internal/validator/password.go
+
+package validator
+
+import (
+	"strings"
+	"unicode"
+)
+
+// passwords people pick so often that they are tried first when guessing
+var commonPasswords = []string{
+	"password", "password1", "password123", "passw0rd", "1234567890", "12345678910", "0123456789",
+	"qwertyuiop", "qwerty1234", "1q2w3e4r5t", "iloveyou12", "letmein123", "welcome123", "admin12345",
+	"abcdefghij", "abc1234567", "changeme12", "trustno1234", "football12", "baseball12", "sunshine12",
+}
+
+// PasswordWeakness() returns why a password is too easy to guess, or "" when it is strong enough.
+// personal holds things such as the person's name and email that shouldn't be part of it.
+// bcrypt ignores everything after 72 bytes so longer passwords are refused rather than cut short
+func PasswordWeakness(password string, personal ...string) string {
+	switch {
+	case len(password) < 10:
+		return "must be at least 10 bytes long"
+	case len(password) > 72:
+		return "must not be more than 72 bytes long"
+	}
+	lower := strings.ToLower(password)
+	if In(lower, commonPasswords...) {
+		return "is too common, choose another one"
+	}
+	for _, p := range personal {
+		p = strings.ToLower(p)
+		if at := strings.LastIndex(p, "@"); at >= 0 {
+			p = p[:at]
+		}
+		if len(p) >= 3 && strings.Contains(lower, p) {
+			return "must not contain your name or email"
+		}
+	}
+	distinct := make(map[rune]bool)
+	kinds := make(map[string]bool)
+	for _, r := range password {
+		distinct[r] = true
+		switch {
+		case unicode.IsLetter(r):
+			kinds["letter"] = true
+		case unicode.IsDigit(r):
+			kinds["digit"] = true
+		default:
+			kinds["symbol"] = true
+		}
+	}
+	//a long passphrase is fine on its own, shorter passwords need some variety
+	if len(distinct) < 5 {
+		return "must use at least 5 different characters"
+	}
+	if len(password) < 16 && len(kinds) < 2 {
+		return "must mix letters with digits or symbols, or be at least 16 bytes long"
+	}
+	return ""
+}
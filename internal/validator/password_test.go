@@ -0,0 +1,33 @@
+//Filename: internal/validator/password_test.go
+
+package validator
+
+import "testing"
+
+func TestPasswordWeakness(t *testing.T) {
+	tests := []struct {
+		password string
+		personal []string
+		weak     bool
+	}{
+		{"correct-horse", nil, false},
+		{"tr0ub4dor&3x", nil, false},
+		{"a long passphrase with spaces", nil, false},
+		{"onlylettersbutlong", nil, false},
+		{"short1!", nil, true},
+		{"onlyletters", nil, true},
+		{"1234567890", nil, true},
+		{"Password123", nil, true},
+		{"aaaaaaaaaaaaaaaaaaaa", nil, true},
+		{"sam.jones!2024", []string{"sam.jones", "sam.jones@example.com"}, true},
+		{"hello-sam-2024", []string{"alex", "Sam@Example.com"}, true},
+		{"hello-alex-2024", []string{"sam", "sam@example.com"}, false},
+		{string(make([]byte, 73)), nil, true},
+	}
+	for _, tt := range tests {
+		weakness := PasswordWeakness(tt.password, tt.personal...)
+		if (weakness != "") != tt.weak {
+			t.Errorf("PasswordWeakness(%q) = %q; want weak %t", tt.password, weakness, tt.weak)
+		}
+	}
+}
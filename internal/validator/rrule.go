@@ -0,0 +1,195 @@
+// Filename: internal/validator/rrule.go
+
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of an RFC 5545 recurrence rule that recurring tasks support:
+// FREQ=DAILY|WEEKLY|MONTHLY with optional INTERVAL, BYDAY (weekly only) and either UNTIL or COUNT
+type RRule struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Until    *time.Time
+	Count    int
+}
+
+// the two letter weekday codes used by BYDAY
+var rruleDays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ParseRRule() parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR;COUNT=10".
+// the error message is written to be shown to the user
+func ParseRRule(value string) (*RRule, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return nil, errors.New("must not be empty")
+	}
+	rule := &RRule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(part, "=")
+		key = strings.ToUpper(key)
+		if !found || val == "" {
+			return nil, fmt.Errorf("%q must be written as NAME=VALUE", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s must only appear once", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+			if !In(rule.Freq, "DAILY", "WEEKLY", "MONTHLY") {
+				return nil, errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 366 {
+				return nil, errors.New("INTERVAL must be a number between 1 and 366")
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 1000 {
+				return nil, errors.New("COUNT must be a number between 1 and 1000")
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseRRuleTime(val)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(strings.ToUpper(val), ",") {
+				day, ok := rruleDays[code]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY contains an unknown day %q", code)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported", key)
+		}
+	}
+	switch {
+	case rule.Freq == "":
+		return nil, errors.New("FREQ must be provided")
+	case rule.Count > 0 && rule.Until != nil:
+		return nil, errors.New("COUNT and UNTIL must not both be used")
+	case len(rule.ByDay) > 0 && rule.Freq != "WEEKLY":
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	return rule, nil
+}
+
+// parseRRuleTime() reads an UNTIL value, either a date or a UTC date-time
+func parseRRuleTime(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		//a date on its own includes the whole day
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, errors.New("UNTIL must be a date (YYYYMMDD) or a UTC date-time (YYYYMMDDTHHMMSSZ)")
+}
+
+// Next() returns the occurrence after the one at current. the bool is false when the rule has
+// no more occurrences, because COUNT is used up or the next one would fall after UNTIL.
+// COUNT is the number of occurrences left including current, the caller saves the rule
+// returned by Remaining() with the next occurrence
+func (r *RRule) Next(current time.Time) (time.Time, bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+	var next time.Time
+	switch r.Freq {
+	case "DAILY":
+		next = current.AddDate(0, 0, r.Interval)
+	case "WEEKLY":
+		next = r.nextWeekly(current)
+	case "MONTHLY":
+		//months without the day, like the 31st of April, are skipped as RFC 5545 requires
+		for i := 1; ; i++ {
+			next = current.AddDate(0, r.Interval*i, 0)
+			if next.Day() == current.Day() {
+				break
+			}
+		}
+	}
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// nextWeekly() finds the next BYDAY weekday in a week that the INTERVAL allows.
+// weeks start on Monday, the RFC 5545 default
+func (r *RRule) nextWeekly(current time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return current.AddDate(0, 0, 7*r.Interval)
+	}
+	weekStart := func(t time.Time) time.Time {
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+	}
+	start := weekStart(current)
+	for next := current.AddDate(0, 0, 1); ; next = next.AddDate(0, 0, 1) {
+		weeks := int(weekStart(next).Sub(start).Hours()+12) / (24 * 7)
+		if weeks%r.Interval != 0 {
+			continue
+		}
+		for _, day := range r.ByDay {
+			if next.Weekday() == day {
+				return next
+			}
+		}
+	}
+}
+
+// Remaining() returns the rule to store on the next occurrence
+func (r *RRule) Remaining() *RRule {
+	next := *r
+	if next.Count > 1 {
+		next.Count--
+	}
+	return &next
+}
+
+// String() writes the rule back out in RFC 5545 form
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = strings.ToUpper(day.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
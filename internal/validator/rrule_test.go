@@ -0,0 +1,126 @@
+// Filename: internal/validator/rrule_test.go
+
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "FREQ=DAILY", want: "FREQ=DAILY"},
+		{value: "RRULE:freq=weekly;interval=2;byday=mo,fr", want: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"},
+		{value: "FREQ=MONTHLY;COUNT=10", want: "FREQ=MONTHLY;COUNT=10"},
+		{value: "FREQ=DAILY;UNTIL=20240105T120000Z", want: "FREQ=DAILY;UNTIL=20240105T120000Z"},
+		{value: "FREQ=DAILY;UNTIL=20240105", want: "FREQ=DAILY;UNTIL=20240105T235959Z"},
+		{value: "", err: true},
+		{value: "INTERVAL=2", err: true},
+		{value: "FREQ=YEARLY", err: true},
+		{value: "FREQ=DAILY;INTERVAL=0", err: true},
+		{value: "FREQ=DAILY;INTERVAL=367", err: true},
+		{value: "FREQ=DAILY;COUNT=0", err: true},
+		{value: "FREQ=DAILY;COUNT=2;UNTIL=20240105", err: true},
+		{value: "FREQ=DAILY;UNTIL=2024-01-05", err: true},
+		{value: "FREQ=DAILY;BYDAY=MO", err: true},
+		{value: "FREQ=WEEKLY;BYDAY=XX", err: true},
+		{value: "FREQ=DAILY;FREQ=WEEKLY", err: true},
+		{value: "FREQ=DAILY;BYMONTH=1", err: true},
+		{value: "FREQ", err: true},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRRule(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseRRule(%q) = %q; want an error", tt.value, rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRRule(%q) returned %v", tt.value, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("ParseRRule(%q) = %q; want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRRuleNext(t *testing.T) {
+	date := func(value string) time.Time {
+		t, err := time.Parse("2006-01-02T15:04", value)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		rule    string
+		current string
+		want    string
+	}{
+		{"FREQ=DAILY", "2024-01-30T09:00", "2024-01-31T09:00"},
+		{"FREQ=DAILY;INTERVAL=3", "2024-01-30T09:00", "2024-02-02T09:00"},
+		{"FREQ=WEEKLY", "2024-01-01T09:00", "2024-01-08T09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2", "2024-01-01T09:00", "2024-01-15T09:00"},
+		//2024-01-01 is a Monday
+		{"FREQ=WEEKLY;BYDAY=MO,FR", "2024-01-01T09:00", "2024-01-05T09:00"},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", "2024-01-05T09:00", "2024-01-08T09:00"},
+		{"FREQ=WEEKLY;BYDAY=SU", "2024-01-01T09:00", "2024-01-07T09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "2024-01-01T09:00", "2024-01-02T09:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", "2024-01-05T09:00", "2024-01-15T09:00"},
+		{"FREQ=WEEKLY;INTERVAL=3;BYDAY=MO", "2024-01-01T09:00", "2024-01-22T09:00"},
+		{"FREQ=MONTHLY", "2024-01-15T09:00", "2024-02-15T09:00"},
+		{"FREQ=MONTHLY", "2024-01-29T09:00", "2024-02-29T09:00"},
+		{"FREQ=MONTHLY", "2023-01-29T09:00", "2023-03-29T09:00"},
+		{"FREQ=MONTHLY", "2024-01-31T09:00", "2024-03-31T09:00"},
+		{"FREQ=MONTHLY", "2024-03-31T09:00", "2024-05-31T09:00"},
+		{"FREQ=MONTHLY", "2024-12-31T09:00", "2025-01-31T09:00"},
+		{"FREQ=MONTHLY;INTERVAL=2", "2023-12-31T09:00", "2024-08-31T09:00"},
+		{"FREQ=DAILY;COUNT=2", "2024-01-01T09:00", "2024-01-02T09:00"},
+		{"FREQ=DAILY;COUNT=1", "2024-01-01T09:00", ""},
+		{"FREQ=DAILY;UNTIL=20240105", "2024-01-04T09:00", "2024-01-05T09:00"},
+		{"FREQ=DAILY;UNTIL=20240105", "2024-01-05T09:00", ""},
+		{"FREQ=DAILY;UNTIL=20240105T120000Z", "2024-01-04T13:00", ""},
+		{"FREQ=MONTHLY;UNTIL=20240301", "2024-01-31T09:00", ""},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRRule(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRRule(%q) returned %v", tt.rule, err)
+		}
+		next, ok := rule.Next(date(tt.current))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s from %s = %s; want no more occurrences", tt.rule, tt.current, next)
+			}
+			continue
+		}
+		if !ok || !next.Equal(date(tt.want)) {
+			t.Errorf("%s from %s = %s, %t; want %s", tt.rule, tt.current, next, ok, tt.want)
+		}
+	}
+}
+
+func TestRRuleRemaining(t *testing.T) {
+	rule, err := ParseRRule("FREQ=DAILY;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	var occurrences int
+	for ok := true; ok; occurrences++ {
+		current, ok = rule.Next(current)
+		rule = rule.Remaining()
+	}
+	if occurrences != 3 {
+		t.Errorf("got %d occurrences; want 3", occurrences)
+	}
+	if got := rule.String(); got != "FREQ=DAILY;COUNT=1" {
+		t.Errorf("got %q; want %q", got, "FREQ=DAILY;COUNT=1")
+	}
+}
@@ -53,6 +53,16 @@ func ValidWebsite(website string) bool {
 	return err == nil
 }
 
+// HTTPURL() checks the value is an absolute http or https url with a host.
+// it is used for urls the server sends requests to, where a relative path or another scheme makes no sense
+func HTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Hostname() != ""
+}
+
 // AddError() adds an error entry to the Errors map
 func (v *Validator) AddError(key, message string) {
 	if _, exists := v.Errors[key]; !exists {
@@ -0,0 +1,30 @@
+// Filename: internal/validator/validator_test.go
+
+package validator
+
+import "testing"
+
+func TestHTTPURL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://localhost:8080", true},
+		{"http://10.0.0.1/x?y=z", true},
+		{"/x", false},
+		{"example.com/hooks", false},
+		{"ftp://example.com/hooks", false},
+		{"mailto:someone@example.com", false},
+		{"javascript:alert(1)", false},
+		{"http://", false},
+		{"http:///path", false},
+		{"https://:443/path", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := HTTPURL(tt.value); got != tt.want {
+			t.Errorf("HTTPURL(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+-- Filename: migrations/000003_create_list_revisions_table.down.sql
+
+DROP TABLE IF EXISTS list_revisions;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Filename: migrations/000003_create_list_revisions_table.up.sql
+
+CREATE TABLE IF NOT EXISTS list_revisions (
+    id bigserial PRIMARY KEY,
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    version integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    snapshot jsonb NOT NULL,
+    UNIQUE (list_id, version)
+);
\ No newline at end of file
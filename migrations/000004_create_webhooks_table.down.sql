@@ -0,0 +1,4 @@
+-- Filename: migrations/000004_create_webhooks_table.down.sql
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000005_create_list_events_table.down.sql
+
+DROP TRIGGER IF EXISTS lists_record_event ON lists;
+DROP FUNCTION IF EXISTS record_list_event();
+DROP TABLE IF EXISTS list_events;
\ No newline at end of file
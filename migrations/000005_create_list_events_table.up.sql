@@ -0,0 +1,36 @@
+-- Filename: migrations/000005_create_list_events_table.up.sql
+
+CREATE TABLE IF NOT EXISTS list_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    event text NOT NULL,
+    list_id bigint NOT NULL,
+    list jsonb NOT NULL
+);
+
+-- every change to the lists table is recorded and announced, so any API replica can pick it up
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.created', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.updated', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.deleted', OLD.id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER lists_record_event
+AFTER INSERT OR UPDATE OR DELETE ON lists
+FOR EACH ROW EXECUTE FUNCTION record_list_event();
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- Filename: migrations/000006_serialize_list_events.down.sql
+
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.created', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.updated', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.deleted', OLD.id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
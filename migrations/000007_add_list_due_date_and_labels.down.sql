@@ -0,0 +1,4 @@
+-- Filename: migrations/000007_add_list_due_date_and_labels.down.sql
+
+ALTER TABLE lists DROP COLUMN IF EXISTS labels;
+ALTER TABLE lists DROP COLUMN IF EXISTS due_date;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Filename: migrations/000007_add_list_due_date_and_labels.up.sql
+
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS due_date timestamp(0) with time zone;
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS labels text[] NOT NULL DEFAULT '{}';
\ No newline at end of file
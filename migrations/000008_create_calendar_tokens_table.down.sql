@@ -0,0 +1,4 @@
+-- Filename: migrations/000008_create_calendar_tokens_table.down.sql
+
+DROP INDEX IF EXISTS lists_due_date_idx;
+DROP TABLE IF EXISTS calendar_tokens;
\ No newline at end of file
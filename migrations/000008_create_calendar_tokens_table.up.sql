@@ -0,0 +1,11 @@
+-- Filename: migrations/000008_create_calendar_tokens_table.up.sql
+
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    hash bytea NOT NULL UNIQUE,
+    name text NOT NULL,
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS lists_due_date_idx ON lists (due_date) WHERE due_date IS NOT NULL;
\ No newline at end of file
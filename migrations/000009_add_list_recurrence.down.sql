@@ -0,0 +1,3 @@
+-- Filename: migrations/000009_add_list_recurrence.down.sql
+
+ALTER TABLE lists DROP COLUMN IF EXISTS recurrence;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000009_add_list_recurrence.up.sql
+
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS recurrence text NOT NULL DEFAULT '';
\ No newline at end of file
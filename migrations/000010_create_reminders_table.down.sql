@@ -0,0 +1,3 @@
+-- Filename: migrations/000010_create_reminders_table.down.sql
+
+DROP TABLE IF EXISTS reminders;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- Filename: migrations/000010_create_reminders_table.up.sql
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    remind_at timestamp(0) with time zone NOT NULL,
+    channel text NOT NULL,
+    target text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL,
+    sent_at timestamp(0) with time zone,
+    last_error text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS reminders_list_id_idx ON reminders (list_id);
+CREATE INDEX IF NOT EXISTS reminders_pending_idx ON reminders (next_attempt_at) WHERE status = 'pending';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000011_create_members_table.down.sql
+
+DROP TABLE IF EXISTS members;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- Filename: migrations/000011_create_members_table.up.sql
+
+-- the people who use the api. they sign in with their email and password, a member without
+-- an email can't sign in or reset their password. the hash is NULL until a password is set
+CREATE TABLE IF NOT EXISTS members (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    email text NOT NULL DEFAULT '',
+    password_hash bytea,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_email_idx ON members (lower(email)) WHERE email <> '';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000012_create_tokens_table.down.sql
+
+DROP TABLE IF EXISTS tokens;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- Filename: migrations/000012_create_tokens_table.up.sql
+
+-- short lived tokens for signing in and resetting a password. only a hash is stored,
+-- purpose says which of the two a token is so one can't be used as the other
+CREATE TABLE IF NOT EXISTS tokens (
+    hash bytea PRIMARY KEY,
+    member_id bigint NOT NULL REFERENCES members ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL,
+    purpose text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS tokens_member_id_idx ON tokens (member_id);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000013_create_api_keys_table.down.sql
+
+DROP TABLE IF EXISTS api_keys;
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- Filename: migrations/000013_create_api_keys_table.up.sql
+
+-- long lived keys for scripts. a key acts as the member it belongs to, narrowed by its scopes.
+-- only a hash is stored, the prefix is kept so a key can be recognised in the list of keys
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    member_id bigint NOT NULL REFERENCES members ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash bytea NOT NULL UNIQUE,
+    scopes text[] NOT NULL,
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_member_id_idx ON api_keys (member_id);
\ No newline at end of file
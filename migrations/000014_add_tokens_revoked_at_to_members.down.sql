@@ -0,0 +1,3 @@
+-- Filename: migrations/000014_add_tokens_revoked_at_to_members.down.sql
+
+ALTER TABLE members DROP COLUMN IF EXISTS tokens_revoked_at;
\ No newline at end of file
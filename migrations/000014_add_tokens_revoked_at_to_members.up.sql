@@ -0,0 +1,5 @@
+-- Filename: migrations/000014_add_tokens_revoked_at_to_members.up.sql
+
+-- when a member's signed tokens were last revoked. signed tokens are checked without the database,
+-- so each server keeps these times in memory and hears about new ones through NOTIFY
+ALTER TABLE members ADD COLUMN IF NOT EXISTS tokens_revoked_at timestamp with time zone;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Filename: migrations/000015_add_oidc_subject_to_members.down.sql
+
+DROP INDEX IF EXISTS members_oidc_subject_idx;
+ALTER TABLE members DROP COLUMN IF EXISTS oidc_subject;
\ No newline at end of file
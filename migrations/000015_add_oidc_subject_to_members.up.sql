@@ -0,0 +1,7 @@
+-- Filename: migrations/000015_add_oidc_subject_to_members.up.sql
+
+-- the provider's subject of a member who signs in with sso. it is filled in on their first sign in,
+-- matched by email, and later sign ins use it so a changed email at the provider doesn't lose the member
+ALTER TABLE members ADD COLUMN IF NOT EXISTS oidc_subject text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_oidc_subject_idx ON members (oidc_subject);
\ No newline at end of file
@@ -0,0 +1,42 @@
+-- Filename: migrations/000016_create_workspaces_table.down.sql
+
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('list_events'));
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.created', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.updated', NEW.id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, list)
+        VALUES ('list.deleted', OLD.id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS webhooks_workspace_id_idx;
+ALTER TABLE webhooks DROP COLUMN IF EXISTS workspace_id;
+
+DROP INDEX IF EXISTS workspace_members_oidc_subject_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS members_oidc_subject_idx ON workspace_members (oidc_subject);
+DROP INDEX IF EXISTS workspace_members_email_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS members_email_idx ON workspace_members (lower(email)) WHERE email <> '';
+ALTER TABLE workspace_members DROP CONSTRAINT IF EXISTS workspace_members_workspace_id_name_key;
+ALTER TABLE workspace_members ADD CONSTRAINT members_name_key UNIQUE (name);
+ALTER TABLE workspace_members DROP COLUMN IF EXISTS role;
+ALTER TABLE workspace_members DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE workspace_members RENAME TO members;
+
+ALTER TABLE list_events DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE calendar_tokens DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE lists DROP COLUMN IF EXISTS workspace_id;
+DROP TABLE IF EXISTS workspaces;
\ No newline at end of file
@@ -0,0 +1,68 @@
+-- Filename: migrations/000016_create_workspaces_table.up.sql
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    max_lists integer NOT NULL DEFAULT 1000,
+    version integer NOT NULL DEFAULT 1
+);
+
+-- lists created before workspaces existed go into the default workspace, which the /v1/list routes keep using
+INSERT INTO workspaces (id, name) VALUES (1, 'Default') ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('workspaces', 'id'), (SELECT MAX(id) FROM workspaces));
+
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+ALTER TABLE lists ALTER COLUMN workspace_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS lists_workspace_id_idx ON lists (workspace_id);
+
+ALTER TABLE calendar_tokens ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+ALTER TABLE calendar_tokens ALTER COLUMN workspace_id DROP DEFAULT;
+
+-- events keep the workspace so sync and streams only see their own workspace's changes
+ALTER TABLE list_events ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1;
+ALTER TABLE list_events ALTER COLUMN workspace_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS list_events_workspace_id_idx ON list_events (workspace_id, id);
+
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('list_events'));
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.created', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.updated', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.deleted', OLD.id, OLD.workspace_id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- members belong to a workspace now, the ones from before are the default workspace's owners
+ALTER TABLE members RENAME TO workspace_members;
+ALTER TABLE workspace_members ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+ALTER TABLE workspace_members ALTER COLUMN workspace_id DROP DEFAULT;
+ALTER TABLE workspace_members ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'owner';
+ALTER TABLE workspace_members ALTER COLUMN role SET DEFAULT 'member';
+
+-- names, emails and sso subjects only need to be unique within a workspace
+ALTER TABLE workspace_members DROP CONSTRAINT IF EXISTS members_name_key;
+ALTER TABLE workspace_members ADD CONSTRAINT workspace_members_workspace_id_name_key UNIQUE (workspace_id, name);
+DROP INDEX IF EXISTS members_email_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS workspace_members_email_idx ON workspace_members (workspace_id, lower(email)) WHERE email <> '';
+DROP INDEX IF EXISTS members_oidc_subject_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS workspace_members_oidc_subject_idx ON workspace_members (workspace_id, oidc_subject);
+
+-- webhooks only hear about their own workspace. the ones made before this were for the default workspace
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS workspace_id bigint NOT NULL DEFAULT 1 REFERENCES workspaces ON DELETE CASCADE;
+ALTER TABLE webhooks ALTER COLUMN workspace_id DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS webhooks_workspace_id_idx ON webhooks (workspace_id);
\ No newline at end of file
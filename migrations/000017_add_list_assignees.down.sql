@@ -0,0 +1,6 @@
+-- Filename: migrations/000017_add_list_assignees.down.sql
+
+DROP TRIGGER IF EXISTS workspace_members_unassign ON workspace_members;
+DROP FUNCTION IF EXISTS unassign_removed_member();
+DROP INDEX IF EXISTS lists_assignee_ids_idx;
+ALTER TABLE lists DROP COLUMN IF EXISTS assignee_ids;
\ No newline at end of file
@@ -0,0 +1,25 @@
+-- Filename: migrations/000017_add_list_assignees.up.sql
+
+-- the members a list is assigned to. ids are checked against the workspace's members when a list is saved
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS assignee_ids bigint[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS lists_assignee_ids_idx ON lists USING GIN (assignee_ids);
+
+-- a member who is removed is taken off their lists. the change is saved as a new version like any other edit
+CREATE OR REPLACE FUNCTION unassign_removed_member() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO list_revisions (list_id, version, snapshot)
+    SELECT id, version, to_jsonb(lists)
+    FROM lists
+    WHERE workspace_id = OLD.workspace_id AND assignee_ids @> ARRAY[OLD.id];
+
+    UPDATE lists
+    SET assignee_ids = array_remove(assignee_ids, OLD.id), version = version + 1
+    WHERE workspace_id = OLD.workspace_id AND assignee_ids @> ARRAY[OLD.id];
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workspace_members_unassign
+AFTER DELETE ON workspace_members
+FOR EACH ROW EXECUTE FUNCTION unassign_removed_member();
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000018_create_comments_table.down.sql
+
+DROP TABLE IF EXISTS comments;
\ No newline at end of file
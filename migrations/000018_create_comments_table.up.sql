@@ -0,0 +1,14 @@
+-- Filename: migrations/000018_create_comments_table.up.sql
+
+CREATE TABLE IF NOT EXISTS comments (
+    id bigserial PRIMARY KEY,
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    author text NOT NULL,
+    body text NOT NULL,
+    mentions text[] NOT NULL DEFAULT '{}',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS comments_list_id_idx ON comments (list_id, id);
\ No newline at end of file
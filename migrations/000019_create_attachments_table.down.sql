@@ -0,0 +1,6 @@
+-- Filename: migrations/000019_create_attachments_table.down.sql
+
+DROP TABLE IF EXISTS attachments;
+DROP FUNCTION IF EXISTS queue_blob_deletion();
+DROP TABLE IF EXISTS blob_deletions;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS max_storage;
\ No newline at end of file
@@ -0,0 +1,34 @@
+-- Filename: migrations/000019_create_attachments_table.up.sql
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id bigserial PRIMARY KEY,
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS attachments_list_id_idx ON attachments (list_id);
+
+-- the total size of the attachments a workspace may hold, 1GB by default
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS max_storage bigint NOT NULL DEFAULT 1073741824;
+
+-- the bytes of a deleted attachment are removed from the blob store by a background worker.
+-- the trigger also catches attachments deleted along with their list or workspace
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    storage_key text PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION queue_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER attachments_queue_blob_deletion
+AFTER DELETE ON attachments
+FOR EACH ROW EXECUTE FUNCTION queue_blob_deletion();
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000020_add_list_subtasks.down.sql
+
+ALTER TABLE lists DROP COLUMN IF EXISTS completion_rule;
+DROP INDEX IF EXISTS lists_parent_id_idx;
+ALTER TABLE lists DROP COLUMN IF EXISTS parent_id;
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- Filename: migrations/000020_add_list_subtasks.up.sql
+
+-- a subtask is a list with a parent. deleting a list deletes its subtasks
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES lists ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS lists_parent_id_idx ON lists (parent_id);
+
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS completion_rule text NOT NULL DEFAULT 'manual';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000021_create_list_dependencies_table.down.sql
+
+DROP TABLE IF EXISTS list_dependencies;
\ No newline at end of file
@@ -0,0 +1,13 @@
+-- Filename: migrations/000021_create_list_dependencies_table.up.sql
+
+-- list_id is blocked until blocked_by_id is done. lists report that they are blocked,
+-- finishing a blocked list is still allowed
+CREATE TABLE IF NOT EXISTS list_dependencies (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    blocked_by_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, blocked_by_id),
+    CHECK (list_id <> blocked_by_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_dependencies_blocked_by_id_idx ON list_dependencies (blocked_by_id);
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Filename: migrations/000022_add_list_position.down.sql
+
+DROP INDEX IF EXISTS lists_workspace_id_position_idx;
+ALTER TABLE lists DROP COLUMN IF EXISTS position;
\ No newline at end of file
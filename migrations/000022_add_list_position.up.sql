@@ -0,0 +1,15 @@
+-- Filename: migrations/000022_add_list_position.up.sql
+
+-- position orders lists by hand. the keys are compared byte by byte, so the column uses the C collation
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS position text COLLATE "C";
+
+UPDATE lists
+SET position = ranked.position
+FROM (
+    SELECT id, lpad((row_number() OVER (PARTITION BY workspace_id ORDER BY id))::text, 10, '0') || 'i' AS position
+    FROM lists
+) AS ranked
+WHERE lists.id = ranked.id;
+
+ALTER TABLE lists ALTER COLUMN position SET NOT NULL;
+CREATE INDEX IF NOT EXISTS lists_workspace_id_position_idx ON lists (workspace_id, position);
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Filename: migrations/000023_create_board_columns_table.down.sql
+
+DROP TABLE IF EXISTS board_columns;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- Filename: migrations/000023_create_board_columns_table.up.sql
+
+-- the columns of a workspace's board, one per status, in the order they are shown
+CREATE TABLE IF NOT EXISTS board_columns (
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    status text NOT NULL,
+    position integer NOT NULL,
+    wip_limit integer,
+    PRIMARY KEY (workspace_id, status)
+);
\ No newline at end of file
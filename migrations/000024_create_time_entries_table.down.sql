@@ -0,0 +1,3 @@
+-- Filename: migrations/000024_create_time_entries_table.down.sql
+
+DROP TABLE IF EXISTS time_entries;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- Filename: migrations/000024_create_time_entries_table.up.sql
+
+-- ended_at is null while the timer is running
+CREATE TABLE IF NOT EXISTS time_entries (
+    id bigserial PRIMARY KEY,
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_name text NOT NULL,
+    started_at timestamp(0) with time zone NOT NULL,
+    ended_at timestamp(0) with time zone,
+    note text NOT NULL DEFAULT '',
+    CHECK (ended_at >= started_at)
+);
+
+CREATE INDEX IF NOT EXISTS time_entries_list_id_idx ON time_entries (list_id, started_at);
+CREATE INDEX IF NOT EXISTS time_entries_workspace_id_idx ON time_entries (workspace_id, started_at);
+
+-- each person in a workspace has at most one running timer
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_idx ON time_entries (workspace_id, user_name) WHERE ended_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000025_add_list_estimates.down.sql
+
+DROP INDEX IF EXISTS list_events_workspace_id_created_at_idx;
+ALTER TABLE lists DROP COLUMN IF EXISTS estimate;
+ALTER TABLE workspaces DROP COLUMN IF EXISTS estimate_unit;
\ No newline at end of file
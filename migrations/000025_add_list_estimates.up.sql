@@ -0,0 +1,8 @@
+-- Filename: migrations/000025_add_list_estimates.up.sql
+
+-- what an estimate counts is set per workspace so every list in it can be added up
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS estimate_unit text NOT NULL DEFAULT 'points';
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS estimate integer CHECK (estimate >= 0);
+
+-- the stats replay a workspace's events by time
+CREATE INDEX IF NOT EXISTS list_events_workspace_id_created_at_idx ON list_events (workspace_id, created_at);
\ No newline at end of file
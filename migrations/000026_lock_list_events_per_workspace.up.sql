@@ -0,0 +1,31 @@
+-- Filename: migrations/000026_lock_list_events_per_workspace.up.sql
+
+-- ids only have to commit in order within a workspace. sync and stream replays read one workspace's events
+-- at a time and the event hub reads each event as it is announced, so a lock per workspace is enough
+-- and writes in one workspace no longer wait on another
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_advisory_xact_lock(hashtext('list_events'), hashtext(OLD.workspace_id::text));
+    ELSE
+        PERFORM pg_advisory_xact_lock(hashtext('list_events'), hashtext(NEW.workspace_id::text));
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.created', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.updated', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.deleted', OLD.id, OLD.workspace_id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
@@ -0,0 +1,28 @@
+-- Filename: migrations/000027_skip_events_when_renumbering.down.sql
+
+CREATE OR REPLACE FUNCTION record_list_event() RETURNS trigger AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_advisory_xact_lock(hashtext('list_events'), hashtext(OLD.workspace_id::text));
+    ELSE
+        PERFORM pg_advisory_xact_lock(hashtext('list_events'), hashtext(NEW.workspace_id::text));
+    END IF;
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.created', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.updated', NEW.id, NEW.workspace_id, to_jsonb(NEW))
+        RETURNING id INTO event_id;
+    ELSE
+        INSERT INTO list_events (event, list_id, workspace_id, list)
+        VALUES ('list.deleted', OLD.id, OLD.workspace_id, to_jsonb(OLD))
+        RETURNING id INTO event_id;
+    END IF;
+    PERFORM pg_notify('list_events', event_id::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
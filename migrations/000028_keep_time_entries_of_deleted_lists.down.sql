@@ -0,0 +1,9 @@
+-- Filename: migrations/000028_keep_time_entries_of_deleted_lists.down.sql
+
+DROP TRIGGER IF EXISTS lists_keep_time_entries ON lists;
+DROP FUNCTION IF EXISTS keep_time_entries();
+DELETE FROM time_entries WHERE list_id IS NULL;
+ALTER TABLE time_entries DROP CONSTRAINT IF EXISTS time_entries_list_id_fkey;
+ALTER TABLE time_entries ADD CONSTRAINT time_entries_list_id_fkey FOREIGN KEY (list_id) REFERENCES lists ON DELETE CASCADE;
+ALTER TABLE time_entries ALTER COLUMN list_id SET NOT NULL;
+ALTER TABLE time_entries DROP COLUMN IF EXISTS list_task;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- Filename: migrations/000028_keep_time_entries_of_deleted_lists.up.sql
+
+-- time entries are billable, so deleting a list keeps them. the entry loses its list but keeps the task it was
+-- booked to for reports, and a timer still running on the list is stopped so its owner can start another
+ALTER TABLE time_entries ADD COLUMN IF NOT EXISTS list_task text NOT NULL DEFAULT '';
+ALTER TABLE time_entries ALTER COLUMN list_id DROP NOT NULL;
+ALTER TABLE time_entries DROP CONSTRAINT IF EXISTS time_entries_list_id_fkey;
+ALTER TABLE time_entries ADD CONSTRAINT time_entries_list_id_fkey FOREIGN KEY (list_id) REFERENCES lists ON DELETE SET NULL;
+
+-- this runs before the foreign key clears list_id, including for subtasks deleted along with their parent
+CREATE OR REPLACE FUNCTION keep_time_entries() RETURNS trigger AS $$
+BEGIN
+    UPDATE time_entries
+    SET list_task = OLD.task, ended_at = COALESCE(ended_at, GREATEST(NOW(), started_at))
+    WHERE list_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER lists_keep_time_entries
+BEFORE DELETE ON lists
+FOR EACH ROW EXECUTE FUNCTION keep_time_entries();
\ No newline at end of file
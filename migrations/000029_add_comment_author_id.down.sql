@@ -0,0 +1,3 @@
+-- Filename: migrations/000029_add_comment_author_id.down.sql
+
+ALTER TABLE comments DROP COLUMN IF EXISTS author_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000029_add_comment_author_id.up.sql
+
+-- the member who wrote a comment with an api key or token, only they can change it.
+-- comments written without credentials keep it NULL, and it is cleared when the member is removed
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS author_id bigint REFERENCES workspace_members ON DELETE SET NULL;
\ No newline at end of file
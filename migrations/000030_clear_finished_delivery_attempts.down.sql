@@ -0,0 +1,4 @@
+-- Filename: migrations/000030_clear_finished_delivery_attempts.down.sql
+
+UPDATE webhook_deliveries SET next_attempt_at = NOW() WHERE next_attempt_at IS NULL;
+ALTER TABLE webhook_deliveries ALTER COLUMN next_attempt_at SET NOT NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000030_clear_finished_delivery_attempts.up.sql
+
+-- a delivery that succeeded or gave up has no next attempt
+ALTER TABLE webhook_deliveries ALTER COLUMN next_attempt_at DROP NOT NULL;
+UPDATE webhook_deliveries SET next_attempt_at = NULL WHERE status <> 'pending';
\ No newline at end of file
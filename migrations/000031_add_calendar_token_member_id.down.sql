@@ -0,0 +1,3 @@
+-- Filename: migrations/000031_add_calendar_token_member_id.down.sql
+
+ALTER TABLE calendar_tokens DROP COLUMN IF EXISTS member_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000031_add_calendar_token_member_id.up.sql
+
+-- the member who made a calendar token. the token goes when they leave the workspace, and tokens made
+-- without credentials keep it NULL
+ALTER TABLE calendar_tokens ADD COLUMN IF NOT EXISTS member_id bigint REFERENCES workspace_members ON DELETE CASCADE;
\ No newline at end of file
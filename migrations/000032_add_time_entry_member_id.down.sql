@@ -0,0 +1,3 @@
+-- Filename: migrations/000032_add_time_entry_member_id.down.sql
+
+ALTER TABLE time_entries DROP COLUMN IF EXISTS member_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- Filename: migrations/000032_add_time_entry_member_id.up.sql
+
+-- the member who booked an entry with an api key or token. only they or an admin can delete it, and only they
+-- can stop its timer. entries booked without credentials keep it NULL, and it is cleared when the member is removed
+ALTER TABLE time_entries ADD COLUMN IF NOT EXISTS member_id bigint REFERENCES workspace_members ON DELETE SET NULL;
\ No newline at end of file
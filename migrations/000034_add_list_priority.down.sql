@@ -0,0 +1,3 @@
+-- Filename: migrations/000034_add_list_priority.down.sql
+
+ALTER TABLE lists DROP COLUMN IF EXISTS priority;
\ No newline at end of file
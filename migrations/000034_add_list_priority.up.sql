@@ -0,0 +1,4 @@
+-- Filename: migrations/000034_add_list_priority.up.sql
+
+-- 0 is no priority and 3 the most urgent. lists due at the same time are worked on from the highest priority down
+ALTER TABLE lists ADD COLUMN IF NOT EXISTS priority smallint NOT NULL DEFAULT 0 CHECK (priority BETWEEN 0 AND 3);
\ No newline at end of file